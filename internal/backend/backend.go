@@ -0,0 +1,71 @@
+// Package backend defines how the runner executes the agent behind a research
+// job, and provides the claude CLI backend and a replay backend that plays
+// back a recorded transcript.
+package backend
+
+import (
+	"context"
+	"io"
+)
+
+// ---------------------------------------------------------------------------
+// Backend
+// ---------------------------------------------------------------------------
+
+// Backend starts runs of a research agent that report their progress as
+// claude stream-json on stdout.
+type Backend interface {
+	// Name identifies the backend, e.g. in logs.
+	Name() string
+	// Capabilities reports which optional features the backend supports.
+	Capabilities() Capabilities
+	// Start begins a run described by spec. Cancelling ctx cancels the run,
+	// as Execution.Cancel does. Errors wrap exec.ErrNotFound or
+	// fs.ErrNotExist when the agent could not be found.
+	Start(ctx context.Context, spec Spec) (Execution, error)
+}
+
+// Capabilities lists the optional features of a Backend.
+type Capabilities struct {
+	// Resume reports whether a run can continue an earlier session given
+	// its ID, as follow-ups and retries do.
+	Resume bool
+	// OutputDir reports whether runs write their files to the output
+	// directory that the prompt assigns them.
+	OutputDir bool
+}
+
+// Spec describes a single run of the agent.
+type Spec struct {
+	// Dir is the working directory of the run.
+	Dir string
+	// Prompt is the full prompt, including the orchestration prefix.
+	Prompt string
+	// Model is the model name, e.g. "opus".
+	Model string
+	// MaxTurns limits the agent's turns.
+	MaxTurns int
+	// ResumeSessionID, if set, is the session the run continues. It is only
+	// set for backends whose Capabilities include Resume.
+	ResumeSessionID string
+	// Stderr, if non-nil, receives the run's diagnostic output.
+	Stderr io.Writer
+}
+
+// ---------------------------------------------------------------------------
+// Execution
+// ---------------------------------------------------------------------------
+
+// Execution is a run started by a Backend.
+type Execution interface {
+	// Stdout returns the run's stream-json output, which reaches EOF when
+	// the run ends.
+	Stdout() io.Reader
+	// Cancel asks the run to stop and returns without waiting for it to
+	// do so. It may be called more than once.
+	Cancel()
+	// Wait waits for the run to end, after Stdout has been read to EOF, and
+	// returns its exit code. The code is -1 if the run was killed, or if its
+	// outcome is unknown, in which case the error says why.
+	Wait() (int, error)
+}
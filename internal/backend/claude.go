@@ -0,0 +1,149 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/envutil"
+)
+
+// DefaultTermGrace is how long a cancelled claude subprocess is given to exit
+// after SIGTERM before its whole process group is killed.
+const DefaultTermGrace = 10 * time.Second
+
+// waitDelaySlack is added to the termination grace period to form the
+// exec.Cmd WaitDelay backstop, after which Wait stops waiting on stdio.
+const waitDelaySlack = 5 * time.Second
+
+// Claude runs the claude CLI as a subprocess in its own process group.
+type Claude struct {
+	// Path is the path to the claude binary. When empty, "claude" is used,
+	// which relies on the PATH environment variable.
+	Path string
+
+	// TermGrace is how long the subprocess group may take to exit after
+	// SIGTERM before it is sent SIGKILL. Non-positive values select
+	// DefaultTermGrace.
+	TermGrace time.Duration
+}
+
+// Name returns "claude".
+func (c *Claude) Name() string {
+	return "claude"
+}
+
+// Capabilities reports that the claude CLI resumes sessions and writes
+// research output directories.
+func (c *Claude) Capabilities() Capabilities {
+	return Capabilities{Resume: true, OutputDir: true}
+}
+
+// Start launches claude in print mode with stream-json output. The
+// subprocess runs with a filtered environment (see envutil.FilteredEnv).
+// Cancelling the run sends SIGTERM to the subprocess group, escalating to
+// SIGKILL after TermGrace.
+func (c *Claude) Start(ctx context.Context, spec Spec) (Execution, error) {
+	path := c.Path
+	if path == "" {
+		path = "claude"
+	}
+	termGrace := c.TermGrace
+	if termGrace <= 0 {
+		termGrace = DefaultTermGrace
+	}
+
+	args := []string{
+		"-p",
+		"--dangerously-skip-permissions",
+		"--verbose",
+		"--output-format", "stream-json",
+		"--model", spec.Model,
+		"--max-turns", strconv.Itoa(spec.MaxTurns),
+	}
+	if spec.ResumeSessionID != "" {
+		args = append(args, "--resume", spec.ResumeSessionID)
+	}
+	args = append(args, spec.Prompt)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, path, args...)
+	setProcessGroup(cmd)
+	e := &claudeExecution{cmd: cmd, ctx: ctx, cancel: cancel}
+
+	// On cancellation send SIGTERM to the whole process group, then
+	// escalate to SIGKILL if it has not exited within the grace period.
+	cmd.Cancel = func() error {
+		e.escalation.Store(time.AfterFunc(termGrace, func() {
+			slog.Warn("backend: claude ignored SIGTERM, sending SIGKILL", "pid", cmd.Process.Pid)
+			_ = signalProcessGroup(cmd.Process, syscall.SIGKILL)
+		}))
+		return signalProcessGroup(cmd.Process, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = termGrace + waitDelaySlack
+
+	// Use a filtered environment (strips CLAUDE_* variables).
+	cmd.Env = envutil.FilteredEnv()
+	cmd.Dir = spec.Dir
+	cmd.Stderr = spec.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("create stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("start claude subprocess: %w", err)
+	}
+	e.stdout = stdout
+	slog.Debug("backend: claude started", "pid", cmd.Process.Pid, "dir", spec.Dir, "model", spec.Model, "resume", spec.ResumeSessionID)
+	return e, nil
+}
+
+// claudeExecution is a running claude subprocess.
+type claudeExecution struct {
+	cmd        *exec.Cmd
+	ctx        context.Context
+	cancel     context.CancelFunc
+	stdout     io.Reader
+	escalation atomic.Pointer[time.Timer]
+}
+
+func (e *claudeExecution) Stdout() io.Reader {
+	return e.stdout
+}
+
+func (e *claudeExecution) Cancel() {
+	e.cancel()
+}
+
+// Wait waits for the subprocess to exit. If the run was cancelled, it then
+// kills whatever is left of the process group.
+func (e *claudeExecution) Wait() (int, error) {
+	err := e.cmd.Wait()
+	if t := e.escalation.Load(); t != nil {
+		t.Stop()
+	}
+	if e.ctx.Err() != nil {
+		_ = signalProcessGroup(e.cmd.Process, syscall.SIGKILL)
+	}
+	e.cancel()
+
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	// Non-exit error (e.g. SIGTERM with WaitDelay timeout).
+	return -1, err
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package backend
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op on platforms without POSIX process groups.
+func setProcessGroup(_ *exec.Cmd) {}
+
+// signalProcessGroup kills p directly. Platforms without POSIX process groups
+// cannot deliver SIGTERM, so every signal is treated as a kill.
+func signalProcessGroup(p *os.Process, _ syscall.Signal) error {
+	if p == nil {
+		return nil
+	}
+	err := p.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package backend
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup configures cmd to start in its own process group so that
+// signals reach the claude process and every tool or subagent it spawns.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcessGroup delivers sig to the process group led by p. A group that
+// has already exited is not treated as an error.
+func signalProcessGroup(p *os.Process, sig syscall.Signal) error {
+	if p == nil {
+		return nil
+	}
+	err := syscall.Kill(-p.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,206 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Pacing of replayed lines that do not carry a timestamp.
+const (
+	// replayTokenDelay is the pause per output token of an assistant
+	// message, approximating the model's generation speed.
+	replayTokenDelay = 20 * time.Millisecond
+	// replayMinAssistantDelay is the shortest pause before an assistant
+	// message.
+	replayMinAssistantDelay = 300 * time.Millisecond
+	// replayToolDelay is the pause before a tool result.
+	replayToolDelay = 800 * time.Millisecond
+	// replayOtherDelay is the pause before any other line.
+	replayOtherDelay = 100 * time.Millisecond
+)
+
+// DefaultReplayMaxDelay is the longest pause between two replayed lines when
+// Replay.MaxDelay is not set.
+const DefaultReplayMaxDelay = 5 * time.Second
+
+// Replay plays back a recorded stream-json transcript, such as the output of
+// "claude -p --verbose --output-format stream-json" saved to a file, without
+// running an agent. Every run replays the same transcript, whatever its
+// prompt, so it suits demos, UI development and integration tests.
+//
+// Lines are paced like the original run: lines with an RFC 3339 "timestamp"
+// field keep the gap to the previous timestamped line, and other lines are
+// delayed according to their type, e.g. assistant messages in proportion to
+// their output tokens.
+type Replay struct {
+	// Path is the transcript file.
+	Path string
+
+	// Speed scales the pace of the replay: 2 plays twice as fast. Values
+	// of 0 or less select 1.
+	Speed float64
+
+	// MaxDelay caps the pause before any one line, after scaling. Values of
+	// 0 or less select DefaultReplayMaxDelay.
+	MaxDelay time.Duration
+}
+
+// Name returns "replay".
+func (r *Replay) Name() string {
+	return "replay"
+}
+
+// Capabilities reports that a replay can neither resume a session nor write
+// output files.
+func (r *Replay) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+// Start opens the transcript and begins writing it to the execution's
+// stdout. The run exits 0 if the transcript ends with a successful result
+// event, and 1 otherwise.
+func (r *Replay) Start(ctx context.Context, _ Spec) (Execution, error) {
+	f, err := os.Open(r.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open replay transcript: %w", err)
+	}
+
+	speed := r.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	maxDelay := r.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultReplayMaxDelay
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	e := &replayExecution{stdout: pr, cancel: cancel, done: make(chan struct{})}
+	// Closing the pipe on cancellation unblocks a pending write.
+	stop := context.AfterFunc(ctx, func() { pw.Close() })
+	go func() {
+		defer close(e.done)
+		defer stop()
+		defer f.Close()
+		e.code, e.err = replay(ctx, f, pw, speed, maxDelay)
+		pw.CloseWithError(e.err)
+	}()
+	return e, nil
+}
+
+// replay copies the transcript in src to dst line by line, pausing before
+// each line, and returns the run's exit code.
+func replay(ctx context.Context, src io.Reader, dst io.Writer, speed float64, maxDelay time.Duration) (int, error) {
+	scanner := bufio.NewScanner(src)
+	const bufSize = 512 * 1024
+	scanner.Buffer(make([]byte, bufSize), bufSize)
+
+	code := 1
+	var last time.Time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var fields replayLine
+		_ = json.Unmarshal(line, &fields)
+
+		delay := fields.delay(last)
+		if !fields.Timestamp.IsZero() {
+			last = fields.Timestamp
+		}
+		delay = min(time.Duration(float64(delay)/speed), maxDelay)
+		if delay > 0 {
+			timer.Reset(delay)
+			select {
+			case <-ctx.Done():
+				return -1, nil
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			return -1, nil
+		}
+
+		if _, err := fmt.Fprintf(dst, "%s\n", line); err != nil {
+			if ctx.Err() != nil {
+				return -1, nil
+			}
+			return -1, err
+		}
+		if fields.Type == "result" {
+			code = 1
+			if !fields.IsError {
+				code = 0
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return -1, fmt.Errorf("read replay transcript: %w", err)
+	}
+	return code, nil
+}
+
+// replayLine holds the fields of a transcript line that control its replay.
+type replayLine struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	IsError   bool      `json:"is_error"`
+	Message   struct {
+		Content []struct {
+			Type string `json:"type"`
+		} `json:"content"`
+		Usage struct {
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+}
+
+// delay returns the recorded pause before the line: the gap since prev if
+// both are timestamped, or else an estimate based on the line's type.
+func (l replayLine) delay(prev time.Time) time.Duration {
+	if !l.Timestamp.IsZero() && !prev.IsZero() {
+		return max(l.Timestamp.Sub(prev), 0)
+	}
+	switch l.Type {
+	case "assistant":
+		return max(time.Duration(l.Message.Usage.OutputTokens)*replayTokenDelay, replayMinAssistantDelay)
+	case "user":
+		for _, block := range l.Message.Content {
+			if block.Type == "tool_result" {
+				return replayToolDelay
+			}
+		}
+	}
+	return replayOtherDelay
+}
+
+// replayExecution is a transcript being replayed.
+type replayExecution struct {
+	stdout io.Reader
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// code and err are set before done is closed.
+	code int
+	err  error
+}
+
+func (e *replayExecution) Stdout() io.Reader {
+	return e.stdout
+}
+
+func (e *replayExecution) Cancel() {
+	e.cancel()
+}
+
+func (e *replayExecution) Wait() (int, error) {
+	<-e.done
+	e.cancel()
+	return e.code, e.err
+}
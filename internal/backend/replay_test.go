@@ -0,0 +1,139 @@
+package backend_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/backend"
+)
+
+// writeTranscript writes lines to a transcript file and returns its path.
+func writeTranscript(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transcript.ndjson")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// ---------------------------------------------------------------------------
+// Replay
+// ---------------------------------------------------------------------------
+
+func Test_Replay_PlaysTranscript(t *testing.T) {
+	path := filepath.Join("testdata", "research.ndjson")
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &backend.Replay{Path: path, Speed: 1000}
+	execution, err := r.Start(context.Background(), backend.Spec{Prompt: "anything"})
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	got, err := io.ReadAll(execution.Stdout())
+	if err != nil {
+		t.Fatalf("reading stdout: %v", err)
+	}
+	code, err := execution.Wait()
+	if code != 0 || err != nil {
+		t.Errorf("Wait() = (%d, %v), want (0, nil)", code, err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("stdout differs from the transcript:\n%s", got)
+	}
+}
+
+func Test_Replay_ExitCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  int
+	}{
+		{"successful result", []string{`{"type":"system","subtype":"init"}`, `{"type":"result","is_error":false}`}, 0},
+		{"error result", []string{`{"type":"result","is_error":true}`}, 1},
+		{"no result", []string{`{"type":"system","subtype":"init"}`}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &backend.Replay{Path: writeTranscript(t, tt.lines...), Speed: 1000}
+			execution, err := r.Start(context.Background(), backend.Spec{})
+			if err != nil {
+				t.Fatalf("Start() error: %v", err)
+			}
+			_, _ = io.Copy(io.Discard, execution.Stdout())
+			if code, err := execution.Wait(); code != tt.want || err != nil {
+				t.Errorf("Wait() = (%d, %v), want (%d, nil)", code, err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Replay_KeepsTimestampGaps(t *testing.T) {
+	path := writeTranscript(t,
+		`{"type":"system","subtype":"init","timestamp":"2026-01-01T12:00:00Z"}`,
+		`{"type":"result","is_error":false,"timestamp":"2026-01-01T12:00:02Z"}`,
+	)
+	r := &backend.Replay{Path: path, Speed: 10}
+	execution, err := r.Start(context.Background(), backend.Spec{})
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	start := time.Now()
+	_, _ = io.Copy(io.Discard, execution.Stdout())
+	execution.Wait()
+
+	// The 2s gap is replayed at ten times the speed.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("replay took %v, want about 200ms", elapsed)
+	}
+}
+
+func Test_Replay_Cancel(t *testing.T) {
+	path := writeTranscript(t,
+		`{"type":"system","subtype":"init","timestamp":"2026-01-01T12:00:00Z"}`,
+		`{"type":"result","is_error":false,"timestamp":"2026-01-01T13:00:00Z"}`,
+	)
+	r := &backend.Replay{Path: path, MaxDelay: time.Minute}
+	execution, err := r.Start(context.Background(), backend.Spec{})
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, execution.Cancel)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.Copy(io.Discard, execution.Stdout())
+		if code, err := execution.Wait(); code != -1 || err != nil {
+			t.Errorf("Wait() = (%d, %v), want (-1, nil)", code, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled replay did not end")
+	}
+}
+
+func Test_Replay_MissingTranscript(t *testing.T) {
+	r := &backend.Replay{Path: filepath.Join(t.TempDir(), "missing.ndjson")}
+	if _, err := r.Start(context.Background(), backend.Spec{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Start() error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func Test_Replay_Capabilities(t *testing.T) {
+	if caps := (&backend.Replay{}).Capabilities(); caps.Resume || caps.OutputDir {
+		t.Errorf("Capabilities() = %+v, want none", caps)
+	}
+}
@@ -0,0 +1,31 @@
+package jobstore
+
+import "sync"
+
+// broadcast wakes any number of waiters when a change happens. Each call to
+// wait returns a channel that is closed by the next call to notify; waiters
+// must call wait again after every wake-up. The zero value is ready to use.
+type broadcast struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait returns the channel closed by the next notify.
+func (b *broadcast) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch == nil {
+		b.ch = make(chan struct{})
+	}
+	return b.ch
+}
+
+// notify wakes every waiter of the current channel.
+func (b *broadcast) notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch != nil {
+		close(b.ch)
+		b.ch = nil
+	}
+}
@@ -0,0 +1,198 @@
+package jobstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// ---------------------------------------------------------------------------
+// EventLog
+// ---------------------------------------------------------------------------
+
+// EventLog holds a job's events in the order they were recorded. Event i of
+// the log is the event with Index i. Implementations need not be safe for
+// concurrent use; a Job serializes access under its own mutex, calling
+// Append and Close with exclusive access and Len and Range with shared
+// access.
+type EventLog interface {
+	// Append adds evt to the end of the log.
+	Append(evt model.ParsedEvent) error
+	// Len returns the number of events in the log.
+	Len() int
+	// Range returns copies of the events in [start, end), clamped to the
+	// log. On a read error it returns the events read before it.
+	Range(start, end int) ([]model.ParsedEvent, error)
+	// Close releases the log's resources. The log must not be used after.
+	Close() error
+}
+
+// ---------------------------------------------------------------------------
+// memoryLog
+// ---------------------------------------------------------------------------
+
+// memoryLog keeps every event in memory. It is the default EventLog.
+type memoryLog struct {
+	events []model.ParsedEvent
+}
+
+func (l *memoryLog) Append(evt model.ParsedEvent) error {
+	l.events = append(l.events, evt)
+	return nil
+}
+
+func (l *memoryLog) Len() int {
+	return len(l.events)
+}
+
+func (l *memoryLog) Range(start, end int) ([]model.ParsedEvent, error) {
+	start, end = clampRange(start, end, len(l.events))
+	out := make([]model.ParsedEvent, end-start)
+	copy(out, l.events[start:end])
+	return out, nil
+}
+
+func (l *memoryLog) Close() error {
+	l.events = nil
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// spillLog
+// ---------------------------------------------------------------------------
+
+// spillLog keeps at most window recent events in memory. When the window
+// fills, its older half is appended to an NDJSON segment file in dir, which
+// is created on the first spill and removed by Close. Reads are served from
+// the segment and the window transparently.
+type spillLog struct {
+	window int
+	dir    string
+	prefix string
+
+	file *os.File
+	// offsets[i] is the byte offset of spilled event i in file; size is the
+	// file's length.
+	offsets []int64
+	size    int64
+	// mem holds the events from index len(offsets) onwards.
+	mem []model.ParsedEvent
+}
+
+// newSpillLog returns a spillLog with the given window whose segment file
+// is created in dir with a name starting with prefix.
+func newSpillLog(window int, dir, prefix string) *spillLog {
+	return &spillLog{window: max(window, 2), dir: dir, prefix: prefix}
+}
+
+func (l *spillLog) Append(evt model.ParsedEvent) error {
+	l.mem = append(l.mem, evt)
+	if len(l.mem) <= l.window {
+		return nil
+	}
+	return l.spill(len(l.mem) - l.window/2)
+}
+
+// spill moves the oldest n in-memory events to the segment file. If the
+// write fails the events stay in memory.
+func (l *spillLog) spill(n int) error {
+	if l.file == nil {
+		if err := os.MkdirAll(l.dir, 0o755); err != nil {
+			return fmt.Errorf("mkdir %s: %w", l.dir, err)
+		}
+		f, err := os.CreateTemp(l.dir, l.prefix+"-*.ndjson")
+		if err != nil {
+			return fmt.Errorf("create event segment: %w", err)
+		}
+		l.file = f
+	}
+
+	var buf bytes.Buffer
+	offsets := make([]int64, 0, n)
+	for _, evt := range l.mem[:n] {
+		offsets = append(offsets, l.size+int64(buf.Len()))
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return fmt.Errorf("encode event %d: %w", evt.Index, err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if _, err := l.file.WriteAt(buf.Bytes(), l.size); err != nil {
+		return fmt.Errorf("write %s: %w", l.file.Name(), err)
+	}
+
+	l.offsets = append(l.offsets, offsets...)
+	l.size += int64(buf.Len())
+	l.mem = append([]model.ParsedEvent(nil), l.mem[n:]...)
+	return nil
+}
+
+func (l *spillLog) Len() int {
+	return len(l.offsets) + len(l.mem)
+}
+
+func (l *spillLog) Range(start, end int) ([]model.ParsedEvent, error) {
+	start, end = clampRange(start, end, l.Len())
+	out := make([]model.ParsedEvent, 0, end-start)
+
+	spilled := len(l.offsets)
+	if start < spilled {
+		diskEnd := min(end, spilled)
+		events, err := l.readSegment(start, diskEnd)
+		out = append(out, events...)
+		if err != nil {
+			return out, err
+		}
+		start = diskEnd
+	}
+	if start < end {
+		out = append(out, l.mem[start-spilled:end-spilled]...)
+	}
+	return out, nil
+}
+
+// readSegment decodes spilled events [start, end) from the segment file.
+func (l *spillLog) readSegment(start, end int) ([]model.ParsedEvent, error) {
+	from := l.offsets[start]
+	to := l.size
+	if end < len(l.offsets) {
+		to = l.offsets[end]
+	}
+	buf := make([]byte, to-from)
+	if _, err := l.file.ReadAt(buf, from); err != nil {
+		return nil, fmt.Errorf("read %s: %w", l.file.Name(), err)
+	}
+
+	events := make([]model.ParsedEvent, 0, end-start)
+	for line := range bytes.Lines(buf) {
+		var evt model.ParsedEvent
+		if err := json.Unmarshal(line, &evt); err != nil {
+			return events, fmt.Errorf("decode %s: %w", l.file.Name(), err)
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+func (l *spillLog) Close() error {
+	l.mem, l.offsets = nil, nil
+	if l.file == nil {
+		return nil
+	}
+	name := l.file.Name()
+	err := l.file.Close()
+	l.file = nil
+	return errors.Join(err, os.Remove(name))
+}
+
+// clampRange restricts [start, end) to [0, n).
+func clampRange(start, end, n int) (int, int) {
+	start = min(max(start, 0), n)
+	end = min(max(end, start), n)
+	return start, end
+}
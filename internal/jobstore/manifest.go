@@ -0,0 +1,95 @@
+package jobstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// ---------------------------------------------------------------------------
+// Manifest
+// ---------------------------------------------------------------------------
+
+// ReadManifest reads the manifest of the research output directory dir.
+// The error wraps fs.ErrNotExist if the directory has no manifest.
+func ReadManifest(dir string) (model.Manifest, error) {
+	var m model.Manifest
+	path := filepath.Join(dir, model.ManifestFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// WriteManifest records run in the manifest of the research output directory
+// dir. A run of the job that the manifest already describes replaces it;
+// runs of other jobs, such as follow-ups writing into their parent's
+// directory, are added to or replaced in its FollowUps. An unreadable
+// manifest is overwritten. The file is replaced atomically.
+func WriteManifest(dir string, run model.RunManifest) error {
+	m, err := ReadManifest(dir)
+	switch {
+	case err != nil || m.JobID == "" || m.JobID == run.JobID:
+		m.RunManifest = run
+	default:
+		i := 0
+		for i < len(m.FollowUps) && m.FollowUps[i].JobID != run.JobID {
+			i++
+		}
+		if i == len(m.FollowUps) {
+			m.FollowUps = append(m.FollowUps, run)
+		} else {
+			m.FollowUps[i] = run
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	path := filepath.Join(dir, model.ManifestFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename %s: %w", tmp, err)
+	}
+	return nil
+}
+
+// ManifestRun returns the job's entry for its output directory's manifest,
+// for a run that started at startedAt and finished at finishedAt.
+func (j *Job) ManifestRun(startedAt, finishedAt time.Time) model.RunManifest {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	var resultInfo *model.ResultStats
+	if !isZeroResultStats(j.resultInfo) {
+		ri := j.resultInfo
+		resultInfo = &ri
+	}
+	return model.RunManifest{
+		JobID:      j.id,
+		ParentID:   j.parentID,
+		Query:      j.query,
+		Model:      model.ModelName(j.model),
+		MaxTurns:   j.maxTurns,
+		Status:     j.status,
+		ErrorKind:  j.errorKind,
+		Error:      j.errMsg,
+		CreatedAt:  j.createdAt,
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: finishedAt.UTC(),
+		SessionID:  j.sessionID,
+		ResultInfo: resultInfo,
+	}
+}
@@ -0,0 +1,123 @@
+package jobstore_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/jobstore"
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// ---------------------------------------------------------------------------
+// Manifest
+// ---------------------------------------------------------------------------
+
+func Test_WriteManifest_Roundtrip(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2026, 3, 14, 15, 0, 0, 0, time.UTC)
+	run := model.RunManifest{
+		JobID:      "job-1",
+		Query:      "AI trends",
+		Model:      model.ModelOpus,
+		MaxTurns:   10,
+		Status:     model.StatusCompleted,
+		CreatedAt:  created,
+		StartedAt:  created.Add(time.Second),
+		FinishedAt: created.Add(time.Minute),
+		SessionID:  "sess-1",
+		ResultInfo: &model.ResultStats{CostUSD: ptr(0.5)},
+	}
+	if err := jobstore.WriteManifest(dir, run); err != nil {
+		t.Fatalf("WriteManifest() error: %v", err)
+	}
+
+	m, err := jobstore.ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("ReadManifest() error: %v", err)
+	}
+	if m.JobID != "job-1" || m.Query != "AI trends" || m.Status != model.StatusCompleted || m.SessionID != "sess-1" {
+		t.Errorf("ReadManifest() = %+v, want the written run", m)
+	}
+	if !m.FinishedAt.Equal(run.FinishedAt) || m.ResultInfo == nil || *m.ResultInfo.CostUSD != 0.5 {
+		t.Errorf("ReadManifest() = %+v, want timestamps and result info", m)
+	}
+}
+
+func Test_WriteManifest_FollowUps(t *testing.T) {
+	dir := t.TempDir()
+	write := func(run model.RunManifest) {
+		t.Helper()
+		if err := jobstore.WriteManifest(dir, run); err != nil {
+			t.Fatalf("WriteManifest() error: %v", err)
+		}
+	}
+	write(model.RunManifest{JobID: "parent", Query: "first", Status: model.StatusCompleted})
+	write(model.RunManifest{JobID: "child", ParentID: "parent", Query: "second", Status: model.StatusFailed})
+	write(model.RunManifest{JobID: "child", ParentID: "parent", Query: "second", Status: model.StatusCompleted})
+	write(model.RunManifest{JobID: "grandchild", ParentID: "child", Query: "third", Status: model.StatusCompleted})
+
+	m, err := jobstore.ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("ReadManifest() error: %v", err)
+	}
+	if m.JobID != "parent" || m.Query != "first" {
+		t.Errorf("root run = %+v, want the parent job", m.RunManifest)
+	}
+	if len(m.FollowUps) != 2 {
+		t.Fatalf("len(FollowUps) = %d, want 2", len(m.FollowUps))
+	}
+	if m.FollowUps[0].JobID != "child" || m.FollowUps[0].Status != model.StatusCompleted {
+		t.Errorf("FollowUps[0] = %+v, want the child's latest run", m.FollowUps[0])
+	}
+	if m.FollowUps[1].JobID != "grandchild" {
+		t.Errorf("FollowUps[1] = %+v, want the grandchild", m.FollowUps[1])
+	}
+}
+
+func Test_ReadManifest_Missing(t *testing.T) {
+	if _, err := jobstore.ReadManifest(t.TempDir()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadManifest() error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func Test_WriteManifest_ReplacesUnreadableManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, model.ManifestFileName), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobstore.WriteManifest(dir, model.RunManifest{JobID: "job-1"}); err != nil {
+		t.Fatalf("WriteManifest() error: %v", err)
+	}
+	if m, err := jobstore.ReadManifest(dir); err != nil || m.JobID != "job-1" {
+		t.Errorf("ReadManifest() = (%+v, %v), want job-1", m, err)
+	}
+}
+
+func Test_Job_ManifestRun(t *testing.T) {
+	s := jobstore.NewStore()
+	j := s.Create("job-1", "query", "sonnet", 20, "/tmp")
+	j.SetParentID("parent-1")
+	j.SetSessionID("sess-1")
+	j.SetErrorKind(model.ErrorKindTimeout)
+	j.SetError("timed out")
+	j.SetStatus(model.StatusFailed)
+
+	started := time.Now()
+	run := j.ManifestRun(started, started.Add(time.Minute))
+	if run.JobID != "job-1" || run.ParentID != "parent-1" || run.Model != model.ModelSonnet || run.MaxTurns != 20 {
+		t.Errorf("ManifestRun() = %+v, want the job's identity", run)
+	}
+	if run.Status != model.StatusFailed || run.ErrorKind != model.ErrorKindTimeout || run.Error != "timed out" {
+		t.Errorf("ManifestRun() = %+v, want the job's outcome", run)
+	}
+	if run.ResultInfo != nil {
+		t.Errorf("ResultInfo = %+v, want nil without a result", run.ResultInfo)
+	}
+	if run.FinishedAt.Sub(run.StartedAt) != time.Minute {
+		t.Errorf("FinishedAt - StartedAt = %v, want 1m", run.FinishedAt.Sub(run.StartedAt))
+	}
+}
@@ -0,0 +1,283 @@
+package jobstore
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// ---------------------------------------------------------------------------
+// Past run metadata
+// ---------------------------------------------------------------------------
+
+// Files of a research output directory that past run metadata is read from.
+const (
+	reportFileName      = "report.md"
+	sourcesDirName      = "sources"
+	sourceIndexFileName = "index.md"
+)
+
+// pastRunCache keeps the description of each past run directory until one of
+// the files it was read from changes, so that listing runs does not re-read
+// every report.
+type pastRunCache struct {
+	mu      sync.Mutex
+	entries map[string]pastRunEntry
+}
+
+// pastRunEntry is a cached past run together with the state of the files it
+// was read from and the time it is sorted by.
+type pastRunEntry struct {
+	key    pastRunKey
+	run    model.PastRun
+	sortAt time.Time
+}
+
+// pastRunKey records the size and modification time of the files and
+// directories a past run's description depends on. Adding or removing a file
+// changes its directory's modification time, so the total size is refreshed
+// when sources are added; a file rewritten in place elsewhere in the run is
+// only counted once something else changes. The key is kept to a few stats
+// so that listing hundreds of runs stays cheap.
+type pastRunKey [5]fileStamp
+
+// equal reports whether k and o describe the same files.
+func (k pastRunKey) equal(o pastRunKey) bool {
+	for i := range k {
+		if !k[i].equal(o[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// fileStamp is the size and modification time of a file, or zero if it does
+// not exist.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// equal reports whether s and o are the same stamp. Times are compared with
+// Equal, since == also compares their locations and monotonic readings.
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+// stat returns the stamp of the file at path.
+func stat(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}
+}
+
+// keyOf returns the current key of the past run directory dir.
+func keyOf(dir string) pastRunKey {
+	sources := filepath.Join(dir, sourcesDirName)
+	return pastRunKey{
+		stat(dir),
+		stat(filepath.Join(dir, reportFileName)),
+		stat(filepath.Join(dir, model.ManifestFileName)),
+		stat(sources),
+		stat(filepath.Join(sources, sourceIndexFileName)),
+	}
+}
+
+// get returns the description of the past run directory dir, reading it
+// afresh if the cached one is out of date.
+func (c *pastRunCache) get(dir string) pastRunEntry {
+	key := keyOf(dir)
+	c.mu.Lock()
+	entry, ok := c.entries[dir]
+	c.mu.Unlock()
+	if ok && entry.key.equal(key) {
+		return entry
+	}
+
+	run, sortAt := describePastRun(dir)
+	entry = pastRunEntry{key: key, run: run, sortAt: sortAt}
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]pastRunEntry)
+	}
+	c.entries[dir] = entry
+	c.mu.Unlock()
+	return entry
+}
+
+// prune drops the cached runs in parent that are not in keep.
+func (c *pastRunCache) prune(parent string, keep map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for dir := range c.entries {
+		if filepath.Dir(dir) == parent && !keep[dir] {
+			delete(c.entries, dir)
+		}
+	}
+}
+
+// describePastRun reads the metadata of the past run directory dir: the topic
+// and time from its name, its manifest, the title, query and length of its
+// report, its source index and the total size of its files. It also returns
+// the time the run is sorted by: the time in its name, or else the creation
+// time in its manifest, or else the directory's modification time.
+func describePastRun(dir string) (model.PastRun, time.Time) {
+	name := filepath.Base(dir)
+	run := model.PastRun{Dir: dir, Name: name}
+
+	topic, created, ok := model.ParseOutputDirName(name)
+	run.Topic = topic
+	sortAt := created
+	if ok {
+		run.Timestamp = created.UTC().Format(time.RFC3339)
+	}
+
+	if m, err := ReadManifest(dir); err == nil {
+		m.Fill(&run)
+		if sortAt.IsZero() {
+			sortAt = m.CreatedAt
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("jobstore: ignoring unreadable manifest", "dir", dir, "err", err)
+	}
+	if sortAt.IsZero() {
+		sortAt = stat(dir).modTime
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, reportFileName)); err == nil {
+		run.HasReport = true
+		title, query, words := parseReport(string(data))
+		run.Title = title
+		run.WordCount = words
+		if run.Query == "" {
+			run.Query = query
+		}
+	}
+	if run.Status == "" {
+		run.Status = model.StatusUnknown
+		if run.HasReport {
+			run.Status = model.StatusCompleted
+		}
+	}
+
+	sources := filepath.Join(dir, sourcesDirName)
+	if data, err := os.ReadFile(filepath.Join(sources, sourceIndexFileName)); err == nil {
+		total, archived := parseSourceIndex(string(data))
+		run.SourceCount = total
+		if total > 0 {
+			rate := float64(archived) / float64(total)
+			run.ArchiveSuccessRate = &rate
+		}
+	} else {
+		run.SourceCount = countSources(sources)
+	}
+
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			run.TotalSize += info.Size()
+		}
+		return nil
+	})
+
+	return run, sortAt
+}
+
+// parseReport returns the title of a report written to the template in the
+// research prompt (its first "# " heading), the query from its "*Query:*"
+// line, and the number of words before its "## Sources" section, markup
+// aside.
+func parseReport(report string) (title, query string, words int) {
+	inSources := false
+	scanner := bufio.NewScanner(strings.NewReader(report))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case title == "" && strings.HasPrefix(line, "# "):
+			title = strings.TrimSpace(line[2:])
+		case query == "" && strings.HasPrefix(line, "*Query:"):
+			query = strings.TrimSpace(strings.Trim(line, "*")[len("Query:"):])
+			query = strings.Trim(query, `"“”`)
+		case strings.HasPrefix(line, "## "):
+			inSources = strings.EqualFold(strings.TrimSpace(line[3:]), "Sources")
+		}
+		if !inSources {
+			words += countWords(line)
+		}
+	}
+	return title, query, words
+}
+
+// countWords counts the words in a line of Markdown, skipping markup such as
+// heading markers and rules that has no letters or digits.
+func countWords(line string) int {
+	n := 0
+	for _, field := range strings.Fields(line) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// parseSourceIndex counts the sources listed in a source index written by
+// the source-archiver agent, and how many of them were archived, i.e. whose
+// Status column is "ok".
+func parseSourceIndex(index string) (total, archived int) {
+	for line := range strings.Lines(index) {
+		cells := strings.Split(strings.Trim(strings.TrimSpace(line), "|"), "|")
+		if len(cells) < 2 || !isNumber(strings.TrimSpace(cells[0])) {
+			continue
+		}
+		total++
+		if strings.EqualFold(strings.TrimSpace(cells[len(cells)-1]), "ok") {
+			archived++
+		}
+	}
+	return total, archived
+}
+
+// countSources counts the sources archived in dir, taking the copies of a
+// source in different formats (e.g. 001-example-com.md and .html) as one.
+func countSources(dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == sourceIndexFileName {
+			continue
+		}
+		seen[strings.TrimSuffix(name, filepath.Ext(name))] = true
+	}
+	return len(seen)
+}
+
+// isNumber reports whether s is a non-empty string of ASCII digits.
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package jobstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamesprial/research-dashboard/internal/jobstore"
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// writeFiles creates the files in dir, given as slash-separated relative
+// paths mapped to their content.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const testReport = `# Solid-State Batteries in 2026
+
+*Research conducted: 2026-03-14*
+*Query: "What is the state of solid-state batteries?"*
+
+---
+
+## Executive Summary
+
+Three vendors ship cells today [1].
+
+## Sources
+
+| # | Title | URL | Local |
+|---|-------|-----|-------|
+| 1 | Example | [example.com](https://example.com) | [md](sources/001-example-com.md) |
+`
+
+const testSourceIndex = `# Source Index
+
+| # | Title | URL | Markdown | HTML | Status |
+|---|-------|-----|----------|------|--------|
+| 1 | One | https://one.example | [md](001-one.md) | [html](001-one.html) | ok |
+| 2 | Two | https://two.example | [md](002-two.md) | [html](002-two.html) | ok |
+| 3 | Three | https://three.example | - | - | failed: 403 |
+| 4 | Four | https://four.example | [md](004-four.md) | - | ok |
+`
+
+// ---------------------------------------------------------------------------
+// Store.PastRuns metadata
+// ---------------------------------------------------------------------------
+
+func Test_Store_PastRuns_Metadata(t *testing.T) {
+	cwd := t.TempDir()
+	name := "research-solid-state-batteries-20260314-150926-3f2a9c1e"
+	files := map[string]string{
+		"report.md":            testReport,
+		"sources/index.md":     testSourceIndex,
+		"sources/001-one.md":   "one",
+		"sources/001-one.html": "<p>one</p>",
+	}
+	writeFiles(t, filepath.Join(cwd, name), files)
+	var size int64
+	for _, content := range files {
+		size += int64(len(content))
+	}
+
+	runs := jobstore.NewStore().PastRuns(cwd)
+	if len(runs) != 1 {
+		t.Fatalf("PastRuns() returned %d runs, want 1", len(runs))
+	}
+	run := runs[0]
+	if run.Topic != "solid state batteries" || run.Timestamp != "2026-03-14T15:09:26Z" {
+		t.Errorf("Topic, Timestamp = %q, %q, want %q, %q", run.Topic, run.Timestamp, "solid state batteries", "2026-03-14T15:09:26Z")
+	}
+	if !run.HasReport || run.Title != "Solid-State Batteries in 2026" {
+		t.Errorf("HasReport, Title = %v, %q, want true and the report's heading", run.HasReport, run.Title)
+	}
+	if run.Query != "What is the state of solid-state batteries?" {
+		t.Errorf("Query = %q, want the report's query line", run.Query)
+	}
+	// Words before the Sources section count; heading markers and rules
+	// do not.
+	if run.WordCount != 23 {
+		t.Errorf("WordCount = %d, want 23", run.WordCount)
+	}
+	if run.SourceCount != 4 || run.ArchiveSuccessRate == nil || *run.ArchiveSuccessRate != 0.75 {
+		t.Errorf("SourceCount, ArchiveSuccessRate = %d, %v, want 4 and 0.75", run.SourceCount, run.ArchiveSuccessRate)
+	}
+	if run.TotalSize != size {
+		t.Errorf("TotalSize = %d, want %d", run.TotalSize, size)
+	}
+}
+
+func Test_Store_PastRuns_WithoutSourceIndex(t *testing.T) {
+	cwd := t.TempDir()
+	writeFiles(t, filepath.Join(cwd, "research-topic-20240101-120000"), map[string]string{
+		"sources/001-a-com.md":   "a",
+		"sources/001-a-com.html": "a",
+		"sources/002-b-com.md":   "b",
+	})
+
+	run := jobstore.NewStore().PastRuns(cwd)[0]
+	if run.SourceCount != 2 || run.ArchiveSuccessRate != nil {
+		t.Errorf("SourceCount, ArchiveSuccessRate = %d, %v, want 2 and nil", run.SourceCount, run.ArchiveSuccessRate)
+	}
+	if run.HasReport || run.Title != "" || run.WordCount != 0 {
+		t.Errorf("run = %+v, want no report metadata", run)
+	}
+}
+
+func Test_Store_PastRuns_ManifestQueryWins(t *testing.T) {
+	cwd := t.TempDir()
+	dir := filepath.Join(cwd, "research-topic-20240101-120000")
+	writeFiles(t, dir, map[string]string{"report.md": testReport})
+	if err := jobstore.WriteManifest(dir, model.RunManifest{JobID: "job-1", Query: "the exact query"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if run := jobstore.NewStore().PastRuns(cwd)[0]; run.Query != "the exact query" {
+		t.Errorf("Query = %q, want the manifest's", run.Query)
+	}
+}
+
+func Test_Store_PastRuns_RefreshesChangedRuns(t *testing.T) {
+	cwd := t.TempDir()
+	dir := filepath.Join(cwd, "research-topic-20240101-120000")
+	writeFiles(t, dir, map[string]string{"report.md": "# Draft\n"})
+	s := jobstore.NewStore()
+	if run := s.PastRuns(cwd)[0]; run.Title != "Draft" {
+		t.Fatalf("Title = %q, want %q", run.Title, "Draft")
+	}
+
+	writeFiles(t, dir, map[string]string{"report.md": "# Final report\n"})
+	if run := s.PastRuns(cwd)[0]; run.Title != "Final report" {
+		t.Errorf("Title = %q after the report changed, want %q", run.Title, "Final report")
+	}
+
+	// Adding a source changes neither the report nor the source index,
+	// only the run's total size.
+	writeFiles(t, dir, map[string]string{"sources/001-one.md": "short"})
+	before := s.PastRuns(cwd)[0].TotalSize
+	writeFiles(t, dir, map[string]string{"sources/002-two.md": "another source"})
+	if run := s.PastRuns(cwd)[0]; run.TotalSize != before+14 {
+		t.Errorf("TotalSize = %d after a source was added, want %d", run.TotalSize, before+14)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if runs := s.PastRuns(cwd); len(runs) != 0 {
+		t.Errorf("PastRuns() = %+v after the run was removed, want none", runs)
+	}
+}
@@ -0,0 +1,323 @@
+package jobstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// ---------------------------------------------------------------------------
+// Persister
+// ---------------------------------------------------------------------------
+
+// Persister durably records job metadata and event logs so that a Store can
+// be rehydrated after a process restart. Implementations must be safe for
+// concurrent use by multiple jobs; calls for a single job are serialised by
+// the Job itself.
+type Persister interface {
+	// SaveJob writes (or overwrites) the metadata record for a job.
+	SaveJob(rec JobRecord) error
+	// AppendEvent appends a single event to the job's event log.
+	AppendEvent(jobID string, evt model.ParsedEvent) error
+	// DeleteJob removes all persisted state for the job. Deleting an unknown
+	// job is not an error.
+	DeleteJob(jobID string) error
+	// LoadJobs returns every persisted job together with its event log.
+	LoadJobs() ([]PersistedJob, error)
+}
+
+// JobRecord is the serializable metadata of a Job, excluding its event log.
+type JobRecord struct {
+	ID         string            `json:"id"`
+	Query      string            `json:"query"`
+	Model      string            `json:"model"`
+	MaxTurns   int               `json:"max_turns"`
+	CWD        string            `json:"cwd"`
+	Status     model.Status      `json:"status"`
+	CreatedAt  time.Time         `json:"created_at"`
+	OutputDir  string            `json:"output_dir,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	SessionID  string            `json:"session_id,omitempty"`
+	ResultInfo model.ResultStats `json:"result_info"`
+
+	ParentID        string `json:"parent_id,omitempty"`
+	ResumeSessionID string `json:"resume_session_id,omitempty"`
+
+	MaxCostUSD       float64          `json:"max_cost_usd,omitempty"`
+	MaxTokens        int              `json:"max_tokens,omitempty"`
+	Usage            model.TokenUsage `json:"usage"`
+	EstimatedCostUSD float64          `json:"estimated_cost_usd,omitempty"`
+	ErrorKind        model.ErrorKind  `json:"error_kind,omitempty"`
+	TimeoutSeconds   int              `json:"timeout_seconds,omitempty"`
+	Progress         *model.Progress  `json:"progress,omitempty"`
+
+	Attempt int               `json:"attempt,omitempty"`
+	Retry   model.RetryPolicy `json:"retry"`
+}
+
+// PersistedJob pairs a JobRecord with the event log loaded alongside it.
+type PersistedJob struct {
+	Record JobRecord
+	Events []model.ParsedEvent
+}
+
+// ---------------------------------------------------------------------------
+// FilePersister
+// ---------------------------------------------------------------------------
+
+const (
+	jobFileName    = "job.json"
+	eventsFileName = "events.ndjson"
+)
+
+// FilePersister stores each job in its own subdirectory of a base directory:
+// a job.json metadata file that is atomically replaced on every save, and an
+// append-only events.ndjson log with one JSON-encoded event per line. The
+// event log of each job is kept open until the job reaches a terminal
+// status or is deleted. Events recorded after that, such as a cancelled
+// subprocess's last output, are appended through a handle that is closed
+// again straight away.
+type FilePersister struct {
+	dir string
+
+	mu       sync.Mutex
+	events   map[string]*os.File
+	finished map[string]bool
+}
+
+// NewFilePersister returns a FilePersister rooted at dir. The directory is
+// created lazily on the first write.
+func NewFilePersister(dir string) *FilePersister {
+	return &FilePersister{
+		dir:      dir,
+		events:   make(map[string]*os.File),
+		finished: make(map[string]bool),
+	}
+}
+
+// jobDir returns the directory holding the given job's files. It rejects IDs
+// that would escape the base directory.
+func (p *FilePersister) jobDir(jobID string) (string, error) {
+	if jobID == "" || jobID == "." || jobID == ".." || strings.ContainsAny(jobID, `/\`) {
+		return "", fmt.Errorf("invalid job id %q", jobID)
+	}
+	return filepath.Join(p.dir, jobID), nil
+}
+
+// SaveJob writes rec to {dir}/{id}/job.json via a temp file and rename so a
+// crash mid-write never leaves a truncated record behind.
+func (p *FilePersister) SaveJob(rec JobRecord) error {
+	dir, err := p.jobDir(rec.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode job %s: %w", rec.ID, err)
+	}
+
+	tmp := filepath.Join(dir, jobFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, jobFileName)); err != nil {
+		return fmt.Errorf("rename %s: %w", tmp, err)
+	}
+	p.mu.Lock()
+	if rec.Status.IsTerminal() {
+		p.finished[rec.ID] = true
+	} else {
+		delete(p.finished, rec.ID)
+	}
+	p.mu.Unlock()
+	if rec.Status.IsTerminal() {
+		return p.closeEvents(rec.ID)
+	}
+	return nil
+}
+
+// AppendEvent appends evt as a single line to {dir}/{id}/events.ndjson,
+// opening the file on the job's first event.
+func (p *FilePersister) AppendEvent(jobID string, evt model.ParsedEvent) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("encode event %d: %w", evt.Index, err)
+	}
+	data = append(data, '\n')
+
+	f, keep, err := p.eventsFile(jobID)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		err = fmt.Errorf("append %s: %w", f.Name(), err)
+	}
+	if !keep {
+		err = errors.Join(err, f.Close())
+	}
+	return err
+}
+
+// eventsFile returns the event log of the job, opening it if needed, and
+// whether it stays open. The log of a finished job is opened afresh for
+// each event, and the caller must close it.
+func (p *FilePersister) eventsFile(jobID string) (f *os.File, keep bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if f, ok := p.events[jobID]; ok {
+		return f, true, nil
+	}
+
+	dir, err := p.jobDir(jobID)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, false, fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, eventsFileName)
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, false, fmt.Errorf("open %s: %w", path, err)
+	}
+	if p.finished[jobID] {
+		return f, false, nil
+	}
+	p.events[jobID] = f
+	return f, true, nil
+}
+
+// closeEvents closes the job's event log if it is open.
+func (p *FilePersister) closeEvents(jobID string) error {
+	p.mu.Lock()
+	f, ok := p.events[jobID]
+	delete(p.events, jobID)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return f.Close()
+}
+
+// Close closes every open event log.
+func (p *FilePersister) Close() error {
+	p.mu.Lock()
+	files := p.events
+	p.events = make(map[string]*os.File)
+	p.mu.Unlock()
+
+	var errs []error
+	for _, f := range files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteJob removes the job's directory and everything in it.
+func (p *FilePersister) DeleteJob(jobID string) error {
+	dir, err := p.jobDir(jobID)
+	if err != nil {
+		return err
+	}
+	if err := p.closeEvents(jobID); err != nil {
+		slog.Warn("jobstore: failed to close event log", "job_id", jobID, "err", err)
+	}
+	p.mu.Lock()
+	delete(p.finished, jobID)
+	p.mu.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// LoadJobs reads every job directory under the base directory. Directories
+// without a readable job.json are skipped with a warning. A missing base
+// directory yields no jobs and no error.
+func (p *FilePersister) LoadJobs() ([]PersistedJob, error) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read %s: %w", p.dir, err)
+	}
+
+	var jobs []PersistedJob
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(p.dir, entry.Name())
+
+		data, err := os.ReadFile(filepath.Join(dir, jobFileName))
+		if err != nil {
+			slog.Warn("jobstore: skipping job without metadata", "dir", dir, "err", err)
+			continue
+		}
+		var rec JobRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			slog.Warn("jobstore: skipping job with corrupt metadata", "dir", dir, "err", err)
+			continue
+		}
+
+		if rec.Status.IsTerminal() {
+			p.mu.Lock()
+			p.finished[rec.ID] = true
+			p.mu.Unlock()
+		}
+
+		events, err := readEventLog(filepath.Join(dir, eventsFileName))
+		if err != nil {
+			slog.Warn("jobstore: event log unreadable", "job_id", rec.ID, "err", err)
+		}
+		jobs = append(jobs, PersistedJob{Record: rec, Events: events})
+	}
+	return jobs, nil
+}
+
+// readEventLog decodes an NDJSON event log. Reading stops at the first line
+// that fails to decode, which is how a write torn by a crash manifests; the
+// events before it are still returned. A missing file yields no events.
+func readEventLog(path string) ([]model.ParsedEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []model.ParsedEvent
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var evt model.ParsedEvent
+			if jsonErr := json.Unmarshal(line, &evt); jsonErr != nil {
+				return events, fmt.Errorf("decode %s: %w", path, jsonErr)
+			}
+			events = append(events, evt)
+		}
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+	}
+}
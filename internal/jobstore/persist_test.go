@@ -0,0 +1,322 @@
+package jobstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/jamesprial/research-dashboard/internal/jobstore"
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// ---------------------------------------------------------------------------
+// FilePersister
+// ---------------------------------------------------------------------------
+
+func Test_FilePersister_Roundtrip(t *testing.T) {
+	p := jobstore.NewFilePersister(filepath.Join(t.TempDir(), "jobs"))
+
+	rec := jobstore.JobRecord{
+		ID:        "job-1",
+		Query:     "query",
+		Model:     "opus",
+		MaxTurns:  10,
+		CWD:       "/tmp",
+		Status:    model.StatusCompleted,
+		SessionID: "sess-1",
+		ResultInfo: model.ResultStats{
+			CostUSD: ptr(0.5),
+		},
+	}
+	if err := p.SaveJob(rec); err != nil {
+		t.Fatalf("SaveJob() error: %v", err)
+	}
+	for _, evt := range makeEvents(3, model.EventTypeAssistant, model.SubtypeText) {
+		if err := p.AppendEvent("job-1", evt); err != nil {
+			t.Fatalf("AppendEvent() error: %v", err)
+		}
+	}
+
+	jobs, err := p.LoadJobs()
+	if err != nil {
+		t.Fatalf("LoadJobs() error: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("len(LoadJobs()) = %d, want 1", len(jobs))
+	}
+	got := jobs[0]
+	if got.Record.ID != "job-1" || got.Record.SessionID != "sess-1" || got.Record.Status != model.StatusCompleted {
+		t.Errorf("Record = %+v, want id/session/status preserved", got.Record)
+	}
+	if got.Record.ResultInfo.CostUSD == nil || *got.Record.ResultInfo.CostUSD != 0.5 {
+		t.Errorf("ResultInfo.CostUSD = %v, want 0.5", got.Record.ResultInfo.CostUSD)
+	}
+	if len(got.Events) != 3 {
+		t.Fatalf("len(Events) = %d, want 3", len(got.Events))
+	}
+	for i, evt := range got.Events {
+		if evt.Index != i {
+			t.Errorf("Events[%d].Index = %d, want %d", i, evt.Index, i)
+		}
+	}
+}
+
+func Test_FilePersister_TornEventLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "jobs")
+	p := jobstore.NewFilePersister(dir)
+
+	if err := p.SaveJob(jobstore.JobRecord{ID: "torn", Status: model.StatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AppendEvent("torn", model.ParsedEvent{Index: 0, Type: model.EventTypeSystem}); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a crash in the middle of writing the second event.
+	f, err := os.OpenFile(filepath.Join(dir, "torn", "events.ndjson"), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"index":1,"type":"assis`)
+	_ = f.Close()
+
+	jobs, err := p.LoadJobs()
+	if err != nil {
+		t.Fatalf("LoadJobs() error: %v", err)
+	}
+	if len(jobs) != 1 || len(jobs[0].Events) != 1 {
+		t.Fatalf("LoadJobs() = %+v, want 1 job with 1 intact event", jobs)
+	}
+}
+
+func Test_FilePersister_EventsAfterTerminalSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "jobs")
+	p := jobstore.NewFilePersister(dir)
+	t.Cleanup(func() { _ = p.Close() })
+
+	if err := p.AppendEvent("job-1", model.ParsedEvent{Index: 0, Type: model.EventTypeSystem}); err != nil {
+		t.Fatal(err)
+	}
+	// Saving a terminal status closes the event log; a late event reopens it.
+	if err := p.SaveJob(jobstore.JobRecord{ID: "job-1", Status: model.StatusCancelled}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AppendEvent("job-1", model.ParsedEvent{Index: 1, Type: model.EventTypeStderr}); err != nil {
+		t.Fatalf("AppendEvent() after terminal save error: %v", err)
+	}
+
+	jobs, err := p.LoadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || len(jobs[0].Events) != 2 {
+		t.Fatalf("LoadJobs() = %+v, want 1 job with 2 events", jobs)
+	}
+
+	// The late event's handle is not kept open: once the log is removed,
+	// the next event starts a new one rather than writing to the old file.
+	if err := os.Remove(filepath.Join(dir, "job-1", "events.ndjson")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AppendEvent("job-1", model.ParsedEvent{Index: 2, Type: model.EventTypeStderr}); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err = p.LoadJobs(); err != nil || len(jobs) != 1 || len(jobs[0].Events) != 1 {
+		t.Fatalf("LoadJobs() = %+v, %v; want 1 job with the one event since the removal", jobs, err)
+	}
+}
+
+func Test_FilePersister_MissingDir_ReturnsNoJobs(t *testing.T) {
+	p := jobstore.NewFilePersister(filepath.Join(t.TempDir(), "does-not-exist"))
+	jobs, err := p.LoadJobs()
+	if err != nil {
+		t.Fatalf("LoadJobs() error: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("len(LoadJobs()) = %d, want 0", len(jobs))
+	}
+}
+
+func Test_FilePersister_RejectsPathLikeIDs(t *testing.T) {
+	p := jobstore.NewFilePersister(t.TempDir())
+	for _, id := range []string{"", "..", "a/b", `a\b`} {
+		if err := p.SaveJob(jobstore.JobRecord{ID: id}); err == nil {
+			t.Errorf("SaveJob(id=%q) error = nil, want error", id)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Store persistence
+// ---------------------------------------------------------------------------
+
+func Test_Store_Restore(t *testing.T) {
+	stateDir := filepath.Join(t.TempDir(), "jobs")
+	outputDir := filepath.Join(t.TempDir(), "research-restored")
+
+	// First process: one finished job and one still running.
+	s1 := jobstore.NewStore(jobstore.WithPersister(jobstore.NewFilePersister(stateDir)))
+	done := s1.Create("done-job", "finished query", "sonnet", 20, "/tmp")
+	done.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeSystem, Text: "init"})
+	done.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Text: "hi"})
+	done.SetSessionID("sess-done")
+	done.SetOutputDir(outputDir)
+	done.SetStatus(model.StatusCompleted)
+
+	runningDir := filepath.Join(t.TempDir(), "research-in-flight")
+	if err := os.Mkdir(runningDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	running := s1.Create("running-job", "in flight", "opus", 10, "/tmp")
+	running.SetOutputDir(runningDir)
+	running.TryStart()
+	running.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeSystem, Text: "init"})
+
+	// Second process rehydrates from disk.
+	s2 := jobstore.NewStore(jobstore.WithPersister(jobstore.NewFilePersister(stateDir)))
+	n, err := s2.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Restore() = %d, want 2", n)
+	}
+
+	j, ok := s2.Get("done-job")
+	if !ok {
+		t.Fatal("done-job not restored")
+	}
+	if j.Status() != model.StatusCompleted {
+		t.Errorf("done-job Status() = %q, want %q", j.Status(), model.StatusCompleted)
+	}
+	if j.EventCount() != 2 {
+		t.Errorf("done-job EventCount() = %d, want 2", j.EventCount())
+	}
+	if j.SessionID() != "sess-done" {
+		t.Errorf("done-job SessionID() = %q, want %q", j.SessionID(), "sess-done")
+	}
+	if s2.ClaimDir(outputDir) {
+		t.Error("ClaimDir(restored output dir) = true, want false (should be re-claimed)")
+	}
+
+	r, ok := s2.Get("running-job")
+	if !ok {
+		t.Fatal("running-job not restored")
+	}
+	if r.Status() != model.StatusFailed {
+		t.Errorf("running-job Status() = %q, want %q", r.Status(), model.StatusFailed)
+	}
+	if r.Error() == "" {
+		t.Error("running-job Error() is empty, want interruption message")
+	}
+	if r.ErrorKind() != model.ErrorKindInterrupted {
+		t.Errorf("running-job ErrorKind() = %q, want %q", r.ErrorKind(), model.ErrorKindInterrupted)
+	}
+	m, err := jobstore.ReadManifest(runningDir)
+	if err != nil || m.Status != model.StatusFailed || m.ErrorKind != model.ErrorKindInterrupted {
+		t.Errorf("running-job manifest = %+v, %v; want failed with %q", m.RunManifest, err, model.ErrorKindInterrupted)
+	}
+
+	// The interruption must itself be persisted.
+	s3 := jobstore.NewStore(jobstore.WithPersister(jobstore.NewFilePersister(stateDir)))
+	if _, err := s3.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if r3, _ := s3.Get("running-job"); r3 == nil || r3.Status() != model.StatusFailed {
+		t.Errorf("running-job not persisted as failed after restore")
+	}
+}
+
+// recordingPersister is an in-memory Persister that keeps every record
+// saved.
+type recordingPersister struct {
+	mu    sync.Mutex
+	saved []jobstore.JobRecord
+}
+
+func (p *recordingPersister) SaveJob(rec jobstore.JobRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.saved = append(p.saved, rec)
+	return nil
+}
+
+func (p *recordingPersister) AppendEvent(string, model.ParsedEvent) error { return nil }
+func (p *recordingPersister) DeleteJob(string) error                      { return nil }
+func (p *recordingPersister) LoadJobs() ([]jobstore.PersistedJob, error)  { return nil, nil }
+
+// records returns a copy of the records saved so far.
+func (p *recordingPersister) records() []jobstore.JobRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.saved)
+}
+
+func Test_Store_CoalescesSaves(t *testing.T) {
+	p := &recordingPersister{}
+	s := jobstore.NewStore(jobstore.WithPersister(p))
+	j := s.Create("busy", "query", "opus", 10, "/tmp")
+	j.TryStart()
+	for i := range 100 {
+		j.SetUsage(model.TokenUsage{OutputTokens: i + 1}, 0)
+	}
+
+	// Create and the status change are written at once; the usage updates
+	// wait for the interval to pass.
+	if n := len(p.records()); n != 2 {
+		t.Fatalf("SaveJob called %d times, want 2", n)
+	}
+
+	s.Flush()
+	recs := p.records()
+	if len(recs) != 3 {
+		t.Fatalf("SaveJob called %d times after Flush, want 3", len(recs))
+	}
+	if got := recs[2].Usage.OutputTokens; got != 100 {
+		t.Errorf("flushed OutputTokens = %d, want 100", got)
+	}
+
+	// A terminal status is written at once, without waiting.
+	j.SetStatus(model.StatusCompleted)
+	recs = p.records()
+	if len(recs) != 4 || recs[3].Status != model.StatusCompleted {
+		t.Errorf("last record = %+v, want the completed status written at once", recs[len(recs)-1])
+	}
+}
+
+func Test_Store_Delete_CancelsPendingSave(t *testing.T) {
+	p := &recordingPersister{}
+	s := jobstore.NewStore(jobstore.WithPersister(p))
+	j := s.Create("gone", "query", "opus", 10, "/tmp")
+	j.SetSessionID("sess")
+	s.Delete("gone")
+	s.Flush()
+	j.SetSessionID("sess-2")
+
+	if n := len(p.records()); n != 1 {
+		t.Errorf("SaveJob called %d times, want only the write on Create", n)
+	}
+}
+
+func Test_Store_Delete_RemovesPersistedState(t *testing.T) {
+	stateDir := filepath.Join(t.TempDir(), "jobs")
+	s := jobstore.NewStore(jobstore.WithPersister(jobstore.NewFilePersister(stateDir)))
+	_ = s.Create("gone", "query", "opus", 10, "/tmp")
+
+	if _, err := os.Stat(filepath.Join(stateDir, "gone")); err != nil {
+		t.Fatalf("persisted job dir missing after Create: %v", err)
+	}
+	s.Delete("gone")
+	if _, err := os.Stat(filepath.Join(stateDir, "gone")); !os.IsNotExist(err) {
+		t.Errorf("persisted job dir still present after Delete (err=%v)", err)
+	}
+}
+
+func Test_Store_Restore_NoPersister(t *testing.T) {
+	s := jobstore.NewStore()
+	n, err := s.Restore()
+	if err != nil || n != 0 {
+		t.Errorf("Restore() = (%d, %v), want (0, nil)", n, err)
+	}
+}
@@ -1,7 +1,10 @@
-// Package jobstore provides a thread-safe in-memory store for research jobs.
+// Package jobstore provides a thread-safe in-memory store for research jobs,
+// optionally backed by a Persister so jobs survive process restarts.
 package jobstore
 
 import (
+	"context"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
@@ -16,20 +19,163 @@ import (
 // Store
 // ---------------------------------------------------------------------------
 
+// interruptedError is recorded on jobs that were still pending or running
+// when the previous server process exited.
+const interruptedError = "interrupted: server restarted while the job was running"
+
+// saveInterval is the minimum spacing between writes of a job's metadata.
+// Changes arriving sooner are coalesced into one write at the end of the
+// interval, except for status changes, which are written at once.
+const saveInterval = time.Second
+
+// DefaultEventWindow is a suggested in-memory event window for
+// WithEventWindow: large enough to serve live streams from memory, small
+// enough to cap a long run's footprint.
+const DefaultEventWindow = 5000
+
 // Store is a thread-safe in-memory repository for Job instances.
 // It also tracks claimed output directories to prevent duplicate usage.
+// When configured with a Persister, every job mutation is written through,
+// metadata at most once per saveInterval, so that Restore can rebuild the
+// store after a restart.
 type Store struct {
 	mu          sync.RWMutex
 	jobs        map[string]*Job
 	claimedDirs map[string]struct{}
+	persister   Persister
+	changed     broadcast
+
+	// eventWindow, when positive, bounds the events each job keeps in
+	// memory; older events are spilled to segment files in spillDir.
+	eventWindow int
+	spillDir    string
+
+	pastRuns pastRunCache
 }
 
-// NewStore returns a Store with initialized internal maps.
-func NewStore() *Store {
-	return &Store{
+// Option configures optional Store behavior.
+type Option func(*Store)
+
+// WithPersister makes the store write job metadata and events through p.
+func WithPersister(p Persister) Option {
+	return func(s *Store) {
+		s.persister = p
+	}
+}
+
+// WithEventWindow bounds each job's in-memory event log to window events.
+// Older events are spilled to NDJSON segment files in dir and read back on
+// demand, so a long run does not hold its whole log in memory. Segment files
+// are removed when their job is deleted or expires. A non-positive window
+// keeps every event in memory, which is the default.
+func WithEventWindow(window int, dir string) Option {
+	return func(s *Store) {
+		s.eventWindow = window
+		s.spillDir = dir
+	}
+}
+
+// NewStore returns a Store with initialized internal maps and the given
+// options applied. Without options the store is purely in-memory.
+func NewStore(opts ...Option) *Store {
+	s := &Store{
 		jobs:        make(map[string]*Job),
 		claimedDirs: make(map[string]struct{}),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Restore rehydrates the store from its Persister and returns the number of
+// jobs loaded. Jobs that were pending, including those waiting to be
+// retried, or running when the previous process exited are marked failed
+// with ErrorKindInterrupted, since neither queues, retry timers nor
+// subprocesses survive a restart, and so is their entry in the manifest of
+// their output directory. Output directories of restored jobs are
+// re-claimed. Restore is a no-op for stores without a Persister.
+func (s *Store) Restore() (int, error) {
+	if s.persister == nil {
+		return 0, nil
+	}
+	persisted, err := s.persister.LoadJobs()
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, pj := range persisted {
+		rec := pj.Record
+		j := &Job{
+			id:         rec.ID,
+			query:      rec.Query,
+			model:      rec.Model,
+			maxTurns:   rec.MaxTurns,
+			cwd:        rec.CWD,
+			status:     rec.Status,
+			createdAt:  rec.CreatedAt,
+			events:     s.newEventLog(rec.ID),
+			outputDir:  rec.OutputDir,
+			errMsg:     rec.Error,
+			sessionID:  rec.SessionID,
+			resultInfo: rec.ResultInfo,
+			persister:  s.persister,
+
+			storeChanged: &s.changed,
+
+			parentID:        rec.ParentID,
+			resumeSessionID: rec.ResumeSessionID,
+
+			maxCostUSD: rec.MaxCostUSD,
+			maxTokens:  rec.MaxTokens,
+			usage:      rec.Usage,
+			costUSD:    rec.EstimatedCostUSD,
+			errorKind:  rec.ErrorKind,
+			timeout:    time.Duration(rec.TimeoutSeconds) * time.Second,
+			progress:   rec.Progress,
+
+			attempt:     max(rec.Attempt, 1),
+			retryPolicy: rec.Retry,
+		}
+		for _, evt := range pj.Events {
+			j.recordEventLocked(evt)
+		}
+
+		s.mu.Lock()
+		_, exists := s.jobs[rec.ID]
+		if !exists {
+			s.jobs[rec.ID] = j
+			if rec.OutputDir != "" {
+				s.claimedDirs[rec.OutputDir] = struct{}{}
+			}
+		}
+		s.mu.Unlock()
+		if exists {
+			j.closeEvents()
+			continue
+		}
+
+		if !rec.Status.IsTerminal() {
+			j.mu.Lock()
+			j.status = model.StatusFailed
+			j.errorKind = model.ErrorKindInterrupted
+			j.errMsg = interruptedError
+			j.mu.Unlock()
+			j.save()
+			if info, err := os.Stat(rec.OutputDir); err == nil && info.IsDir() {
+				if err := WriteManifest(rec.OutputDir, j.ManifestRun(time.Time{}, time.Now())); err != nil {
+					slog.Warn("jobstore: failed to write manifest", "job_id", rec.ID, "dir", rec.OutputDir, "err", err)
+				}
+			}
+			slog.Info("jobstore: marked interrupted job as failed", "job_id", rec.ID)
+		}
+		restored++
+	}
+	if restored > 0 {
+		s.changed.notify()
+	}
+	return restored, nil
 }
 
 // Create constructs a new Job with the given parameters, registers it in the
@@ -44,13 +190,19 @@ func (s *Store) Create(id, query, mdl string, maxTurns int, cwd string) *Job {
 		cwd:       cwd,
 		status:    model.StatusPending,
 		createdAt: time.Now().UTC(),
-		events:    []model.ParsedEvent{},
+		events:    s.newEventLog(id),
+		attempt:   1,
+		persister: s.persister,
+
+		storeChanged: &s.changed,
 	}
 
 	s.mu.Lock()
 	s.jobs[id] = j
 	s.mu.Unlock()
 
+	j.save()
+	s.changed.notify()
 	return j
 }
 
@@ -75,45 +227,147 @@ func (s *Store) List() []model.JobStatus {
 	return out
 }
 
-// Delete removes the job with the given id from the store.
-// If the id is not found the call is a no-op.
+// Delete removes the job with the given id from the store and its persisted
+// state. If the id is not found the call is a no-op.
 func (s *Store) Delete(id string) {
 	s.mu.Lock()
+	j, ok := s.jobs[id]
 	delete(s.jobs, id)
 	s.mu.Unlock()
+
+	if ok {
+		j.closeEvents()
+		j.stopSaving()
+		s.forget(id)
+		s.changed.notify()
+	}
 }
 
 // CleanupExpired removes completed, failed, or cancelled jobs whose age
 // exceeds maxAge. Running and pending jobs are never removed regardless of age.
 func (s *Store) CleanupExpired(maxAge time.Duration) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	var expired []*Job
 
+	s.mu.Lock()
 	for id, j := range s.jobs {
 		j.mu.RLock()
 		status := j.status
 		createdAt := j.createdAt
 		j.mu.RUnlock()
 
-		switch status {
-		case model.StatusCompleted, model.StatusFailed, model.StatusCancelled:
-			if time.Since(createdAt) > maxAge {
-				delete(s.jobs, id)
-			}
+		if status.IsTerminal() && time.Since(createdAt) > maxAge {
+			delete(s.jobs, id)
+			expired = append(expired, j)
 		}
 	}
+	s.mu.Unlock()
+
+	for _, j := range expired {
+		j.closeEvents()
+		j.stopSaving()
+		s.forget(j.id)
+	}
+	if len(expired) > 0 {
+		s.changed.notify()
+	}
+}
+
+// Flush writes the metadata of every job whose latest changes are still
+// waiting to be coalesced, e.g. before the process exits.
+func (s *Store) Flush() {
+	s.mu.RLock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.RUnlock()
+	for _, j := range jobs {
+		j.flush()
+	}
+}
+
+// Changed returns a channel that is closed the next time any job in the
+// store changes, or a job is added or removed. Like Job.Changed, each
+// channel fires at most once; obtain it before reading the state it guards.
+func (s *Store) Changed() <-chan struct{} {
+	return s.changed.wait()
+}
+
+// newEventLog returns an empty event log for the job with the given id,
+// bounded by the store's event window if one is configured.
+func (s *Store) newEventLog(id string) EventLog {
+	if s.eventWindow > 0 {
+		return newSpillLog(s.eventWindow, s.spillDir, id)
+	}
+	return &memoryLog{}
+}
+
+// forget deletes a job's persisted state, if the store has a Persister.
+func (s *Store) forget(id string) {
+	if s.persister == nil {
+		return
+	}
+	if err := s.persister.DeleteJob(id); err != nil {
+		slog.Warn("jobstore: failed to delete persisted job", "job_id", id, "err", err)
+	}
+}
+
+// FindJobs returns the page of jobs in the store selected by q, and the
+// number of jobs matching q's filters before paging. Jobs are ordered by
+// creation time and searched by query. next is the key to pass as q.After
+// for the following page, or nil if this page is the last.
+func (s *Store) FindJobs(q model.ListQuery) (jobs []model.JobStatus, total int, next *model.ListKey) {
+	var found []listEntry[model.JobStatus]
+	s.mu.RLock()
+	for _, j := range s.jobs {
+		j.mu.RLock()
+		if q.Match(j.status, model.ModelName(j.model), j.createdAt, j.query) {
+			found = append(found, listEntry[model.JobStatus]{
+				key:  model.ListKey{Time: j.createdAt, ID: j.id},
+				item: j.toStatusLocked(),
+			})
+		}
+		j.mu.RUnlock()
+	}
+	s.mu.RUnlock()
+	return page(found, q)
 }
 
 // PastRuns scans cwd for subdirectories whose names begin with "research-".
-// It returns a slice of model.PastRun entries sorted by name descending.
-// Files are ignored; only directories are considered.
+// It returns a slice of model.PastRun entries, newest first, described by
+// their names, manifests, reports and source indexes (see model.PastRun).
+// Descriptions are cached until the files they were read from change. Files
+// are ignored; only directories are considered.
 func (s *Store) PastRuns(cwd string) []model.PastRun {
+	runs, _, _ := s.FindPastRuns(cwd, model.ListQuery{})
+	return runs
+}
+
+// FindPastRuns is PastRuns with the page of runs selected by q, and the
+// number of runs matching q's filters before paging. Runs are ordered by
+// the time in their names (see describePastRun) and searched by query,
+// report title and directory name. Directories that belong to a job in the
+// store are left out, since the job itself is listed. next is the key to pass
+// as q.After for the following page, or nil if this page is the last.
+func (s *Store) FindPastRuns(cwd string, q model.ListQuery) (runs []model.PastRun, total int, next *model.ListKey) {
 	entries, err := os.ReadDir(cwd)
 	if err != nil {
-		return []model.PastRun{}
+		return []model.PastRun{}, 0, nil
 	}
 
-	var runs []model.PastRun
+	owned := make(map[string]bool)
+	s.mu.RLock()
+	for _, j := range s.jobs {
+		j.mu.RLock()
+		if j.outputDir != "" {
+			owned[j.outputDir] = true
+		}
+		j.mu.RUnlock()
+	}
+	s.mu.RUnlock()
+
+	var found []listEntry[model.PastRun]
+	seen := make(map[string]bool)
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -123,24 +377,49 @@ func (s *Store) PastRuns(cwd string) []model.PastRun {
 			continue
 		}
 		dir := filepath.Join(cwd, name)
-		_, err := os.Stat(filepath.Join(dir, "report.md"))
-		hasReport := err == nil
-
-		runs = append(runs, model.PastRun{
-			Dir:       dir,
-			Name:      name,
-			HasReport: hasReport,
-		})
+		seen[dir] = true
+		if owned[dir] {
+			continue
+		}
+		e := s.pastRuns.get(dir)
+		if q.Match(e.run.Status, e.run.Model, e.sortAt, e.run.Query, e.run.Title, e.run.Name) {
+			found = append(found, listEntry[model.PastRun]{
+				key:  model.ListKey{Time: e.sortAt, ID: name},
+				item: e.run,
+			})
+		}
 	}
+	s.pastRuns.prune(cwd, seen)
+	return page(found, q)
+}
 
-	sort.Slice(runs, func(i, j int) bool {
-		return runs[i].Name > runs[j].Name
-	})
+// listEntry is an item of a list together with its position in it.
+type listEntry[T any] struct {
+	key  model.ListKey
+	item T
+}
 
-	if runs == nil {
-		return []model.PastRun{}
+// page sorts found in q's order and returns the page of items selected by
+// q.After and q.Limit, the number of items found, and the key of the last
+// item in the page if more follow it.
+func page[T any](found []listEntry[T], q model.ListQuery) ([]T, int, *model.ListKey) {
+	sort.Slice(found, func(i, j int) bool { return q.Less(found[i].key, found[j].key) })
+	total := len(found)
+	if q.After != nil {
+		after := *q.After
+		found = found[sort.Search(len(found), func(i int) bool { return q.Less(after, found[i].key) }):]
 	}
-	return runs
+	var next *model.ListKey
+	if q.Limit > 0 && len(found) > q.Limit {
+		found = found[:q.Limit]
+		key := found[len(found)-1].key
+		next = &key
+	}
+	items := make([]T, len(found))
+	for i, e := range found {
+		items[i] = e.item
+	}
+	return items, total, next
 }
 
 // ClaimDir attempts to claim the given directory path. It returns true if the
@@ -164,14 +443,39 @@ func (s *Store) ReleaseDir(dir string) {
 	s.mu.Unlock()
 }
 
+// AssignOutputDir gives the job an output directory in its working
+// directory, named by model.OutputDirName, and claims it. A job that already
+// has an output directory keeps it. It returns the job's output directory.
+// The directory itself is not created.
+func (s *Store) AssignOutputDir(j *Job) string {
+	j.mu.Lock()
+	assigned := j.outputDir == ""
+	if assigned {
+		j.outputDir = filepath.Join(j.cwd, model.OutputDirName(j.query, j.createdAt, j.id))
+		j.notifyLocked()
+	}
+	dir := j.outputDir
+	j.mu.Unlock()
+
+	s.ClaimDir(dir)
+	if assigned {
+		j.save()
+	}
+	return dir
+}
+
 // ---------------------------------------------------------------------------
 // Job
 // ---------------------------------------------------------------------------
 
 // Job holds all state for a single research job. All field access is
-// protected by an internal read-write mutex.
+// protected by an internal read-write mutex. Writes to the persister are
+// additionally serialised by pmu so that on-disk state is applied in the same
+// order as in-memory state.
 type Job struct {
 	mu         sync.RWMutex
+	pmu        sync.Mutex
+	persister  Persister
 	id         string
 	query      string
 	model      string
@@ -179,11 +483,42 @@ type Job struct {
 	cwd        string
 	status     model.Status
 	createdAt  time.Time
-	events     []model.ParsedEvent
+	events     EventLog
+	numTurns   int
 	outputDir  string
 	errMsg     string
 	sessionID  string
 	resultInfo model.ResultStats
+	cancel     context.CancelFunc
+	queuePos   int
+
+	parentID        string
+	resumeSessionID string
+
+	maxCostUSD float64
+	maxTokens  int
+	usage      model.TokenUsage
+	costUSD    float64
+	errorKind  model.ErrorKind
+	timeout    time.Duration
+	progress   *model.Progress
+
+	attempt     int
+	retryPolicy model.RetryPolicy
+	retryAt     time.Time
+
+	// Persistence state, guarded by pmu: when and with which status the
+	// metadata was last written, the timer of a coalesced write, and
+	// whether the job was deleted and must no longer be written.
+	savedAt     time.Time
+	savedStatus model.Status
+	saveTimer   *time.Timer
+	forgotten   bool
+
+	// changed fires on every state change; see Changed. storeChanged is the
+	// owning store's broadcast, if any, and fires along with it.
+	changed      broadcast
+	storeChanged *broadcast
 }
 
 // ---------------------------------------------------------------------------
@@ -260,11 +595,104 @@ func (j *Job) ResultInfo() model.ResultStats {
 	return j.resultInfo
 }
 
+// ParentID returns the ID of the job this one follows up on, or an empty
+// string for an original research job.
+func (j *Job) ParentID() string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.parentID
+}
+
+// ResumeSessionID returns the agent session the runner should resume instead
+// of starting a fresh session, or an empty string.
+func (j *Job) ResumeSessionID() string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.resumeSessionID
+}
+
+// MaxCostUSD returns the job's estimated cost ceiling in USD, or 0 if the
+// cost is unlimited.
+func (j *Job) MaxCostUSD() float64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.maxCostUSD
+}
+
+// MaxTokens returns the job's total token ceiling, or 0 if unlimited.
+func (j *Job) MaxTokens() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.maxTokens
+}
+
+// Usage returns the cumulative token usage and estimated cost in USD
+// recorded so far.
+func (j *Job) Usage() (model.TokenUsage, float64) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.usage, j.costUSD
+}
+
+// Timeout returns the job's wall-clock run time limit, or 0 if unlimited.
+func (j *Job) Timeout() time.Duration {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.timeout
+}
+
+// Progress returns the job's inferred workflow progress, or nil if none has
+// been recorded.
+func (j *Job) Progress() *model.Progress {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.progress
+}
+
+// ErrorKind returns the classification of the job's failure, or an empty
+// string if none has been recorded.
+func (j *Job) ErrorKind() model.ErrorKind {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.errorKind
+}
+
+// Attempt returns the 1-based number of the job's current or last run.
+func (j *Job) Attempt() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.attempt
+}
+
+// RetryPolicy returns the policy that decides whether a failed run of the
+// job is retried.
+func (j *Job) RetryPolicy() model.RetryPolicy {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.retryPolicy
+}
+
+// RetryAt returns when a job waiting to be retried should run again, or the
+// zero time if it is not waiting.
+func (j *Job) RetryAt() time.Time {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.retryAt
+}
+
+// QueuePosition returns the job's 1-based position in the run queue, or 0 if
+// it is not waiting in the queue.
+func (j *Job) QueuePosition() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.queuePos
+}
+
 // EventCount returns the number of events recorded for this job.
 func (j *Job) EventCount() int {
 	j.mu.RLock()
 	defer j.mu.RUnlock()
-	return len(j.events)
+	return j.events.Len()
 }
 
 // ---------------------------------------------------------------------------
@@ -275,35 +703,240 @@ func (j *Job) EventCount() int {
 func (j *Job) SetStatus(s model.Status) {
 	j.mu.Lock()
 	j.status = s
+	j.notifyLocked()
 	j.mu.Unlock()
+	j.save()
 }
 
 // SetOutputDir sets the output directory path for the job.
 func (j *Job) SetOutputDir(dir string) {
 	j.mu.Lock()
 	j.outputDir = dir
+	j.notifyLocked()
 	j.mu.Unlock()
+	j.save()
 }
 
 // SetError records an error message on the job.
 func (j *Job) SetError(msg string) {
 	j.mu.Lock()
 	j.errMsg = msg
+	j.notifyLocked()
 	j.mu.Unlock()
+	j.save()
 }
 
 // SetSessionID records the agent session ID on the job.
 func (j *Job) SetSessionID(id string) {
 	j.mu.Lock()
 	j.sessionID = id
+	j.notifyLocked()
 	j.mu.Unlock()
+	j.save()
 }
 
 // SetResultInfo stores cost and performance statistics for the job.
 func (j *Job) SetResultInfo(info model.ResultStats) {
 	j.mu.Lock()
 	j.resultInfo = info
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetParentID links the job to the job it follows up on.
+func (j *Job) SetParentID(id string) {
+	j.mu.Lock()
+	j.parentID = id
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetResumeSessionID records the agent session the runner should resume.
+func (j *Job) SetResumeSessionID(id string) {
+	j.mu.Lock()
+	j.resumeSessionID = id
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetBudget sets the job's spending ceilings. Zero values mean unlimited.
+func (j *Job) SetBudget(maxCostUSD float64, maxTokens int) {
+	j.mu.Lock()
+	j.maxCostUSD = maxCostUSD
+	j.maxTokens = maxTokens
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetUsage records the cumulative token usage and estimated cost in USD.
+func (j *Job) SetUsage(usage model.TokenUsage, costUSD float64) {
+	j.mu.Lock()
+	j.usage = usage
+	j.costUSD = costUSD
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetTimeout sets the job's wall-clock run time limit. Zero means unlimited.
+func (j *Job) SetTimeout(d time.Duration) {
+	j.mu.Lock()
+	j.timeout = d
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetProgress records the job's inferred workflow progress. The value is
+// stored as given and must not be modified afterwards.
+func (j *Job) SetProgress(p model.Progress) {
+	j.mu.Lock()
+	j.progress = &p
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetErrorKind records the classification of the job's failure.
+func (j *Job) SetErrorKind(kind model.ErrorKind) {
+	j.mu.Lock()
+	j.errorKind = kind
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetRetryPolicy sets the policy that decides whether a failed run of the
+// job is retried.
+func (j *Job) SetRetryPolicy(p model.RetryPolicy) {
+	j.mu.Lock()
+	j.retryPolicy = p
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// ScheduleRetry returns a running job whose current attempt failed with kind
+// and msg to the pending state, to run its next attempt at time at. The
+// failure stays visible as the job's error until the retry starts. It
+// returns false without changing anything if the job is not running, e.g.
+// because it was cancelled.
+func (j *Job) ScheduleRetry(kind model.ErrorKind, msg string, at time.Time) bool {
+	j.mu.Lock()
+	if j.status != model.StatusRunning {
+		j.mu.Unlock()
+		return false
+	}
+	j.status = model.StatusPending
+	j.errorKind = kind
+	j.errMsg = msg
+	j.attempt++
+	j.retryAt = at
+	j.notifyLocked()
+	j.mu.Unlock()
+
+	j.save()
+	return true
+}
+
+// Fail marks the job as failed with the given kind and message in a single
+// change, so that subscribers never observe a failed job without its
+// classification.
+func (j *Job) Fail(kind model.ErrorKind, msg string) {
+	j.mu.Lock()
+	j.status = model.StatusFailed
+	j.errorKind = kind
+	j.errMsg = msg
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.save()
+}
+
+// SetQueuePosition records the job's 1-based position in the run queue; 0
+// means the job is not queued. The position is transient and not persisted.
+func (j *Job) SetQueuePosition(pos int) {
+	j.mu.Lock()
+	j.queuePos = pos
+	j.notifyLocked()
+	j.mu.Unlock()
+}
+
+// SetCancelFunc registers the function that aborts the job's execution
+// context. If the job was cancelled before the function was registered, it is
+// invoked immediately so that a late-starting runner still stops.
+func (j *Job) SetCancelFunc(cancel context.CancelFunc) {
+	j.mu.Lock()
+	j.cancel = cancel
+	cancelled := j.status == model.StatusCancelled
 	j.mu.Unlock()
+
+	if cancelled && cancel != nil {
+		cancel()
+	}
+}
+
+// TryStart transitions the job to running. It returns false without changing
+// the status if the job has already reached a terminal state, e.g. because it
+// was cancelled before the runner picked it up. Starting a retry clears the
+// error of the failed attempt.
+func (j *Job) TryStart() bool {
+	j.mu.Lock()
+	if j.status.IsTerminal() {
+		j.mu.Unlock()
+		return false
+	}
+	j.status = model.StatusRunning
+	if !j.retryAt.IsZero() {
+		j.retryAt = time.Time{}
+		j.errMsg = ""
+		j.errorKind = ""
+	}
+	j.notifyLocked()
+	j.mu.Unlock()
+
+	j.save()
+	return true
+}
+
+// Cancel marks the job as cancelled, with ErrorKindCancelled, records a
+// final "cancelled" system event, and invokes its registered cancel
+// function, if any, so that the underlying subprocess is terminated. The
+// event is appended together with the status change, so that subscribers
+// woken by the change see it before the job's end. Cancel returns false
+// without changing anything if the job has already reached a terminal state.
+func (j *Job) Cancel() bool {
+	j.pmu.Lock()
+	j.mu.Lock()
+	if j.status.IsTerminal() {
+		j.mu.Unlock()
+		j.pmu.Unlock()
+		return false
+	}
+	j.status = model.StatusCancelled
+	j.errorKind = model.ErrorKindCancelled
+	evt := model.ParsedEvent{
+		Index: j.events.Len(),
+		Type:  model.EventTypeSystem,
+		Text:  "cancelled",
+		Raw:   map[string]any{"type": "system", "subtype": "cancelled"},
+		Time:  time.Now(),
+	}
+	j.recordEventLocked(evt)
+	cancel := j.cancel
+	j.notifyLocked()
+	j.mu.Unlock()
+	j.persistEventLocked(evt)
+	j.pmu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	j.save()
+	return true
 }
 
 // SetCreatedAt overrides the job creation timestamp. Intended for use in
@@ -311,18 +944,78 @@ func (j *Job) SetResultInfo(info model.ResultStats) {
 func (j *Job) SetCreatedAt(t time.Time) {
 	j.mu.Lock()
 	j.createdAt = t
+	j.notifyLocked()
 	j.mu.Unlock()
+	j.save()
 }
 
 // ---------------------------------------------------------------------------
 // Event methods
 // ---------------------------------------------------------------------------
 
-// AddEvent appends a parsed event to the job's event log.
-func (j *Job) AddEvent(evt model.ParsedEvent) {
+// AddEvent appends a parsed event to the job's event log and, if the job is
+// persisted, to its on-disk event log, and returns the index it assigned.
+// The event's Index is set to its position in the log: the job is the only
+// source of event indexes, since it records events of its own, such as the
+// one added by Cancel, alongside those of the runner.
+func (j *Job) AddEvent(evt model.ParsedEvent) int {
+	j.pmu.Lock()
+	defer j.pmu.Unlock()
+
 	j.mu.Lock()
-	j.events = append(j.events, evt)
+	evt.Index = j.events.Len()
+	j.recordEventLocked(evt)
+	j.notifyLocked()
 	j.mu.Unlock()
+
+	j.persistEventLocked(evt)
+	return evt.Index
+}
+
+// persistEventLocked appends evt to the job's on-disk event log, if the job
+// is persisted. Failures are logged.
+// Caller must hold j.pmu.
+func (j *Job) persistEventLocked(evt model.ParsedEvent) {
+	if j.persister == nil || j.forgotten {
+		return
+	}
+	if err := j.persister.AppendEvent(j.id, evt); err != nil {
+		slog.Warn("jobstore: failed to persist event", "job_id", j.id, "index", evt.Index, "err", err)
+	}
+}
+
+// recordEventLocked appends evt to the event log and updates the running
+// turn count. A failure to spill older events is logged; the log keeps them
+// in memory instead.
+// Caller must hold j.mu for writing.
+func (j *Job) recordEventLocked(evt model.ParsedEvent) {
+	if err := j.events.Append(evt); err != nil {
+		slog.Warn("jobstore: failed to spill events", "job_id", j.id, "err", err)
+	}
+	if evt.Type == model.EventTypeAssistant && evt.Subtype == model.SubtypeText {
+		j.numTurns++
+	}
+}
+
+// eventsLocked returns a copy of the events in [start, end), reading spilled
+// events back from disk as needed. Read errors are logged and the events
+// read before the error are returned.
+// Caller must hold j.mu.
+func (j *Job) eventsLocked(start, end int) []model.ParsedEvent {
+	events, err := j.events.Range(start, end)
+	if err != nil {
+		slog.Warn("jobstore: failed to read spilled events", "job_id", j.id, "err", err)
+	}
+	return events
+}
+
+// closeEvents releases the event log, removing any spilled segment.
+func (j *Job) closeEvents() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.events.Close(); err != nil {
+		slog.Warn("jobstore: failed to remove spilled events", "job_id", j.id, "err", err)
+	}
 }
 
 // EventsSince returns a copy of the events slice starting at the given cursor
@@ -331,17 +1024,18 @@ func (j *Job) AddEvent(evt model.ParsedEvent) {
 func (j *Job) EventsSince(cursor int) []model.ParsedEvent {
 	j.mu.RLock()
 	defer j.mu.RUnlock()
+	return j.eventsLocked(cursor, j.events.Len())
+}
 
-	if cursor < 0 {
-		cursor = 0
-	}
-	if cursor >= len(j.events) {
-		return []model.ParsedEvent{}
+// Event returns the event at the given index and whether it exists.
+func (j *Job) Event(index int) (model.ParsedEvent, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	events := j.eventsLocked(index, index+1)
+	if index < 0 || len(events) == 0 {
+		return model.ParsedEvent{}, false
 	}
-	subset := j.events[cursor:]
-	out := make([]model.ParsedEvent, len(subset))
-	copy(out, subset)
-	return out
+	return events[0], true
 }
 
 // NumTurns counts events whose Type is assistant and Subtype is text.
@@ -351,20 +1045,137 @@ func (j *Job) NumTurns() int {
 	return j.numTurnsLocked()
 }
 
+// ---------------------------------------------------------------------------
+// Change notification
+// ---------------------------------------------------------------------------
+
+// Changed returns a channel that is closed the next time the job's state
+// changes: when an event is appended or its status, metadata or progress is
+// updated. Each channel fires at most once, so callers must call Changed
+// again after every wake-up. To avoid missing an update, obtain the channel
+// before reading the state it guards.
+func (j *Job) Changed() <-chan struct{} {
+	return j.changed.wait()
+}
+
+// notifyLocked wakes every goroutine waiting on a channel returned by
+// Changed, as well as waiters on the owning store. Callers invoke it while
+// holding j.mu for writing so that woken readers observe the change.
+func (j *Job) notifyLocked() {
+	j.changed.notify()
+	if j.storeChanged != nil {
+		j.storeChanged.notify()
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Persistence
+// ---------------------------------------------------------------------------
+
+// Record returns a snapshot of the job's metadata in its persisted form.
+func (j *Job) Record() JobRecord {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return JobRecord{
+		ID:         j.id,
+		Query:      j.query,
+		Model:      j.model,
+		MaxTurns:   j.maxTurns,
+		CWD:        j.cwd,
+		Status:     j.status,
+		CreatedAt:  j.createdAt,
+		OutputDir:  j.outputDir,
+		Error:      j.errMsg,
+		SessionID:  j.sessionID,
+		ResultInfo: j.resultInfo,
+
+		ParentID:        j.parentID,
+		ResumeSessionID: j.resumeSessionID,
+
+		MaxCostUSD:       j.maxCostUSD,
+		MaxTokens:        j.maxTokens,
+		Usage:            j.usage,
+		EstimatedCostUSD: j.costUSD,
+		ErrorKind:        j.errorKind,
+		TimeoutSeconds:   int(j.timeout / time.Second),
+		Progress:         j.progress,
+
+		Attempt: j.attempt,
+		Retry:   j.retryPolicy,
+	}
+}
+
+// save writes the job's current metadata through the persister, if any.
+// A change of status is written at once; other changes within saveInterval
+// of the last write are coalesced into one write at the end of the
+// interval, so that frequent updates such as usage and progress do not
+// rewrite the record each time. Failures are logged rather than returned:
+// persistence is best-effort and must never interrupt a running job.
+func (j *Job) save() {
+	if j.persister == nil {
+		return
+	}
+	j.pmu.Lock()
+	defer j.pmu.Unlock()
+
+	rec := j.Record()
+	if wait := saveInterval - time.Since(j.savedAt); rec.Status == j.savedStatus && wait > 0 {
+		if j.saveTimer == nil && !j.forgotten {
+			j.saveTimer = time.AfterFunc(wait, j.flush)
+		}
+		return
+	}
+	j.writeLocked(rec)
+}
+
+// flush writes the job's metadata if a coalesced write is pending.
+func (j *Job) flush() {
+	j.pmu.Lock()
+	defer j.pmu.Unlock()
+	if j.saveTimer != nil {
+		j.writeLocked(j.Record())
+	}
+}
+
+// stopSaving cancels any pending write and stops further writes of the
+// job's metadata, once its persisted state is deleted.
+func (j *Job) stopSaving() {
+	j.pmu.Lock()
+	defer j.pmu.Unlock()
+	if j.saveTimer != nil {
+		j.saveTimer.Stop()
+		j.saveTimer = nil
+	}
+	j.forgotten = true
+}
+
+// writeLocked writes rec through the persister, replacing any pending
+// coalesced write.
+// Caller must hold j.pmu.
+func (j *Job) writeLocked(rec JobRecord) {
+	if j.saveTimer != nil {
+		j.saveTimer.Stop()
+		j.saveTimer = nil
+	}
+	if j.forgotten {
+		return
+	}
+	j.savedAt = time.Now()
+	j.savedStatus = rec.Status
+	if err := j.persister.SaveJob(rec); err != nil {
+		slog.Warn("jobstore: failed to persist job", "job_id", j.id, "err", err)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Conversion methods
 // ---------------------------------------------------------------------------
 
-// numTurnsLocked counts events whose Type is assistant and Subtype is text.
+// numTurnsLocked returns the number of events whose Type is assistant and
+// Subtype is text, as counted by recordEventLocked.
 // Caller must hold j.mu.
 func (j *Job) numTurnsLocked() int {
-	count := 0
-	for _, evt := range j.events {
-		if evt.Type == model.EventTypeAssistant && evt.Subtype == model.SubtypeText {
-			count++
-		}
-	}
-	return count
+	return j.numTurns
 }
 
 // outputDirPtrLocked returns nil if j.outputDir is empty, otherwise returns a
@@ -378,21 +1189,55 @@ func (j *Job) outputDirPtrLocked() *string {
 	return &v
 }
 
+// parentIDPtrLocked returns nil if j.parentID is empty, otherwise returns a
+// pointer to a copy of the value.
+// Caller must hold j.mu.
+func (j *Job) parentIDPtrLocked() *string {
+	if j.parentID == "" {
+		return nil
+	}
+	v := j.parentID
+	return &v
+}
+
 // toStatusLocked builds and returns a model.JobStatus from the current job
 // state without acquiring the lock.
 // Caller must hold j.mu.
 func (j *Job) toStatusLocked() model.JobStatus {
 	return model.JobStatus{
-		ID:          j.id,
-		Query:       j.query,
-		Model:       model.ModelName(j.model),
-		Status:      j.status,
-		CreatedAt:   j.createdAt.Format(time.RFC3339),
-		OutputDir:   j.outputDirPtrLocked(),
-		OutputLines: len(j.events),
-		NumTurns:    j.numTurnsLocked(),
-		MaxTurns:    j.maxTurns,
+		ID:            j.id,
+		Query:         j.query,
+		Model:         model.ModelName(j.model),
+		Status:        j.status,
+		CreatedAt:     j.createdAt.Format(time.RFC3339),
+		OutputDir:     j.outputDirPtrLocked(),
+		OutputLines:   j.events.Len(),
+		NumTurns:      j.numTurnsLocked(),
+		MaxTurns:      j.maxTurns,
+		QueuePosition: j.queuePos,
+		ParentID:      j.parentIDPtrLocked(),
+		ErrorKind:     j.errorKind,
+
+		TotalTokens:      j.usage.Total(),
+		EstimatedCostUSD: j.costUSD,
+		MaxTokens:        j.maxTokens,
+		MaxCostUSD:       j.maxCostUSD,
+		TimeoutSeconds:   int(j.timeout / time.Second),
+		Progress:         j.progress,
+
+		Attempt:     j.attempt,
+		MaxAttempts: j.retryPolicy.MaxAttempts,
+		RetryAt:     formatRetryAt(j.retryAt),
+	}
+}
+
+// formatRetryAt formats a retry time as RFC 3339, or returns "" for the zero
+// time.
+func formatRetryAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	return t.UTC().Format(time.RFC3339)
 }
 
 // ToStatus returns a model.JobStatus snapshot of the current job state.
@@ -408,16 +1253,17 @@ func (j *Job) ToStatus() model.JobStatus {
 // SessionID and Error are represented as *string (nil when empty).
 // ResultInfo is a *model.ResultStats and is nil when the field is a zero value.
 func (j *Job) ToDetail() model.JobDetail {
+	return j.ToDetailPage(model.EventFilter{}, model.EventPage{})
+}
+
+// ToDetailPage is like ToDetail but includes only page p of the events
+// selected by f, trimmed as f specifies.
+func (j *Job) ToDetailPage(f model.EventFilter, p model.EventPage) model.JobDetail {
 	j.mu.RLock()
 	defer j.mu.RUnlock()
 
 	status := j.toStatusLocked()
-
-	// Convert events; always return a non-nil slice so JSON serializes as [].
-	events := make([]map[string]any, 0, len(j.events))
-	for _, evt := range j.events {
-		events = append(events, model.EventToDict(evt))
-	}
+	events, next := j.pageEventsLocked(f, p)
 
 	var sessionID *string
 	if j.sessionID != "" {
@@ -438,11 +1284,82 @@ func (j *Job) ToDetail() model.JobDetail {
 	}
 
 	return model.JobDetail{
-		JobStatus:  status,
-		Events:     events,
-		SessionID:  sessionID,
-		ResultInfo: resultInfo,
-		Error:      errPtr,
+		JobStatus:   status,
+		Events:      events,
+		EventsTotal: j.events.Len(),
+		NextOffset:  next,
+		SessionID:   sessionID,
+		ResultInfo:  resultInfo,
+		Error:       errPtr,
+	}
+}
+
+// pageChunk is the number of events read from the log at a time while
+// filling a page, bounding how much of a spilled log is held at once.
+const pageChunk = 512
+
+// pageEventsLocked returns the events of page p selected by f, converted
+// with f.Dict, and the offset of the following page. The offset is nil when
+// no events remain beyond the page. The returned slice is never nil so that
+// JSON serializes it as [].
+// Caller must hold j.mu.
+func (j *Job) pageEventsLocked(f model.EventFilter, p model.EventPage) ([]map[string]any, *int) {
+	total := j.events.Len()
+	matcher := f.Matcher()
+	events := []map[string]any{}
+	full := func() bool { return p.Limit > 0 && len(events) >= p.Limit }
+
+	if !p.Reverse {
+		start := max(p.Offset, 0)
+		if len(f.Tools) > 0 {
+			j.primeMatcherLocked(matcher, start)
+		}
+		for from := start; from < total; from += pageChunk {
+			for _, evt := range j.eventsLocked(from, from+pageChunk) {
+				if full() {
+					next := evt.Index
+					return events, &next
+				}
+				if matcher.Match(evt) {
+					events = append(events, f.Dict(evt))
+				}
+			}
+		}
+		return events, nil
+	}
+
+	end := total
+	if p.Offset > 0 {
+		end = min(p.Offset, total)
+	}
+	// A tool filter matches results by the IDs of earlier tool calls, so
+	// record every call up to the page before walking it backwards.
+	if len(f.Tools) > 0 {
+		j.primeMatcherLocked(matcher, end)
+	}
+	for to := end; to > 0; to -= pageChunk {
+		chunk := j.eventsLocked(to-pageChunk, to)
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if full() {
+				next := chunk[i].Index + 1
+				return events, &next
+			}
+			if matcher.Match(chunk[i]) {
+				events = append(events, f.Dict(chunk[i]))
+			}
+		}
+	}
+	return events, nil
+}
+
+// primeMatcherLocked feeds the events before index end to m so that it can
+// match later tool results to their calls.
+// Caller must hold j.mu.
+func (j *Job) primeMatcherLocked(m *model.EventMatcher, end int) {
+	for from := 0; from < end; from += pageChunk {
+		for _, evt := range j.eventsLocked(from, min(from+pageChunk, end)) {
+			m.Match(evt)
+		}
 	}
 }
 
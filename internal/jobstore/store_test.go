@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -201,6 +202,46 @@ func Test_Store_Delete(t *testing.T) {
 	})
 }
 
+// ---------------------------------------------------------------------------
+// Store.Changed
+// ---------------------------------------------------------------------------
+
+func Test_Store_Changed(t *testing.T) {
+	s := jobstore.NewStore()
+	fired := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	ch := s.Changed()
+	j := s.Create("a", "query", "opus", 10, "/tmp")
+	if !fired(ch) {
+		t.Error("Create did not fire Changed")
+	}
+
+	ch = s.Changed()
+	j.AddEvent(model.ParsedEvent{Type: model.EventTypeSystem})
+	if !fired(ch) {
+		t.Error("Job.AddEvent did not fire Store.Changed")
+	}
+
+	ch = s.Changed()
+	s.Delete("a")
+	if !fired(ch) {
+		t.Error("Delete did not fire Changed")
+	}
+
+	ch = s.Changed()
+	s.Delete("a")
+	if fired(ch) {
+		t.Error("Delete of a missing job fired Changed")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Store.CleanupExpired
 // ---------------------------------------------------------------------------
@@ -311,6 +352,41 @@ func Test_Store_PastRuns(t *testing.T) {
 		}
 	})
 
+	t.Run("research dir with manifest", func(t *testing.T) {
+		s := jobstore.NewStore()
+		dir := t.TempDir()
+		researchDir := filepath.Join(dir, "research-test-20240101")
+		if err := os.MkdirAll(researchDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		err := jobstore.WriteManifest(researchDir, model.RunManifest{
+			JobID:      "job-1",
+			Query:      "original query",
+			Model:      model.ModelHaiku,
+			Status:     model.StatusCompleted,
+			CreatedAt:  created,
+			StartedAt:  created,
+			FinishedAt: created.Add(90 * time.Second),
+			SessionID:  "sess-1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := s.PastRuns(dir)
+		if len(got) != 1 {
+			t.Fatalf("PastRuns() returned %d items, want 1", len(got))
+		}
+		run := got[0]
+		if run.JobID != "job-1" || run.Query != "original query" || run.Model != model.ModelHaiku || run.SessionID != "sess-1" {
+			t.Errorf("PastRun = %+v, want fields from the manifest", run)
+		}
+		if run.CreatedAt != "2024-01-01T12:00:00Z" || run.DurationMS != 90000 {
+			t.Errorf("CreatedAt = %q, DurationMS = %d, want 2024-01-01T12:00:00Z and 90000", run.CreatedAt, run.DurationMS)
+		}
+	})
+
 	t.Run("one research dir without report", func(t *testing.T) {
 		s := jobstore.NewStore()
 		dir := t.TempDir()
@@ -328,34 +404,39 @@ func Test_Store_PastRuns(t *testing.T) {
 		}
 	})
 
-	t.Run("multiple dirs sorted by name descending", func(t *testing.T) {
+	t.Run("multiple dirs sorted by date descending", func(t *testing.T) {
 		s := jobstore.NewStore()
 		dir := t.TempDir()
 		names := []string{
-			"research-aaa-20240101",
-			"research-ccc-20240103",
-			"research-bbb-20240102",
+			"research-zzz-20240101-120000",
+			"research-aaa-20240103-090000-abcd1234",
+			"research-undated",
+			"research-mmm-20240102-000000",
 		}
 		for _, name := range names {
 			if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
 				t.Fatal(err)
 			}
 		}
-
-		got := s.PastRuns(dir)
-		if len(got) != 3 {
-			t.Fatalf("PastRuns() returned %d items, want 3", len(got))
+		// Runs without a date in their name are dated by modification time.
+		old := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(filepath.Join(dir, "research-undated"), old, old); err != nil {
+			t.Fatal(err)
 		}
 
-		// Verify sorted descending by name.
+		got := s.PastRuns(dir)
 		gotNames := make([]string, len(got))
 		for i, pr := range got {
 			gotNames[i] = pr.Name
 		}
-		if !sort.SliceIsSorted(gotNames, func(i, j int) bool {
-			return gotNames[i] > gotNames[j]
-		}) {
-			t.Errorf("PastRuns() not sorted descending: %v", gotNames)
+		want := []string{
+			"research-aaa-20240103-090000-abcd1234",
+			"research-mmm-20240102-000000",
+			"research-zzz-20240101-120000",
+			"research-undated",
+		}
+		if !slices.Equal(gotNames, want) {
+			t.Errorf("PastRuns() = %v, want %v", gotNames, want)
 		}
 	})
 
@@ -387,6 +468,193 @@ func Test_Store_PastRuns(t *testing.T) {
 	})
 }
 
+// ---------------------------------------------------------------------------
+// Store.FindJobs and Store.FindPastRuns
+// ---------------------------------------------------------------------------
+
+func Test_Store_FindJobs(t *testing.T) {
+	s := jobstore.NewStore()
+	s.Create("j1", "solar power", "opus", 10, "/tmp").SetStatus(model.StatusRunning)
+	s.Create("j2", "wind power", "sonnet", 10, "/tmp")
+	s.Create("j3", "Tidal power", "opus", 10, "/tmp").SetStatus(model.StatusCompleted)
+
+	ids := func(jobs []model.JobStatus) []string {
+		var out []string
+		for _, j := range jobs {
+			out = append(out, j.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		q         model.ListQuery
+		want      []string
+		wantTotal int
+	}{
+		{"all jobs newest first", model.ListQuery{}, []string{"j3", "j2", "j1"}, 3},
+		{"oldest first", model.ListQuery{Ascending: true}, []string{"j1", "j2", "j3"}, 3},
+		{"by status", model.ListQuery{Statuses: []model.Status{model.StatusRunning, model.StatusPending}}, []string{"j2", "j1"}, 2},
+		{"by model", model.ListQuery{Models: []model.ModelName{model.ModelOpus}}, []string{"j3", "j1"}, 2},
+		{"by text ignoring case", model.ListQuery{Text: "TIDAL"}, []string{"j3"}, 1},
+		{"created in the future", model.ListQuery{Since: time.Now().Add(time.Hour)}, nil, 0},
+		{"limited", model.ListQuery{Limit: 2}, []string{"j3", "j2"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, total, _ := s.FindJobs(tt.q)
+			if got := ids(jobs); !slices.Equal(got, tt.want) {
+				t.Errorf("FindJobs() = %v, want %v", got, tt.want)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+// writePastRuns creates four past run directories in cwd, one month apart
+// from 2024-01-01, and returns their names oldest first: a completed opus
+// run, a failed sonnet run, a run with only a report and an empty one.
+func writePastRuns(t *testing.T, cwd string) []string {
+	t.Helper()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var names []string
+	for i, query := range []string{"solar power", "wind power", "tidal power", "geothermal"} {
+		created := start.AddDate(0, i, 0)
+		name := model.OutputDirName(query, created, fmt.Sprintf("job-%d", i))
+		dir := filepath.Join(cwd, name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+
+		run := model.RunManifest{JobID: fmt.Sprintf("job-%d", i), Query: query, CreatedAt: created}
+		switch i {
+		case 0:
+			run.Model, run.Status = model.ModelOpus, model.StatusCompleted
+		case 1:
+			run.Model, run.Status = model.ModelSonnet, model.StatusFailed
+		case 2:
+			writeFiles(t, dir, map[string]string{"report.md": "# Tidal Energy Outlook\n"})
+			continue
+		default:
+			continue
+		}
+		if err := jobstore.WriteManifest(dir, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return names
+}
+
+func Test_Store_FindPastRuns(t *testing.T) {
+	cwd := t.TempDir()
+	names := writePastRuns(t, cwd)
+	solar, wind, tidal, geo := names[0], names[1], names[2], names[3]
+
+	tests := []struct {
+		name string
+		q    model.ListQuery
+		want []string
+	}{
+		{"all runs newest first", model.ListQuery{}, []string{geo, tidal, wind, solar}},
+		{"oldest first", model.ListQuery{Ascending: true}, []string{solar, wind, tidal, geo}},
+		{"completed, with or without a manifest", model.ListQuery{Statuses: []model.Status{model.StatusCompleted}}, []string{tidal, solar}},
+		{"unknown, without a manifest or report", model.ListQuery{Statuses: []model.Status{model.StatusUnknown}}, []string{geo}},
+		{"by model", model.ListQuery{Models: []model.ModelName{model.ModelSonnet}}, []string{wind}},
+		{"by report title", model.ListQuery{Text: "energy outlook"}, []string{tidal}},
+		{"by query ignoring case", model.ListQuery{Text: "WIND"}, []string{wind}},
+		{"by directory name", model.ListQuery{Text: "geothermal"}, []string{geo}},
+		{
+			"by date range",
+			model.ListQuery{
+				Since: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+				Until: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			},
+			[]string{wind},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := jobstore.NewStore()
+			runs, total, next := s.FindPastRuns(cwd, tt.q)
+			var got []string
+			for _, r := range runs {
+				got = append(got, r.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindPastRuns() = %v, want %v", got, tt.want)
+			}
+			if total != len(tt.want) {
+				t.Errorf("total = %d, want %d", total, len(tt.want))
+			}
+			if next != nil {
+				t.Errorf("next = %+v, want nil", next)
+			}
+		})
+	}
+}
+
+func Test_Store_FindPastRuns_SkipsJobDirs(t *testing.T) {
+	cwd := t.TempDir()
+	names := writePastRuns(t, cwd)
+	s := jobstore.NewStore()
+	j := s.Create("job-3", "geothermal", "opus", 10, cwd)
+	j.SetOutputDir(filepath.Join(cwd, names[3]))
+
+	runs, total, _ := s.FindPastRuns(cwd, model.ListQuery{})
+	var got []string
+	for _, r := range runs {
+		got = append(got, r.Name)
+	}
+	if want := []string{names[2], names[1], names[0]}; !slices.Equal(got, want) {
+		t.Errorf("FindPastRuns() = %v, want %v", got, want)
+	}
+	if total != 3 {
+		t.Errorf("total = %d, want 3", total)
+	}
+
+	s.Delete("job-3")
+	if runs, _, _ := s.FindPastRuns(cwd, model.ListQuery{}); len(runs) != 4 {
+		t.Errorf("len(FindPastRuns()) = %d after the job was deleted, want 4", len(runs))
+	}
+}
+
+func Test_Store_FindPastRuns_Pages(t *testing.T) {
+	cwd := t.TempDir()
+	names := writePastRuns(t, cwd)
+	s := jobstore.NewStore()
+
+	for _, ascending := range []bool{false, true} {
+		want := slices.Clone(names)
+		if !ascending {
+			slices.Reverse(want)
+		}
+		q := model.ListQuery{Ascending: ascending, Limit: 3}
+		var got []string
+		for page := 0; ; page++ {
+			if page > len(names) {
+				t.Fatal("paging did not end")
+			}
+			runs, total, next := s.FindPastRuns(cwd, q)
+			if total != len(names) {
+				t.Errorf("page %d: total = %d, want %d", page, total, len(names))
+			}
+			for _, r := range runs {
+				got = append(got, r.Name)
+			}
+			if next == nil {
+				break
+			}
+			q.After = next
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("ascending=%v: pages = %v, want %v", ascending, got, want)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Job.AddEvent / Job.EventCount
 // ---------------------------------------------------------------------------
@@ -484,6 +752,88 @@ func Test_Job_EventsSince(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// WithEventWindow
+// ---------------------------------------------------------------------------
+
+func Test_Job_EventWindow_SpillsToDisk(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    int
+		numEvents int
+		cursor    int
+	}{
+		{name: "within window", window: 8, numEvents: 5, cursor: 0},
+		{name: "all events after spilling", window: 4, numEvents: 23, cursor: 0},
+		{name: "cursor inside segment", window: 4, numEvents: 23, cursor: 3},
+		{name: "cursor at segment boundary", window: 4, numEvents: 23, cursor: 20},
+		{name: "cursor inside window", window: 4, numEvents: 23, cursor: 22},
+		{name: "cursor past end", window: 4, numEvents: 23, cursor: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := jobstore.NewStore(jobstore.WithEventWindow(tt.window, dir))
+			j := s.Create("ew", "query", "opus", 10, "/tmp")
+			for _, evt := range makeEvents(tt.numEvents, model.EventTypeAssistant, model.SubtypeText) {
+				evt.ToolInput = map[string]any{"n": float64(evt.Index)}
+				j.AddEvent(evt)
+			}
+
+			got := j.EventsSince(tt.cursor)
+			if want := max(tt.numEvents-tt.cursor, 0); len(got) != want {
+				t.Fatalf("EventsSince(%d) returned %d events, want %d", tt.cursor, len(got), want)
+			}
+			for i, evt := range got {
+				if evt.Index != tt.cursor+i || evt.ToolInput["n"] != float64(tt.cursor+i) {
+					t.Fatalf("EventsSince(%d)[%d] = index %d, input %v; want %d", tt.cursor, i, evt.Index, evt.ToolInput, tt.cursor+i)
+				}
+			}
+
+			if j.EventCount() != tt.numEvents {
+				t.Errorf("EventCount() = %d, want %d", j.EventCount(), tt.numEvents)
+			}
+			if j.NumTurns() != tt.numEvents {
+				t.Errorf("NumTurns() = %d, want %d", j.NumTurns(), tt.numEvents)
+			}
+			if n := len(j.ToDetail().Events); n != tt.numEvents {
+				t.Errorf("ToDetail() returned %d events, want %d", n, tt.numEvents)
+			}
+			if evt, ok := j.Event(1); !ok || evt.Index != 1 {
+				t.Errorf("Event(1) = %d, %v; want index 1", evt.Index, ok)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spilled := tt.numEvents > tt.window; (len(entries) > 0) != spilled {
+				t.Errorf("spill dir has %d files, want spilled = %v", len(entries), spilled)
+			}
+		})
+	}
+}
+
+func Test_Store_Delete_RemovesSpilledEvents(t *testing.T) {
+	dir := t.TempDir()
+	s := jobstore.NewStore(jobstore.WithEventWindow(2, dir))
+	j := s.Create("spill-del", "query", "opus", 10, "/tmp")
+	for _, evt := range makeEvents(10, model.EventTypeAssistant, model.SubtypeText) {
+		j.AddEvent(evt)
+	}
+
+	s.Delete("spill-del")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("spill dir has %d files after Delete, want 0", len(entries))
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Job.SetStatus / Job.Status
 // ---------------------------------------------------------------------------
@@ -511,6 +861,209 @@ func Test_Job_SetStatus(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Job.Cancel / Job.SetCancelFunc / Job.TryStart
+// ---------------------------------------------------------------------------
+
+func Test_Job_Cancel(t *testing.T) {
+	t.Run("pending job is cancelled and cancel func invoked", func(t *testing.T) {
+		s := jobstore.NewStore()
+		j := s.Create("c-1", "query", "opus", 10, "/tmp")
+		called := false
+		j.SetCancelFunc(func() { called = true })
+
+		if !j.Cancel() {
+			t.Fatal("Cancel() = false, want true")
+		}
+		if j.Status() != model.StatusCancelled {
+			t.Errorf("Status() = %q, want %q", j.Status(), model.StatusCancelled)
+		}
+		if !called {
+			t.Error("cancel func was not invoked")
+		}
+		if j.ErrorKind() != model.ErrorKindCancelled {
+			t.Errorf("ErrorKind() = %q, want %q", j.ErrorKind(), model.ErrorKindCancelled)
+		}
+	})
+
+	t.Run("terminal job is left unchanged", func(t *testing.T) {
+		s := jobstore.NewStore()
+		j := s.Create("c-2", "query", "opus", 10, "/tmp")
+		j.SetStatus(model.StatusCompleted)
+		called := false
+		j.SetCancelFunc(func() { called = true })
+
+		if j.Cancel() {
+			t.Error("Cancel() = true, want false for completed job")
+		}
+		if j.Status() != model.StatusCompleted {
+			t.Errorf("Status() = %q, want %q", j.Status(), model.StatusCompleted)
+		}
+		if called {
+			t.Error("cancel func invoked for completed job")
+		}
+	})
+
+	t.Run("cancelled event is recorded with the status change", func(t *testing.T) {
+		s := jobstore.NewStore()
+		j := s.Create("c-4", "query", "opus", 10, "/tmp")
+		j.AddEvent(model.ParsedEvent{Type: model.EventTypeSystem, Text: "init"})
+		changed := j.Changed()
+		j.Cancel()
+
+		<-changed
+		events := j.EventsSince(0)
+		if len(events) != 2 {
+			t.Fatalf("len(events) = %d, want 2", len(events))
+		}
+		if last := events[1]; last.Index != 1 || last.Type != model.EventTypeSystem || last.Text != "cancelled" {
+			t.Errorf("last event = %+v, want system event %q at index 1", last, "cancelled")
+		}
+
+		// Events recorded afterwards, e.g. the subprocess's last output,
+		// keep indexes matching their positions.
+		if index := j.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeStderr}); index != 2 {
+			t.Errorf("AddEvent() = %d, want the assigned index 2", index)
+		}
+		if evt, ok := j.Event(2); !ok || evt.Index != 2 || evt.Type != model.EventTypeStderr {
+			t.Errorf("Event(2) = (%+v, %v), want the stderr event at index 2", evt, ok)
+		}
+	})
+
+	t.Run("cancel func registered after cancel is invoked immediately", func(t *testing.T) {
+		s := jobstore.NewStore()
+		j := s.Create("c-3", "query", "opus", 10, "/tmp")
+		j.Cancel()
+		called := false
+		j.SetCancelFunc(func() { called = true })
+		if !called {
+			t.Error("cancel func was not invoked on registration after Cancel()")
+		}
+	})
+}
+
+func Test_Job_TryStart(t *testing.T) {
+	tests := []struct {
+		name       string
+		initial    model.Status
+		wantOK     bool
+		wantStatus model.Status
+	}{
+		{"pending starts", model.StatusPending, true, model.StatusRunning},
+		{"cancelled stays cancelled", model.StatusCancelled, false, model.StatusCancelled},
+		{"failed stays failed", model.StatusFailed, false, model.StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := jobstore.NewStore()
+			j := s.Create("ts", "query", "opus", 10, "/tmp")
+			j.SetStatus(tt.initial)
+			if got := j.TryStart(); got != tt.wantOK {
+				t.Errorf("TryStart() = %v, want %v", got, tt.wantOK)
+			}
+			if j.Status() != tt.wantStatus {
+				t.Errorf("Status() = %q, want %q", j.Status(), tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_Job_ScheduleRetry(t *testing.T) {
+	s := jobstore.NewStore()
+	j := s.Create("rt", "query", "opus", 10, "/tmp")
+	at := time.Now().Add(time.Minute)
+
+	if j.ScheduleRetry(model.ErrorKindRateLimited, "rate limited", at) {
+		t.Fatal("ScheduleRetry() = true for a job that is not running, want false")
+	}
+	j.TryStart()
+	if !j.ScheduleRetry(model.ErrorKindRateLimited, "rate limited", at) {
+		t.Fatal("ScheduleRetry() = false, want true")
+	}
+	if j.Status() != model.StatusPending || j.Attempt() != 2 || !j.RetryAt().Equal(at) {
+		t.Errorf("Status() = %q, Attempt() = %d, RetryAt() = %v; want pending attempt 2 at %v",
+			j.Status(), j.Attempt(), j.RetryAt(), at)
+	}
+	status := j.ToStatus()
+	if status.Attempt != 2 || status.RetryAt == "" || status.ErrorKind != model.ErrorKindRateLimited {
+		t.Errorf("ToStatus() = %+v, want attempt 2, retry_at and error_kind set", status)
+	}
+
+	// Starting the next attempt clears the previous failure.
+	j.TryStart()
+	if !j.RetryAt().IsZero() || j.Error() != "" || j.ErrorKind() != "" {
+		t.Errorf("after TryStart: RetryAt() = %v, Error() = %q, ErrorKind() = %q; want all cleared",
+			j.RetryAt(), j.Error(), j.ErrorKind())
+	}
+	if j.Attempt() != 2 {
+		t.Errorf("after TryStart: Attempt() = %d, want 2", j.Attempt())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Job.Changed
+// ---------------------------------------------------------------------------
+
+func Test_Job_Changed(t *testing.T) {
+	fired := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(j *jobstore.Job)
+		want   bool
+	}{
+		{"AddEvent", func(j *jobstore.Job) { j.AddEvent(model.ParsedEvent{Type: model.EventTypeSystem}) }, true},
+		{"SetStatus", func(j *jobstore.Job) { j.SetStatus(model.StatusCompleted) }, true},
+		{"SetProgress", func(j *jobstore.Job) { j.SetProgress(model.Progress{Phase: model.PhaseSynthesis}) }, true},
+		{"Cancel", func(j *jobstore.Job) { j.Cancel() }, true},
+		{"read only", func(j *jobstore.Job) { _ = j.EventsSince(0); _ = j.ToStatus() }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := jobstore.NewStore()
+			j := s.Create("ch", "query", "opus", 10, "/tmp")
+			ch := j.Changed()
+			if fired(ch) {
+				t.Fatal("Changed() channel closed before any change")
+			}
+			tt.mutate(j)
+			if got := fired(ch); got != tt.want {
+				t.Errorf("channel closed = %v, want %v", got, tt.want)
+			}
+			if tt.want && fired(j.Changed()) {
+				t.Error("Changed() after wake-up returned an already-closed channel")
+			}
+		})
+	}
+
+	t.Run("wakes every subscriber", func(t *testing.T) {
+		s := jobstore.NewStore()
+		j := s.Create("ch-many", "query", "opus", 10, "/tmp")
+
+		var wg sync.WaitGroup
+		for range 5 {
+			ch := j.Changed()
+			wg.Go(func() { <-ch })
+		}
+		j.AddEvent(model.ParsedEvent{Type: model.EventTypeSystem})
+
+		done := make(chan struct{})
+		go func() { wg.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("not every subscriber was woken")
+		}
+	})
+}
+
 // ---------------------------------------------------------------------------
 // Job.SetOutputDir / Job.OutputDir
 // ---------------------------------------------------------------------------
@@ -761,6 +1314,60 @@ func Test_Job_ToDetail(t *testing.T) {
 	}
 }
 
+func Test_Job_ToDetailPage_WalksSpilledLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		reverse bool
+	}{
+		{"forward", false},
+		{"reverse", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := jobstore.NewStore(jobstore.WithEventWindow(100, t.TempDir()))
+			j := s.Create("page-spill", "query", "opus", 10, "/tmp")
+			const total = 1300
+			for _, evt := range makeEvents(total, model.EventTypeAssistant, model.SubtypeText) {
+				j.AddEvent(evt)
+			}
+
+			// Page through the whole log 300 events at a time.
+			var got []int
+			page := model.EventPage{Limit: 300, Reverse: tt.reverse}
+			for pages := 0; ; pages++ {
+				if pages > total/page.Limit+1 {
+					t.Fatal("pagination did not terminate")
+				}
+				detail := j.ToDetailPage(model.EventFilter{}, page)
+				if detail.EventsTotal != total {
+					t.Fatalf("EventsTotal = %d, want %d", detail.EventsTotal, total)
+				}
+				for _, evt := range detail.Events {
+					got = append(got, evt["index"].(int))
+				}
+				if detail.NextOffset == nil {
+					break
+				}
+				page.Offset = *detail.NextOffset
+			}
+
+			if len(got) != total {
+				t.Fatalf("collected %d events, want %d", len(got), total)
+			}
+			for i, idx := range got {
+				want := i
+				if tt.reverse {
+					want = total - 1 - i
+				}
+				if idx != want {
+					t.Fatalf("event %d has index %d, want %d", i, idx, want)
+				}
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Store.ClaimDir / Store.ReleaseDir
 // ---------------------------------------------------------------------------
@@ -793,6 +1400,44 @@ func Test_Store_ReleaseDir(t *testing.T) {
 	})
 }
 
+func Test_Store_AssignOutputDir(t *testing.T) {
+	t.Run("assigns and claims a dir named after the job", func(t *testing.T) {
+		s := jobstore.NewStore()
+		j := s.Create("f00dcafe-1234", "AI trends", "opus", 10, "/work")
+		dir := s.AssignOutputDir(j)
+		if filepath.Dir(dir) != "/work" {
+			t.Errorf("AssignOutputDir() = %q, want a dir in the job's cwd", dir)
+		}
+		name := filepath.Base(dir)
+		if !strings.HasPrefix(name, "research-ai-trends-") || !strings.HasSuffix(name, "-f00dcafe") {
+			t.Errorf("AssignOutputDir() = %q, want research-ai-trends-{timestamp}-f00dcafe", dir)
+		}
+		if j.OutputDir() != dir {
+			t.Errorf("OutputDir() = %q, want %q", j.OutputDir(), dir)
+		}
+		if s.ClaimDir(dir) {
+			t.Error("ClaimDir() = true, want the assigned dir to be claimed")
+		}
+	})
+
+	t.Run("is idempotent", func(t *testing.T) {
+		s := jobstore.NewStore()
+		j := s.Create("job-1", "query", "opus", 10, "/work")
+		if first, second := s.AssignOutputDir(j), s.AssignOutputDir(j); first != second {
+			t.Errorf("AssignOutputDir() = %q then %q, want the same dir", first, second)
+		}
+	})
+
+	t.Run("keeps an existing dir", func(t *testing.T) {
+		s := jobstore.NewStore()
+		j := s.Create("job-1", "query", "opus", 10, "/work")
+		j.SetOutputDir("/work/research-parent")
+		if dir := s.AssignOutputDir(j); dir != "/work/research-parent" {
+			t.Errorf("AssignOutputDir() = %q, want the existing dir", dir)
+		}
+	})
+}
+
 // ---------------------------------------------------------------------------
 // Concurrency Tests
 // ---------------------------------------------------------------------------
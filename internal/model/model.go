@@ -5,6 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 )
 
 // ---------------------------------------------------------------------------
@@ -20,8 +24,22 @@ const (
 	StatusCompleted Status = "completed"
 	StatusFailed    Status = "failed"
 	StatusCancelled Status = "cancelled"
+
+	// StatusUnknown is the status of a past run whose directory has neither
+	// a manifest nor a report. Jobs never have it.
+	StatusUnknown Status = "unknown"
 )
 
+// IsTerminal reports whether s is a final state from which a job never
+// transitions again (completed, failed, or cancelled).
+func (s Status) IsTerminal() bool {
+	switch s {
+	case StatusCompleted, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
 // EventType classifies the origin or role of a streaming event.
 type EventType string
 
@@ -31,6 +49,11 @@ const (
 	EventTypeUser      EventType = "user"
 	EventTypeResult    EventType = "result"
 	EventTypeRaw       EventType = "raw"
+	// EventTypeStderr carries one line the agent subprocess wrote to stderr.
+	EventTypeStderr EventType = "stderr"
+	// EventTypeFile reports a file written to the job's output directory
+	// while the job runs.
+	EventTypeFile EventType = "file"
 )
 
 // EventSubtype provides finer-grained classification within an EventType.
@@ -43,6 +66,10 @@ const (
 	SubtypeTextDelta  EventSubtype = "text_delta"
 	SubtypeToolStart  EventSubtype = "tool_start"
 	SubtypeEmpty      EventSubtype = ""
+
+	// SubtypeFileCreated and SubtypeFileUpdated qualify EventTypeFile events.
+	SubtypeFileCreated EventSubtype = "file_created"
+	SubtypeFileUpdated EventSubtype = "file_updated"
 )
 
 // ModelName identifies a supported Claude model tier.
@@ -63,9 +90,128 @@ const (
 	FileTypeOther FileType = "other"
 )
 
+// ErrorKind classifies why a job ended in the failed or cancelled state, so
+// that clients can react to deliberate stops, transient conditions and
+// subprocess errors differently.
+type ErrorKind string
+
+const (
+	// ErrorKindBudgetExceeded means the job was stopped because its token or
+	// estimated cost ceiling was crossed.
+	ErrorKindBudgetExceeded ErrorKind = "budget_exceeded"
+	// ErrorKindTimeout means the job was stopped because it ran longer than
+	// its wall-clock timeout.
+	ErrorKindTimeout ErrorKind = "timeout"
+	// ErrorKindCancelled means the job was cancelled by a client or by the
+	// server shutting down.
+	ErrorKindCancelled ErrorKind = "cancelled"
+	// ErrorKindAuthFailed means the claude CLI could not authenticate, e.g.
+	// because of a missing or invalid API key.
+	ErrorKindAuthFailed ErrorKind = "auth_failed"
+	// ErrorKindRateLimited means the API rejected the job's requests because
+	// of rate or usage limits, or was overloaded.
+	ErrorKindRateLimited ErrorKind = "rate_limited"
+	// ErrorKindNetwork means the claude CLI could not reach the API.
+	ErrorKindNetwork ErrorKind = "network_error"
+	// ErrorKindBinaryNotFound means the claude binary could not be started
+	// because it does not exist.
+	ErrorKindBinaryNotFound ErrorKind = "binary_not_found"
+	// ErrorKindMaxTurns means the agent used up its max_turns without
+	// producing a result.
+	ErrorKindMaxTurns ErrorKind = "max_turns"
+	// ErrorKindParseFailure means the subprocess output could not be read as
+	// stream-json.
+	ErrorKindParseFailure ErrorKind = "parse_failure"
+	// ErrorKindCrash means the subprocess exited unsuccessfully for any other
+	// reason, including being killed by a signal.
+	ErrorKindCrash ErrorKind = "crash"
+	// ErrorKindInterrupted means the job was still pending or running when
+	// the server stopped, so its run was lost.
+	ErrorKindInterrupted ErrorKind = "interrupted"
+)
+
 // ResearchDirPrefix is the required prefix for research output directory names.
 const ResearchDirPrefix = "research-"
 
+// Limits on the parts of an output directory name.
+const (
+	// maxSlugWords and maxSlugLen bound the slug derived from a query.
+	maxSlugWords = 6
+	maxSlugLen   = 48
+	// shortIDLen is how much of the job ID an output directory name keeps.
+	shortIDLen = 8
+)
+
+// OutputDirName returns the name of the output directory assigned to the job
+// with the given ID and query, created at t:
+// "research-{slug}-{YYYYMMDD-HHMMSS}-{id}", where slug is made of the first
+// words of the query and id is the start of the job ID. The job ID keeps
+// names unique across jobs with the same query and creation time.
+func OutputDirName(query string, t time.Time, jobID string) string {
+	return fmt.Sprintf("%s%s-%s-%s", ResearchDirPrefix, slugify(query, maxSlugWords, maxSlugLen),
+		t.UTC().Format(dirTimestampLayout), slugify(jobID, 1, shortIDLen))
+}
+
+// dirTimestampLayout is the layout of the timestamp in output directory names.
+const dirTimestampLayout = "20060102-150405"
+
+// ParseOutputDirName splits the name of a research output directory into the
+// topic slug, with its hyphens turned into spaces, and the time the run was
+// created. It accepts names made by OutputDirName, whose timestamps are UTC,
+// and the older "research-{slug}-{YYYYMMDD-HHMMSS}" names that agents chose
+// themselves, whose timestamps are read as local time. ok is false if name
+// has neither form; topic is then the name without its "research-" prefix.
+func ParseOutputDirName(name string) (topic string, created time.Time, ok bool) {
+	rest, found := strings.CutPrefix(name, ResearchDirPrefix)
+	if !found {
+		return name, time.Time{}, false
+	}
+	parts := strings.Split(rest, "-")
+	// {slug...}-{date}-{time}, optionally followed by -{id}.
+	for _, withID := range []bool{true, false} {
+		n := len(parts)
+		if withID {
+			n--
+		}
+		if n < 3 {
+			continue
+		}
+		loc := time.Local
+		if withID {
+			loc = time.UTC
+		}
+		t, err := time.ParseInLocation(dirTimestampLayout, parts[n-2]+"-"+parts[n-1], loc)
+		if err != nil {
+			continue
+		}
+		return strings.Join(parts[:n-2], " "), t, true
+	}
+	return rest, time.Time{}, false
+}
+
+// slugify lower-cases s and joins up to maxWords of its ASCII letter and
+// digit runs with hyphens, stopping before the slug would exceed maxLen; a
+// longer first run is cut. It returns "query" if s has no such runs.
+func slugify(s string, maxWords, maxLen int) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	var b strings.Builder
+	for i, word := range words {
+		if i == maxWords || (b.Len() > 0 && b.Len()+1+len(word) > maxLen) {
+			break
+		}
+		if b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteString(word)
+	}
+	if b.Len() == 0 {
+		return "query"
+	}
+	return b.String()[:min(b.Len(), maxLen)]
+}
+
 // ---------------------------------------------------------------------------
 // ValidModel
 // ---------------------------------------------------------------------------
@@ -96,6 +242,94 @@ type ParsedEvent struct {
 	ToolResult string         `json:"tool_result,omitempty"`
 	IsError    bool           `json:"is_error,omitempty"`
 	Raw        map[string]any `json:"raw,omitempty"`
+
+	// ToolUseID identifies the tool call a tool_use, tool_start, or
+	// tool_result event belongs to.
+	ToolUseID string `json:"tool_use_id,omitempty"`
+
+	// ParentToolUseID is set on events produced by a subagent to the ID of
+	// the Task (or Agent) tool call that spawned it.
+	ParentToolUseID string `json:"parent_tool_use_id,omitempty"`
+
+	// MessageID and MessageModel are set on every event parsed from an
+	// assistant message, and Usage on the first of them. The CLI repeats the
+	// same message (and usage) for each content block, so consumers summing
+	// usage must de-duplicate by MessageID.
+	MessageID    string      `json:"message_id,omitempty"`
+	MessageModel string      `json:"message_model,omitempty"`
+	Usage        *TokenUsage `json:"usage,omitempty"`
+
+	// Time is when the runner received the event. It is zero for events
+	// recorded before timestamps were introduced.
+	Time time.Time `json:"time,omitzero"`
+	// DurationMS is set on tool_result events to the time elapsed since the
+	// matching tool_use event was received.
+	DurationMS int64 `json:"duration_ms,omitempty"`
+}
+
+// ---------------------------------------------------------------------------
+// TokenUsage
+// ---------------------------------------------------------------------------
+
+// TokenUsage counts the tokens consumed by one or more model calls, mirroring
+// the usage block of the Anthropic Messages API.
+type TokenUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// Total returns the sum of all input, output, and cache tokens.
+func (u TokenUsage) Total() int {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// Add returns the element-wise sum of u and o.
+func (u TokenUsage) Add(o TokenUsage) TokenUsage {
+	return TokenUsage{
+		InputTokens:              u.InputTokens + o.InputTokens,
+		OutputTokens:             u.OutputTokens + o.OutputTokens,
+		CacheCreationInputTokens: u.CacheCreationInputTokens + o.CacheCreationInputTokens,
+		CacheReadInputTokens:     u.CacheReadInputTokens + o.CacheReadInputTokens,
+	}
+}
+
+// modelPrice holds list prices in USD per million tokens.
+type modelPrice struct {
+	input, output, cacheWrite, cacheRead float64
+}
+
+// modelPrices are the list prices used for live cost estimates. The CLI
+// reports the authoritative total only in its final result event.
+var modelPrices = map[ModelName]modelPrice{
+	ModelOpus:   {input: 15, output: 75, cacheWrite: 18.75, cacheRead: 1.50},
+	ModelSonnet: {input: 3, output: 15, cacheWrite: 3.75, cacheRead: 0.30},
+	ModelHaiku:  {input: 1, output: 5, cacheWrite: 1.25, cacheRead: 0.10},
+}
+
+// ModelTier maps a full model identifier such as "claude-sonnet-4-5" to its
+// tier, or returns an empty ModelName if the identifier is not recognised.
+func ModelTier(id string) ModelName {
+	for _, tier := range []ModelName{ModelOpus, ModelSonnet, ModelHaiku} {
+		if strings.Contains(id, string(tier)) {
+			return tier
+		}
+	}
+	return ""
+}
+
+// EstimateCostUSD returns the estimated cost in USD of usage on model m.
+// Unknown models are priced as opus so that budgets err on the safe side.
+func EstimateCostUSD(m ModelName, u TokenUsage) float64 {
+	p, ok := modelPrices[m]
+	if !ok {
+		p = modelPrices[ModelOpus]
+	}
+	return (float64(u.InputTokens)*p.input +
+		float64(u.OutputTokens)*p.output +
+		float64(u.CacheCreationInputTokens)*p.cacheWrite +
+		float64(u.CacheReadInputTokens)*p.cacheRead) / 1e6
 }
 
 // ---------------------------------------------------------------------------
@@ -122,6 +356,18 @@ type ResearchRequest struct {
 	Model    ModelName `json:"model"`
 	MaxTurns int       `json:"max_turns"`
 	CWD      *string   `json:"cwd,omitempty"`
+
+	// MaxCostUSD and MaxTokens are optional spending ceilings; zero means
+	// unlimited. The job is stopped once either is crossed.
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty"`
+	MaxTokens  int     `json:"max_tokens,omitempty"`
+
+	// TimeoutSeconds bounds the job's wall-clock run time. Zero selects the
+	// server default.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+
+	// Retry overrides fields of the server's retry policy for this job.
+	Retry *RetryPolicy `json:"retry,omitempty"`
 }
 
 // UnmarshalJSON applies default values before decoding the JSON payload so
@@ -147,8 +393,9 @@ func (r *ResearchRequest) UnmarshalJSON(data []byte) error {
 }
 
 // Validate returns an error if the request is not well-formed.
-// It checks that Query is non-empty, Model is a recognised value, and
-// MaxTurns is positive.
+// It checks that Query is non-empty, Model is a recognised value,
+// MaxTurns is positive, the optional budgets and timeout are not
+// negative, and the optional retry policy is valid.
 func (r ResearchRequest) Validate() error {
 	if r.Query == "" {
 		return errors.New("query is required")
@@ -159,37 +406,232 @@ func (r ResearchRequest) Validate() error {
 	if r.MaxTurns <= 0 {
 		return errors.New("max_turns must be positive")
 	}
+	if r.MaxCostUSD < 0 {
+		return errors.New("max_cost_usd must not be negative")
+	}
+	if r.MaxTokens < 0 {
+		return errors.New("max_tokens must not be negative")
+	}
+	if r.TimeoutSeconds < 0 {
+		return errors.New("timeout_seconds must not be negative")
+	}
+	if r.Retry != nil {
+		if err := r.Retry.Validate(); err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// FollowUpRequest
+// ---------------------------------------------------------------------------
+
+// FollowUpRequest is the input payload for continuing a finished research
+// session with a further question. Model and MaxTurns are optional; when
+// omitted the values of the parent job are used.
+type FollowUpRequest struct {
+	Query    string    `json:"query"`
+	Model    ModelName `json:"model,omitempty"`
+	MaxTurns int       `json:"max_turns,omitempty"`
+}
+
+// Validate returns an error if the request is not well-formed.
+// It checks that Query is non-empty, Model (if given) is a recognised value,
+// and MaxTurns is not negative.
+func (r FollowUpRequest) Validate() error {
+	if r.Query == "" {
+		return errors.New("query is required")
+	}
+	if r.Model != "" && !ValidModel(string(r.Model)) {
+		return fmt.Errorf("invalid model: %q", r.Model)
+	}
+	if r.MaxTurns < 0 {
+		return errors.New("max_turns must not be negative")
+	}
 	return nil
 }
 
+// ---------------------------------------------------------------------------
+// RetryPolicy
+// ---------------------------------------------------------------------------
+
+// MaxRetryAttempts is the largest MaxAttempts a RetryPolicy may set.
+const MaxRetryAttempts = 10
+
+// RetryableErrorKinds are the failure kinds a RetryPolicy may retry: the
+// transient ones, where running again can succeed.
+var RetryableErrorKinds = []ErrorKind{ErrorKindRateLimited, ErrorKindNetwork, ErrorKindCrash}
+
+// RetryPolicy controls how a job that fails with a transient error is run
+// again. Attempt n, counting from 1, is retried after BackoffSeconds doubled
+// n-1 times, capped at MaxBackoffSeconds, as long as n < MaxAttempts and the
+// failure's kind is listed in RetryOn. Zero fields inherit the server's
+// policy; see WithDefaults.
+type RetryPolicy struct {
+	MaxAttempts       int         `json:"max_attempts,omitempty"`
+	BackoffSeconds    int         `json:"backoff_seconds,omitempty"`
+	MaxBackoffSeconds int         `json:"max_backoff_seconds,omitempty"`
+	RetryOn           []ErrorKind `json:"retry_on,omitempty"`
+}
+
+// Validate returns an error if a field is out of range or RetryOn lists a
+// kind that is not in RetryableErrorKinds.
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return errors.New("max_attempts must not be negative")
+	}
+	if p.MaxAttempts > MaxRetryAttempts {
+		return fmt.Errorf("max_attempts must not exceed %d", MaxRetryAttempts)
+	}
+	if p.BackoffSeconds < 0 {
+		return errors.New("backoff_seconds must not be negative")
+	}
+	if p.MaxBackoffSeconds < 0 {
+		return errors.New("max_backoff_seconds must not be negative")
+	}
+	for _, kind := range p.RetryOn {
+		if !slices.Contains(RetryableErrorKinds, kind) {
+			return fmt.Errorf("retry_on: %q is not a retryable error kind", kind)
+		}
+	}
+	return nil
+}
+
+// WithDefaults returns p with its zero fields taken from d.
+func (p RetryPolicy) WithDefaults(d RetryPolicy) RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = d.MaxAttempts
+	}
+	if p.BackoffSeconds == 0 {
+		p.BackoffSeconds = d.BackoffSeconds
+	}
+	if p.MaxBackoffSeconds == 0 {
+		p.MaxBackoffSeconds = d.MaxBackoffSeconds
+	}
+	if p.RetryOn == nil {
+		p.RetryOn = d.RetryOn
+	}
+	return p
+}
+
+// Backoff reports whether a job whose attempt-th run failed with kind should
+// be retried, and after what delay.
+func (p RetryPolicy) Backoff(kind ErrorKind, attempt int) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || !slices.Contains(p.RetryOn, kind) {
+		return 0, false
+	}
+	delay := time.Duration(p.BackoffSeconds) * time.Second
+	limit := time.Duration(p.MaxBackoffSeconds) * time.Second
+	for range attempt - 1 {
+		if limit > 0 && delay >= limit {
+			break
+		}
+		delay *= 2
+	}
+	if limit > 0 {
+		delay = min(delay, limit)
+	}
+	return delay, true
+}
+
+// ---------------------------------------------------------------------------
+// Progress
+// ---------------------------------------------------------------------------
+
+// Phase is one step of the six-phase research workflow defined in the
+// orchestration prompt.
+type Phase string
+
+const (
+	PhaseDecomposition Phase = "decomposition"
+	PhaseBroadResearch Phase = "broad_research"
+	PhaseSynthesis     Phase = "synthesis"
+	PhaseFollowUp      Phase = "follow_up"
+	PhaseArchival      Phase = "archival"
+	PhaseReport        Phase = "report"
+)
+
+// Phases lists the workflow phases in order.
+var Phases = []Phase{
+	PhaseDecomposition,
+	PhaseBroadResearch,
+	PhaseSynthesis,
+	PhaseFollowUp,
+	PhaseArchival,
+	PhaseReport,
+}
+
+// PhaseTiming records when a job entered and left a phase. EndedAt and
+// DurationMS are nil while the phase is current.
+type PhaseTiming struct {
+	Phase      Phase   `json:"phase"`
+	StartedAt  string  `json:"started_at"`
+	EndedAt    *string `json:"ended_at,omitempty"`
+	DurationMS *int64  `json:"duration_ms,omitempty"`
+}
+
+// Progress reports the inferred position of a job in the research workflow.
+// Phases lists only the phases the job has entered; skipped phases (such as
+// an unneeded follow-up) are absent.
+type Progress struct {
+	Phase       Phase         `json:"phase"`
+	PhaseNumber int           `json:"phase_number"`
+	Percent     int           `json:"percent"`
+	Phases      []PhaseTiming `json:"phases"`
+}
+
 // ---------------------------------------------------------------------------
 // JobStatus
 // ---------------------------------------------------------------------------
 
 // JobStatus summarises the current state of a research job.
 type JobStatus struct {
-	ID          string    `json:"id"`
-	Query       string    `json:"query"`
-	Model       ModelName `json:"model"`
-	Status      Status    `json:"status"`
-	CreatedAt   string    `json:"created_at"`
-	OutputDir   *string   `json:"output_dir,omitempty"`
-	OutputLines int       `json:"output_lines"`
-	NumTurns    int       `json:"num_turns"`
-	MaxTurns    int       `json:"max_turns"`
+	ID            string    `json:"id"`
+	Query         string    `json:"query"`
+	Model         ModelName `json:"model"`
+	Status        Status    `json:"status"`
+	CreatedAt     string    `json:"created_at"`
+	OutputDir     *string   `json:"output_dir,omitempty"`
+	OutputLines   int       `json:"output_lines"`
+	NumTurns      int       `json:"num_turns"`
+	MaxTurns      int       `json:"max_turns"`
+	QueuePosition int       `json:"queue_position,omitempty"`
+	ParentID      *string   `json:"parent_id,omitempty"`
+	ErrorKind     ErrorKind `json:"error_kind,omitempty"`
+
+	TotalTokens      int     `json:"total_tokens,omitempty"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd,omitempty"`
+	MaxTokens        int     `json:"max_tokens,omitempty"`
+	MaxCostUSD       float64 `json:"max_cost_usd,omitempty"`
+	TimeoutSeconds   int     `json:"timeout_seconds,omitempty"`
+
+	// Attempt is the 1-based number of the job's current or last run, and
+	// MaxAttempts the number of runs its retry policy allows. RetryAt is
+	// set while a failed job waits to be retried.
+	Attempt     int    `json:"attempt,omitempty"`
+	MaxAttempts int    `json:"max_attempts,omitempty"`
+	RetryAt     string `json:"retry_at,omitempty"`
+
+	Progress *Progress `json:"progress,omitempty"`
 }
 
 // ---------------------------------------------------------------------------
 // JobDetail
 // ---------------------------------------------------------------------------
 
-// JobDetail extends JobStatus with the full event log and result metadata.
+// JobDetail extends JobStatus with a page of the event log and result
+// metadata. EventsTotal counts every event in the log, before filtering and
+// paging. NextOffset, when non-nil, is the offset of the next page in the
+// same order; it is nil once the log is exhausted.
 type JobDetail struct {
 	JobStatus
-	Events     []map[string]any `json:"events"`
-	SessionID  *string          `json:"session_id,omitempty"`
-	ResultInfo *ResultStats     `json:"result_info,omitempty"`
-	Error      *string          `json:"error,omitempty"`
+	Events      []map[string]any `json:"events"`
+	EventsTotal int              `json:"events_total"`
+	NextOffset  *int             `json:"next_offset,omitempty"`
+	SessionID   *string          `json:"session_id,omitempty"`
+	ResultInfo  *ResultStats     `json:"result_info,omitempty"`
+	Error       *string          `json:"error,omitempty"`
 }
 
 // MarshalJSON ensures that the Events slice serializes as [] rather than null
@@ -198,57 +640,511 @@ func (d JobDetail) MarshalJSON() ([]byte, error) {
 	// Use an alias to avoid infinite recursion.
 	type jobDetailAlias struct {
 		JobStatus
-		Events     []map[string]any `json:"events"`
-		SessionID  *string          `json:"session_id,omitempty"`
-		ResultInfo *ResultStats     `json:"result_info,omitempty"`
-		Error      *string          `json:"error,omitempty"`
+		Events      []map[string]any `json:"events"`
+		EventsTotal int              `json:"events_total"`
+		NextOffset  *int             `json:"next_offset,omitempty"`
+		SessionID   *string          `json:"session_id,omitempty"`
+		ResultInfo  *ResultStats     `json:"result_info,omitempty"`
+		Error       *string          `json:"error,omitempty"`
 	}
 
 	a := jobDetailAlias{
-		JobStatus:  d.JobStatus,
-		Events:     nilToEmpty(d.Events),
-		SessionID:  d.SessionID,
-		ResultInfo: d.ResultInfo,
-		Error:      d.Error,
+		JobStatus:   d.JobStatus,
+		Events:      nilToEmpty(d.Events),
+		EventsTotal: d.EventsTotal,
+		NextOffset:  d.NextOffset,
+		SessionID:   d.SessionID,
+		ResultInfo:  d.ResultInfo,
+		Error:       d.Error,
 	}
 	return json.Marshal(a)
 }
 
+// ---------------------------------------------------------------------------
+// ToolCall
+// ---------------------------------------------------------------------------
+
+// ToolCallStatus describes the outcome of a tool call.
+type ToolCallStatus string
+
+const (
+	ToolCallPending   ToolCallStatus = "pending"
+	ToolCallCompleted ToolCallStatus = "completed"
+	ToolCallError     ToolCallStatus = "error"
+)
+
+// toolResultPreviewLen is the maximum number of characters of a tool result
+// included in a ToolCall.
+const toolResultPreviewLen = 200
+
+// ToolCall pairs a tool_use event with its tool_result event.
+type ToolCall struct {
+	ToolUseID     string         `json:"tool_use_id,omitempty"`
+	ToolName      string         `json:"tool_name"`
+	ToolInput     map[string]any `json:"tool_input,omitempty"`
+	Status        ToolCallStatus `json:"status"`
+	IsError       bool           `json:"is_error"`
+	UseIndex      int            `json:"use_index"`
+	ResultIndex   *int           `json:"result_index,omitempty"`
+	StartedAt     *string        `json:"started_at,omitempty"`
+	FinishedAt    *string        `json:"finished_at,omitempty"`
+	DurationMS    *int64         `json:"duration_ms,omitempty"`
+	ResultPreview string         `json:"result_preview,omitempty"`
+}
+
+// ToolCallList is the response for listing a job's tool calls.
+type ToolCallList struct {
+	Tools []ToolCall `json:"tools"`
+}
+
+// MarshalJSON ensures Tools serializes as [] rather than null when nil or
+// empty.
+func (l ToolCallList) MarshalJSON() ([]byte, error) {
+	type toolCallListAlias struct {
+		Tools []ToolCall `json:"tools"`
+	}
+	return json.Marshal(toolCallListAlias{Tools: nilToEmpty(l.Tools)})
+}
+
+// PairToolCalls matches the tool_use and tool_result events in events and
+// returns one ToolCall per tool_use, in call order. Results are matched by
+// ToolUseID; events without an ID fall back to pairing with the oldest
+// unmatched call that also lacks one. Calls without a result are pending.
+// Unmatched results are ignored.
+func PairToolCalls(events []ParsedEvent) []ToolCall {
+	var calls []ToolCall
+	byID := make(map[string]int)
+	var anonymous []int
+
+	for _, evt := range events {
+		switch {
+		case evt.Type == EventTypeAssistant && evt.Subtype == SubtypeToolUse:
+			calls = append(calls, ToolCall{
+				ToolUseID: evt.ToolUseID,
+				ToolName:  evt.ToolName,
+				ToolInput: evt.ToolInput,
+				Status:    ToolCallPending,
+				UseIndex:  evt.Index,
+				StartedAt: formatEventTime(evt.Time),
+			})
+			if evt.ToolUseID != "" {
+				byID[evt.ToolUseID] = len(calls) - 1
+			} else {
+				anonymous = append(anonymous, len(calls)-1)
+			}
+
+		case evt.Type == EventTypeUser && evt.Subtype == SubtypeToolResult:
+			i := -1
+			if evt.ToolUseID != "" {
+				if j, ok := byID[evt.ToolUseID]; ok {
+					i = j
+					delete(byID, evt.ToolUseID)
+				}
+			} else if len(anonymous) > 0 {
+				i = anonymous[0]
+				anonymous = anonymous[1:]
+			}
+			if i < 0 {
+				continue
+			}
+			c := &calls[i]
+			idx := evt.Index
+			c.ResultIndex = &idx
+			c.IsError = evt.IsError
+			c.Status = ToolCallCompleted
+			if evt.IsError {
+				c.Status = ToolCallError
+			}
+			c.FinishedAt = formatEventTime(evt.Time)
+			if evt.DurationMS > 0 {
+				d := evt.DurationMS
+				c.DurationMS = &d
+			}
+			c.ResultPreview = truncateRunes(evt.ToolResult, toolResultPreviewLen)
+		}
+	}
+	return calls
+}
+
+// formatEventTime returns t as an RFC 3339 string, or nil if t is zero.
+func formatEventTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339Nano)
+	return &s
+}
+
+// truncateRunes returns s cut to at most n runes.
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// ---------------------------------------------------------------------------
+// Subagent
+// ---------------------------------------------------------------------------
+
+// SubagentStatus describes the lifecycle of a subagent.
+type SubagentStatus string
+
+const (
+	SubagentRunning   SubagentStatus = "running"
+	SubagentCompleted SubagentStatus = "completed"
+	SubagentFailed    SubagentStatus = "failed"
+)
+
+// subagentToolNames are the tool names the CLI uses to spawn subagents. Older
+// CLI versions call the tool "Task", newer ones "Agent".
+var subagentToolNames = map[string]bool{"Task": true, "Agent": true}
+
+// Subagent summarizes the activity of one subagent spawned by a Task (or
+// Agent) tool call, built from the events tagged with that call's ID.
+type Subagent struct {
+	ToolUseID        string         `json:"tool_use_id"`
+	ParentToolUseID  string         `json:"parent_tool_use_id,omitempty"`
+	AgentType        string         `json:"agent_type"`
+	Description      string         `json:"description,omitempty"`
+	Status           SubagentStatus `json:"status"`
+	Turns            int            `json:"turns"`
+	ToolCalls        int            `json:"tool_calls"`
+	EventCount       int            `json:"event_count"`
+	Usage            TokenUsage     `json:"usage"`
+	EstimatedCostUSD float64        `json:"estimated_cost_usd"`
+	StartedAt        *string        `json:"started_at,omitempty"`
+	LastActivityAt   *string        `json:"last_activity_at,omitempty"`
+	FinishedAt       *string        `json:"finished_at,omitempty"`
+	DurationMS       *int64         `json:"duration_ms,omitempty"`
+}
+
+// SubagentList is the response for listing a job's subagents.
+type SubagentList struct {
+	Agents []Subagent `json:"agents"`
+}
+
+// MarshalJSON ensures Agents serializes as [] rather than null when nil or
+// empty.
+func (l SubagentList) MarshalJSON() ([]byte, error) {
+	type subagentListAlias struct {
+		Agents []Subagent `json:"agents"`
+	}
+	return json.Marshal(subagentListAlias{Agents: nilToEmpty(l.Agents)})
+}
+
+// subagentMessage is the latest usage reported for one assistant message.
+type subagentMessage struct {
+	usage TokenUsage
+	tier  ModelName
+}
+
+// BuildSubagents groups events under the Task or Agent tool call that spawned
+// them and returns one Subagent per call, in call order. Calls without a
+// tool_use ID cannot be correlated and are skipped. Usage is de-duplicated by
+// message ID and priced by the message's model tier, falling back to
+// fallback when the message does not name a known model.
+func BuildSubagents(events []ParsedEvent, fallback ModelName) []Subagent {
+	var agents []Subagent
+	byID := make(map[string]int)
+	messages := make(map[string]map[string]subagentMessage)
+
+	for _, evt := range events {
+		if evt.Type == EventTypeAssistant && evt.Subtype == SubtypeToolUse &&
+			subagentToolNames[evt.ToolName] && evt.ToolUseID != "" {
+			agentType, _ := evt.ToolInput["subagent_type"].(string)
+			description, _ := evt.ToolInput["description"].(string)
+			agents = append(agents, Subagent{
+				ToolUseID:       evt.ToolUseID,
+				ParentToolUseID: evt.ParentToolUseID,
+				AgentType:       agentType,
+				Description:     description,
+				Status:          SubagentRunning,
+				StartedAt:       formatEventTime(evt.Time),
+			})
+			byID[evt.ToolUseID] = len(agents) - 1
+			messages[evt.ToolUseID] = make(map[string]subagentMessage)
+		}
+
+		// The Task tool's result marks the end of the subagent.
+		if evt.Type == EventTypeUser && evt.Subtype == SubtypeToolResult {
+			if i, ok := byID[evt.ToolUseID]; ok && evt.ToolUseID != "" {
+				a := &agents[i]
+				a.Status = SubagentCompleted
+				if evt.IsError {
+					a.Status = SubagentFailed
+				}
+				a.FinishedAt = formatEventTime(evt.Time)
+				if evt.DurationMS > 0 {
+					d := evt.DurationMS
+					a.DurationMS = &d
+				}
+			}
+		}
+
+		i, ok := byID[evt.ParentToolUseID]
+		if !ok || evt.ParentToolUseID == "" {
+			continue
+		}
+		a := &agents[i]
+		a.EventCount++
+		if ts := formatEventTime(evt.Time); ts != nil {
+			a.LastActivityAt = ts
+		}
+		if evt.Type != EventTypeAssistant {
+			continue
+		}
+		if evt.Subtype == SubtypeToolUse {
+			a.ToolCalls++
+		}
+		msgs := messages[evt.ParentToolUseID]
+		switch {
+		case evt.MessageID != "":
+			prev, seen := msgs[evt.MessageID]
+			if !seen {
+				a.Turns++
+			}
+			if evt.Usage != nil {
+				tier := ModelTier(evt.MessageModel)
+				if tier == "" {
+					tier = prev.tier
+				}
+				msgs[evt.MessageID] = subagentMessage{usage: *evt.Usage, tier: tier}
+			} else if !seen {
+				msgs[evt.MessageID] = subagentMessage{}
+			}
+		case evt.Subtype == SubtypeText:
+			a.Turns++
+		}
+	}
+
+	for i := range agents {
+		a := &agents[i]
+		for _, m := range messages[a.ToolUseID] {
+			tier := m.tier
+			if tier == "" {
+				tier = fallback
+			}
+			a.Usage = a.Usage.Add(m.usage)
+			a.EstimatedCostUSD += EstimateCostUSD(tier, m.usage)
+		}
+	}
+	return agents
+}
+
 // ---------------------------------------------------------------------------
 // PastRun
 // ---------------------------------------------------------------------------
 
 // PastRun describes a completed research run stored on disk.
+//
+// Topic and Timestamp are parsed from the directory name (see
+// ParseOutputDirName); Timestamp is empty if the name has none. Title,
+// WordCount and, for runs without a manifest, Query are read from the
+// report. SourceCount and ArchiveSuccessRate, the fraction of sources
+// archived, come from the source index; without one SourceCount counts the
+// archived source files and ArchiveSuccessRate is nil. TotalSize is the size
+// of all the directory's files in bytes.
+//
+// The fields from JobID on are read from the directory's manifest (see
+// Manifest) and describe the job that created it; they are empty for
+// directories without one.
 type PastRun struct {
 	Dir       string `json:"dir"`
 	Name      string `json:"name"`
 	HasReport bool   `json:"has_report"`
+
+	Topic              string   `json:"topic"`
+	Timestamp          string   `json:"timestamp,omitempty"`
+	Title              string   `json:"title,omitempty"`
+	WordCount          int      `json:"word_count,omitempty"`
+	SourceCount        int      `json:"source_count,omitempty"`
+	ArchiveSuccessRate *float64 `json:"archive_success_rate,omitempty"`
+	TotalSize          int64    `json:"total_size"`
+
+	JobID      string        `json:"job_id,omitempty"`
+	Query      string        `json:"query,omitempty"`
+	Model      ModelName     `json:"model,omitempty"`
+	MaxTurns   int           `json:"max_turns,omitempty"`
+	Status     Status        `json:"status,omitempty"`
+	ErrorKind  ErrorKind     `json:"error_kind,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  string        `json:"created_at,omitempty"`
+	FinishedAt string        `json:"finished_at,omitempty"`
+	DurationMS int64         `json:"duration_ms,omitempty"`
+	SessionID  string        `json:"session_id,omitempty"`
+	ResultInfo *ResultStats  `json:"result_info,omitempty"`
+	FollowUps  []RunManifest `json:"follow_ups,omitempty"`
+}
+
+// ---------------------------------------------------------------------------
+// Manifest
+// ---------------------------------------------------------------------------
+
+// ManifestFileName is the name of the manifest the runner writes into each
+// research output directory.
+const ManifestFileName = "research.json"
+
+// Manifest is the content of a research output directory's manifest file.
+// It describes the job that created the directory and, in FollowUps, the
+// follow-up jobs that continued it, oldest first.
+type Manifest struct {
+	RunManifest
+	FollowUps []RunManifest `json:"follow_ups,omitempty"`
+}
+
+// RunManifest records how one job that wrote to a research output directory
+// ended.
+type RunManifest struct {
+	JobID      string       `json:"job_id"`
+	ParentID   string       `json:"parent_id,omitempty"`
+	Query      string       `json:"query"`
+	Model      ModelName    `json:"model"`
+	MaxTurns   int          `json:"max_turns"`
+	Status     Status       `json:"status"`
+	ErrorKind  ErrorKind    `json:"error_kind,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	StartedAt  time.Time    `json:"started_at,omitzero"`
+	FinishedAt time.Time    `json:"finished_at,omitzero"`
+	SessionID  string       `json:"session_id,omitempty"`
+	ResultInfo *ResultStats `json:"result_info,omitempty"`
+}
+
+// Fill copies the manifest's description of the job that created a research
+// output directory into run, the past run for that directory.
+func (m Manifest) Fill(run *PastRun) {
+	run.JobID = m.JobID
+	run.Query = m.Query
+	run.Model = m.Model
+	run.MaxTurns = m.MaxTurns
+	run.Status = m.Status
+	run.ErrorKind = m.ErrorKind
+	run.Error = m.Error
+	run.SessionID = m.SessionID
+	run.ResultInfo = m.ResultInfo
+	run.FollowUps = m.FollowUps
+	if !m.CreatedAt.IsZero() {
+		run.CreatedAt = m.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if !m.FinishedAt.IsZero() {
+		run.FinishedAt = m.FinishedAt.UTC().Format(time.RFC3339)
+	}
+	if !m.StartedAt.IsZero() && m.FinishedAt.After(m.StartedAt) {
+		run.DurationMS = m.FinishedAt.Sub(m.StartedAt).Milliseconds()
+	}
 }
 
 // ---------------------------------------------------------------------------
 // JobList
 // ---------------------------------------------------------------------------
 
-// JobList is the top-level response for listing jobs.
+// JobList is the top-level response for listing jobs. ActiveTotal and
+// PastTotal count the jobs and past runs matching the list query, before
+// paging. NextCursor, when set, fetches the next page of either list.
 type JobList struct {
-	Active []JobStatus `json:"active"`
-	Past   []PastRun   `json:"past"`
+	Active      []JobStatus `json:"active"`
+	Past        []PastRun   `json:"past"`
+	ActiveTotal int         `json:"active_total"`
+	PastTotal   int         `json:"past_total"`
+	NextCursor  string      `json:"next_cursor,omitempty"`
 }
 
 // MarshalJSON ensures Active and Past serialize as [] rather than null when
 // nil or empty.
 func (jl JobList) MarshalJSON() ([]byte, error) {
 	type jobListAlias struct {
-		Active []JobStatus `json:"active"`
-		Past   []PastRun   `json:"past"`
+		Active      []JobStatus `json:"active"`
+		Past        []PastRun   `json:"past"`
+		ActiveTotal int         `json:"active_total"`
+		PastTotal   int         `json:"past_total"`
+		NextCursor  string      `json:"next_cursor,omitempty"`
 	}
 
 	return json.Marshal(jobListAlias{
-		Active: nilToEmpty(jl.Active),
-		Past:   nilToEmpty(jl.Past),
+		Active:      nilToEmpty(jl.Active),
+		Past:        nilToEmpty(jl.Past),
+		ActiveTotal: jl.ActiveTotal,
+		PastTotal:   jl.PastTotal,
+		NextCursor:  jl.NextCursor,
 	})
 }
 
+// ---------------------------------------------------------------------------
+// ListQuery
+// ---------------------------------------------------------------------------
+
+// ListQuery selects and orders a page of jobs or past runs. The zero value
+// selects everything, newest first.
+type ListQuery struct {
+	// Statuses and Models keep entries with one of the given values; empty
+	// lists match every entry.
+	Statuses []Status
+	Models   []ModelName
+	// Since and Until, when set, keep entries created at or after Since and
+	// before Until.
+	Since time.Time
+	Until time.Time
+	// Text keeps entries whose query, title or name contains it, ignoring
+	// case.
+	Text string
+
+	// Ascending lists the oldest entries first.
+	Ascending bool
+	// Limit caps the number of entries in the page; zero means no limit.
+	Limit int
+	// After, when set, starts the page after the entry with this key, in
+	// the order of the query.
+	After *ListKey
+}
+
+// ListKey identifies an entry's position in a list: entries are ordered by
+// Time and then by ID.
+type ListKey struct {
+	Time time.Time `json:"time"`
+	ID   string    `json:"id"`
+}
+
+// Match reports whether an entry with the given status, model, creation
+// time and searchable texts passes the query's filters.
+func (q ListQuery) Match(status Status, model ModelName, created time.Time, texts ...string) bool {
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, status) {
+		return false
+	}
+	if len(q.Models) > 0 && !slices.Contains(q.Models, model) {
+		return false
+	}
+	if !q.Since.IsZero() && created.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !created.Before(q.Until) {
+		return false
+	}
+	if q.Text == "" {
+		return true
+	}
+	needle := strings.ToLower(q.Text)
+	for _, text := range texts {
+		if strings.Contains(strings.ToLower(text), needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// Less reports whether the entry with key a comes before the one with key b
+// in the query's order.
+func (q ListQuery) Less(a, b ListKey) bool {
+	if q.Ascending {
+		a, b = b, a
+	}
+	if !a.Time.Equal(b.Time) {
+		return a.Time.After(b.Time)
+	}
+	return a.ID > b.ID
+}
+
 // ---------------------------------------------------------------------------
 // FileEntry
 // ---------------------------------------------------------------------------
@@ -309,9 +1205,11 @@ func nilToEmpty[T any](s []T) []T {
 // ---------------------------------------------------------------------------
 
 // EventToDict converts a ParsedEvent into a map[string]any suitable for
-// inclusion in JSON API responses. Only non-zero fields are included.
-// For result-type events, cost and timing statistics are extracted from the
-// Raw field and promoted to top-level keys.
+// inclusion in JSON API responses. Only non-zero fields are included; the
+// receive time is rendered as an RFC 3339 string. Phase events carry their
+// phase and completion estimate at the top level. For result-type events,
+// cost and timing statistics are extracted from the Raw field and promoted
+// to top-level keys.
 func EventToDict(evt ParsedEvent) map[string]any {
 	m := map[string]any{
 		"index": evt.Index,
@@ -336,6 +1234,36 @@ func EventToDict(evt ParsedEvent) map[string]any {
 	if evt.IsError {
 		m["is_error"] = true
 	}
+	if evt.ToolUseID != "" {
+		m["tool_use_id"] = evt.ToolUseID
+	}
+	if evt.ParentToolUseID != "" {
+		m["parent_tool_use_id"] = evt.ParentToolUseID
+	}
+	if ts := formatEventTime(evt.Time); ts != nil {
+		m["time"] = *ts
+	}
+	if evt.DurationMS > 0 {
+		m["duration_ms"] = evt.DurationMS
+	}
+
+	// For phase events, promote the phase and progress estimate from Raw.
+	if evt.Type == EventTypeSystem && evt.Text == "phase" && evt.Raw != nil {
+		for _, key := range []string{"phase", "phase_number", "percent"} {
+			if v, ok := evt.Raw[key]; ok {
+				m[key] = v
+			}
+		}
+	}
+
+	// For file events, promote the file's path, size and type from Raw.
+	if evt.Type == EventTypeFile && evt.Raw != nil {
+		for _, key := range []string{"path", "size", "file_type"} {
+			if v, ok := evt.Raw[key]; ok {
+				m[key] = v
+			}
+		}
+	}
 
 	// For result events, extract stats from Raw.
 	if evt.Type == EventTypeResult && evt.Raw != nil {
@@ -367,3 +1295,143 @@ func EventToDict(evt ParsedEvent) map[string]any {
 
 	return m
 }
+
+// ---------------------------------------------------------------------------
+// EventFilter
+// ---------------------------------------------------------------------------
+
+// EventFilter selects which events are served to a client and trims their
+// tool bodies. Empty lists match every event and zero limits keep bodies
+// whole.
+type EventFilter struct {
+	Types    []EventType
+	Subtypes []EventSubtype
+	// Tools matches tool calls by tool name, together with their results.
+	Tools []string
+
+	// MaxResult caps tool_result at this many runes.
+	MaxResult int
+	// MaxInput caps each top-level string value of tool_input at this many
+	// runes.
+	MaxInput   int
+	OmitResult bool
+	OmitInput  bool
+}
+
+// IsZero reports whether f neither filters nor trims events.
+func (f EventFilter) IsZero() bool {
+	return len(f.Types) == 0 && len(f.Subtypes) == 0 && len(f.Tools) == 0 &&
+		f.MaxResult == 0 && f.MaxInput == 0 && !f.OmitResult && !f.OmitInput
+}
+
+// Matcher returns an EventMatcher applying f's selection criteria.
+func (f EventFilter) Matcher() *EventMatcher {
+	return &EventMatcher{filter: f, toolIDs: make(map[string]bool)}
+}
+
+// Dict converts evt with EventToDict and trims its tool bodies as configured.
+// A trimmed or omitted body is flagged with tool_result_truncated or
+// tool_input_truncated so that clients know to fetch the full event.
+func (f EventFilter) Dict(evt ParsedEvent) map[string]any {
+	m := EventToDict(evt)
+	if _, ok := m["tool_result"]; ok {
+		switch {
+		case f.OmitResult:
+			delete(m, "tool_result")
+			m["tool_result_truncated"] = true
+		case f.MaxResult > 0:
+			if s := truncateRunes(evt.ToolResult, f.MaxResult); s != evt.ToolResult {
+				m["tool_result"] = s
+				m["tool_result_truncated"] = true
+			}
+		}
+	}
+	if _, ok := m["tool_input"]; ok {
+		switch {
+		case f.OmitInput:
+			delete(m, "tool_input")
+			m["tool_input_truncated"] = true
+		case f.MaxInput > 0:
+			if input, truncated := truncateInput(evt.ToolInput, f.MaxInput); truncated {
+				m["tool_input"] = input
+				m["tool_input_truncated"] = true
+			}
+		}
+	}
+	return m
+}
+
+// truncateInput returns a copy of input whose top-level string values are
+// capped at n runes, and whether any value was shortened. The original map
+// is returned unchanged when nothing needs trimming.
+func truncateInput(input map[string]any, n int) (map[string]any, bool) {
+	var out map[string]any
+	for k, v := range input {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if t := truncateRunes(s, n); t != s {
+			if out == nil {
+				out = maps.Clone(input)
+			}
+			out[k] = t
+		}
+	}
+	if out == nil {
+		return input, false
+	}
+	return out, true
+}
+
+// EventMatcher applies an EventFilter to a job's events in order. It
+// remembers the tool_use IDs of matching tool calls, so that a tool-name
+// filter also selects their results, which do not carry the tool name. An
+// EventMatcher is not safe for concurrent use.
+type EventMatcher struct {
+	filter  EventFilter
+	toolIDs map[string]bool
+}
+
+// Match reports whether evt passes the filter. Events must be passed in
+// log order, including those that precede the first one served.
+func (m *EventMatcher) Match(evt ParsedEvent) bool {
+	f := m.filter
+	toolMatch := len(f.Tools) == 0
+	if !toolMatch {
+		switch {
+		case evt.ToolName != "":
+			toolMatch = slices.Contains(f.Tools, evt.ToolName)
+			if toolMatch && evt.ToolUseID != "" {
+				m.toolIDs[evt.ToolUseID] = true
+			}
+		case evt.ToolUseID != "":
+			toolMatch = m.toolIDs[evt.ToolUseID]
+		}
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, evt.Type) {
+		return false
+	}
+	if len(f.Subtypes) > 0 && !slices.Contains(f.Subtypes, evt.Subtype) {
+		return false
+	}
+	return toolMatch
+}
+
+// ---------------------------------------------------------------------------
+// EventPage
+// ---------------------------------------------------------------------------
+
+// EventPage selects a window of a job's event log. The zero value selects
+// the whole log in order.
+//
+// Reading forward, the page holds events with Index >= Offset. In Reverse,
+// it holds events with Index < Offset, newest first, and a zero Offset
+// means the end of the log, so a client can fetch the latest events and
+// page backwards with each response's next offset. Limit caps the number of
+// events in the page after filtering; zero means no limit.
+type EventPage struct {
+	Offset  int
+	Limit   int
+	Reverse bool
+}
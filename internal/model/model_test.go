@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jamesprial/research-dashboard/internal/model"
 )
@@ -30,6 +31,7 @@ func Test_Status_Constants(t *testing.T) {
 		{"StatusCompleted", model.StatusCompleted, "completed"},
 		{"StatusFailed", model.StatusFailed, "failed"},
 		{"StatusCancelled", model.StatusCancelled, "cancelled"},
+		{"StatusUnknown", model.StatusUnknown, "unknown"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -40,6 +42,26 @@ func Test_Status_Constants(t *testing.T) {
 	}
 }
 
+func Test_Status_IsTerminal(t *testing.T) {
+	tests := []struct {
+		status model.Status
+		want   bool
+	}{
+		{model.StatusPending, false},
+		{model.StatusRunning, false},
+		{model.StatusCompleted, true},
+		{model.StatusFailed, true},
+		{model.StatusCancelled, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := tt.status.IsTerminal(); got != tt.want {
+				t.Errorf("%q.IsTerminal() = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_Status_IsTypedString(t *testing.T) {
 	// Verify Status is its own type, not a raw string alias that can be
 	// freely assigned from string without conversion.
@@ -426,6 +448,23 @@ func Test_ResearchRequest_Validate(t *testing.T) {
 			req:     model.ResearchRequest{Query: "quick lookup", Model: model.ModelHaiku, MaxTurns: 5},
 			wantErr: false,
 		},
+		{
+			name:    "valid with budgets",
+			req:     model.ResearchRequest{Query: "test", Model: model.ModelOpus, MaxTurns: 5, MaxCostUSD: 2.5, MaxTokens: 100000},
+			wantErr: false,
+		},
+		{
+			name:       "negative max_cost_usd",
+			req:        model.ResearchRequest{Query: "test", Model: model.ModelOpus, MaxTurns: 5, MaxCostUSD: -1},
+			wantErr:    true,
+			errContain: "max_cost_usd must not be negative",
+		},
+		{
+			name:       "negative max_tokens",
+			req:        model.ResearchRequest{Query: "test", Model: model.ModelOpus, MaxTurns: 5, MaxTokens: -1},
+			wantErr:    true,
+			errContain: "max_tokens must not be negative",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -446,6 +485,80 @@ func Test_ResearchRequest_Validate(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Struct: TokenUsage and EstimateCostUSD
+// ---------------------------------------------------------------------------
+
+func Test_TokenUsage_TotalAndAdd(t *testing.T) {
+	a := model.TokenUsage{InputTokens: 1, OutputTokens: 2, CacheCreationInputTokens: 3, CacheReadInputTokens: 4}
+	b := model.TokenUsage{InputTokens: 10, OutputTokens: 20}
+
+	if got := a.Total(); got != 10 {
+		t.Errorf("Total() = %d, want 10", got)
+	}
+	want := model.TokenUsage{InputTokens: 11, OutputTokens: 22, CacheCreationInputTokens: 3, CacheReadInputTokens: 4}
+	if got := a.Add(b); got != want {
+		t.Errorf("Add() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_EstimateCostUSD(t *testing.T) {
+	million := model.TokenUsage{InputTokens: 1_000_000, OutputTokens: 1_000_000}
+	tests := []struct {
+		name  string
+		model model.ModelName
+		usage model.TokenUsage
+		want  float64
+	}{
+		{"zero usage", model.ModelOpus, model.TokenUsage{}, 0},
+		{"opus", model.ModelOpus, million, 90},
+		{"sonnet", model.ModelSonnet, million, 18},
+		{"haiku", model.ModelHaiku, million, 6},
+		{"unknown model priced as opus", "mystery", million, 90},
+		{"cache tokens", model.ModelSonnet, model.TokenUsage{CacheCreationInputTokens: 1_000_000, CacheReadInputTokens: 1_000_000}, 4.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := model.EstimateCostUSD(tt.model, tt.usage)
+			if diff := got - tt.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("EstimateCostUSD() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Struct: FollowUpRequest — Validate()
+// ---------------------------------------------------------------------------
+
+func Test_FollowUpRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        model.FollowUpRequest
+		errContain string // empty means no error expected
+	}{
+		{"query only", model.FollowUpRequest{Query: "expand section 3"}, ""},
+		{"with model and turns", model.FollowUpRequest{Query: "q", Model: model.ModelSonnet, MaxTurns: 20}, ""},
+		{"empty query", model.FollowUpRequest{}, "query is required"},
+		{"invalid model", model.FollowUpRequest{Query: "q", Model: "gpt4"}, "invalid model"},
+		{"negative max_turns", model.FollowUpRequest{Query: "q", MaxTurns: -1}, "max_turns must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.errContain == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errContain) {
+				t.Errorf("Validate() error = %v, want it to contain %q", err, tt.errContain)
+			}
+		})
+	}
+}
+
 func Test_ResearchRequest_JSON_Deserialization_Defaults(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -783,6 +896,9 @@ func Test_JobList_JSON_Roundtrip(t *testing.T) {
 		Past: []model.PastRun{
 			{Dir: "/runs/old", Name: "old", HasReport: true},
 		},
+		ActiveTotal: 1,
+		PastTotal:   4,
+		NextCursor:  "abc",
 	}
 	data, err := json.Marshal(original)
 	if err != nil {
@@ -806,6 +922,10 @@ func Test_JobList_JSON_Roundtrip(t *testing.T) {
 	if decoded.Past[0].Dir != "/runs/old" {
 		t.Errorf("Past[0].Dir = %q, want %q", decoded.Past[0].Dir, "/runs/old")
 	}
+	if decoded.ActiveTotal != 1 || decoded.PastTotal != 4 || decoded.NextCursor != "abc" {
+		t.Errorf("totals and cursor = (%d, %d, %q), want (1, 4, %q)",
+			decoded.ActiveTotal, decoded.PastTotal, decoded.NextCursor, "abc")
+	}
 }
 
 // ---------------------------------------------------------------------------
@@ -929,6 +1049,215 @@ func Test_FileListResponse_JSON_Roundtrip(t *testing.T) {
 // Function: EventToDict
 // ---------------------------------------------------------------------------
 
+// ---------------------------------------------------------------------------
+// Function: PairToolCalls
+// ---------------------------------------------------------------------------
+
+func Test_PairToolCalls(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []model.ParsedEvent{
+		{Index: 0, Type: model.EventTypeSystem, Text: "init"},
+		{Index: 1, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Task", ToolUseID: "a", ToolInput: map[string]any{"description": "worker 1"}, Time: t0},
+		{Index: 2, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Task", ToolUseID: "b", Time: t0},
+		{Index: 3, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "WebFetch", ToolUseID: "c", Time: t0},
+		{Index: 4, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "b", ToolResult: strings.Repeat("x", 300), Time: t0.Add(2 * time.Second), DurationMS: 2000},
+		{Index: 5, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "c", ToolResult: "403", IsError: true, DurationMS: 10},
+		{Index: 6, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "unknown"},
+		{Index: 7, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Read"},
+		{Index: 8, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolResult: "file"},
+	}
+
+	calls := model.PairToolCalls(events)
+	if len(calls) != 4 {
+		t.Fatalf("len(calls) = %d, want 4", len(calls))
+	}
+
+	tests := []struct {
+		name        string
+		call        model.ToolCall
+		status      model.ToolCallStatus
+		resultIndex *int
+		durationMS  *int64
+	}{
+		{"a pending", calls[0], model.ToolCallPending, nil, nil},
+		{"b completed out of order", calls[1], model.ToolCallCompleted, ptr(4), ptr(int64(2000))},
+		{"c errored", calls[2], model.ToolCallError, ptr(5), ptr(int64(10))},
+		{"id-less pairs in order", calls[3], model.ToolCallCompleted, ptr(8), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.call.Status != tt.status {
+				t.Errorf("Status = %q, want %q", tt.call.Status, tt.status)
+			}
+			if !reflect.DeepEqual(tt.call.ResultIndex, tt.resultIndex) {
+				t.Errorf("ResultIndex = %v, want %v", tt.call.ResultIndex, tt.resultIndex)
+			}
+			if !reflect.DeepEqual(tt.call.DurationMS, tt.durationMS) {
+				t.Errorf("DurationMS = %v, want %v", tt.call.DurationMS, tt.durationMS)
+			}
+		})
+	}
+
+	if calls[0].ToolInput["description"] != "worker 1" || calls[0].UseIndex != 1 {
+		t.Errorf("calls[0] = %+v, want input and use index of event 1", calls[0])
+	}
+	if calls[1].StartedAt == nil || calls[1].FinishedAt == nil {
+		t.Errorf("calls[1] StartedAt/FinishedAt = %v/%v, want both set", calls[1].StartedAt, calls[1].FinishedAt)
+	}
+	if len(calls[1].ResultPreview) != 200 {
+		t.Errorf("len(ResultPreview) = %d, want 200", len(calls[1].ResultPreview))
+	}
+	if !calls[2].IsError {
+		t.Error("calls[2].IsError = false, want true")
+	}
+}
+
+func Test_ToolCallList_MarshalJSON_EmptyTools(t *testing.T) {
+	data, err := json.Marshal(model.ToolCallList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"tools":[]}` {
+		t.Errorf("Marshal = %s, want %s", data, `{"tools":[]}`)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Function: BuildSubagents
+// ---------------------------------------------------------------------------
+
+func Test_ModelTier(t *testing.T) {
+	tests := []struct {
+		id   string
+		want model.ModelName
+	}{
+		{"claude-opus-4-1-20250805", model.ModelOpus},
+		{"claude-sonnet-4-5", model.ModelSonnet},
+		{"claude-haiku-4-5", model.ModelHaiku},
+		{"", ""},
+		{"gpt-4", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := model.ModelTier(tt.id); got != tt.want {
+				t.Errorf("ModelTier(%q) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_BuildSubagents(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	usage := &model.TokenUsage{InputTokens: 1_000_000}
+	task := func(idx int, id, agentType, desc string) model.ParsedEvent {
+		return model.ParsedEvent{
+			Index: idx, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse,
+			ToolName: "Task", ToolUseID: id, Time: t0,
+			ToolInput: map[string]any{"subagent_type": agentType, "description": desc},
+		}
+	}
+	events := []model.ParsedEvent{
+		task(0, "w1", "research-worker", "Market size"),
+		task(1, "w2", "research-worker", "Regulation"),
+		{Index: 2, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Agent", ToolUseID: "arch", ToolInput: map[string]any{"subagent_type": "source-archiver"}},
+		// w1: one message split over two lines (usage repeated), then a tool result.
+		{Index: 3, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, ParentToolUseID: "w1", MessageID: "m1", MessageModel: "claude-sonnet-4-5", Usage: usage, Time: t0.Add(time.Second)},
+		{Index: 4, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "WebSearch", ToolUseID: "s1", ParentToolUseID: "w1", MessageID: "m1", MessageModel: "claude-sonnet-4-5", Usage: usage, Time: t0.Add(2 * time.Second)},
+		{Index: 5, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "s1", ParentToolUseID: "w1", Time: t0.Add(3 * time.Second)},
+		{Index: 6, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, ParentToolUseID: "w1", MessageID: "m2", Usage: usage, Time: t0.Add(4 * time.Second)},
+		// w1 finishes; w2 fails; the archiver is still running.
+		{Index: 7, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "w1", DurationMS: 5000, Time: t0.Add(5 * time.Second)},
+		{Index: 8, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "w2", IsError: true},
+		// A non-agent tool call is ignored.
+		{Index: 9, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Write", ToolUseID: "wr"},
+	}
+
+	agents := model.BuildSubagents(events, model.ModelOpus)
+	if len(agents) != 3 {
+		t.Fatalf("len(agents) = %d, want 3", len(agents))
+	}
+
+	w1 := agents[0]
+	if w1.AgentType != "research-worker" || w1.Description != "Market size" {
+		t.Errorf("w1 type/description = %q/%q", w1.AgentType, w1.Description)
+	}
+	if w1.Status != model.SubagentCompleted {
+		t.Errorf("w1 Status = %q, want completed", w1.Status)
+	}
+	if w1.Turns != 2 || w1.ToolCalls != 1 || w1.EventCount != 4 {
+		t.Errorf("w1 Turns/ToolCalls/EventCount = %d/%d/%d, want 2/1/4", w1.Turns, w1.ToolCalls, w1.EventCount)
+	}
+	if w1.Usage.InputTokens != 2_000_000 {
+		t.Errorf("w1 Usage.InputTokens = %d, want 2000000 (m1 counted once)", w1.Usage.InputTokens)
+	}
+	// m1 is priced as sonnet ($3/M); m2 names no model and falls back to opus ($15/M).
+	if diff := w1.EstimatedCostUSD - 18; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("w1 EstimatedCostUSD = %v, want 18", w1.EstimatedCostUSD)
+	}
+	if w1.DurationMS == nil || *w1.DurationMS != 5000 {
+		t.Errorf("w1 DurationMS = %v, want 5000", w1.DurationMS)
+	}
+	if w1.LastActivityAt == nil || *w1.LastActivityAt != "2026-01-01T00:00:04Z" {
+		t.Errorf("w1 LastActivityAt = %v, want 2026-01-01T00:00:04Z", w1.LastActivityAt)
+	}
+
+	if agents[1].Status != model.SubagentFailed {
+		t.Errorf("w2 Status = %q, want failed", agents[1].Status)
+	}
+	if agents[2].AgentType != "source-archiver" || agents[2].Status != model.SubagentRunning {
+		t.Errorf("archiver = %+v, want running source-archiver", agents[2])
+	}
+}
+
+func Test_EventToDict_PhaseEvent(t *testing.T) {
+	m := model.EventToDict(model.ParsedEvent{
+		Index: 5,
+		Type:  model.EventTypeSystem,
+		Text:  "phase",
+		Raw:   map[string]any{"type": "system", "subtype": "phase", "phase": "synthesis", "phase_number": 3, "percent": 50},
+	})
+	if m["phase"] != "synthesis" || m["phase_number"] != 3 || m["percent"] != 50 {
+		t.Errorf("EventToDict() = %v, want phase, phase_number and percent promoted", m)
+	}
+}
+
+func Test_EventToDict_FileEvent(t *testing.T) {
+	m := model.EventToDict(model.ParsedEvent{
+		Index:   6,
+		Type:    model.EventTypeFile,
+		Subtype: model.SubtypeFileCreated,
+		Text:    "sources/a.md",
+		Raw:     map[string]any{"type": "file", "subtype": "file_created", "path": "sources/a.md", "size": int64(42), "file_type": "md"},
+	})
+	if m["subtype"] != "file_created" || m["path"] != "sources/a.md" || m["size"] != int64(42) || m["file_type"] != "md" {
+		t.Errorf("EventToDict() = %v, want subtype, path, size and file_type", m)
+	}
+}
+
+func Test_EventToDict_TimeAndDuration(t *testing.T) {
+	received := time.Date(2026, 3, 1, 12, 30, 0, 500_000_000, time.FixedZone("X", 3600))
+	m := model.EventToDict(model.ParsedEvent{
+		Index:      3,
+		Type:       model.EventTypeUser,
+		Subtype:    model.SubtypeToolResult,
+		Time:       received,
+		DurationMS: 1500,
+	})
+	if m["time"] != "2026-03-01T11:30:00.5Z" {
+		t.Errorf("time = %v, want %q", m["time"], "2026-03-01T11:30:00.5Z")
+	}
+	if m["duration_ms"] != int64(1500) {
+		t.Errorf("duration_ms = %v (%T), want 1500", m["duration_ms"], m["duration_ms"])
+	}
+
+	m = model.EventToDict(model.ParsedEvent{Index: 0, Type: model.EventTypeSystem})
+	for _, key := range []string{"time", "duration_ms"} {
+		if _, ok := m[key]; ok {
+			t.Errorf("key %q present for event without it, want absent", key)
+		}
+	}
+}
+
 func Test_EventToDict(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -1100,6 +1429,330 @@ func Test_EventToDict(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Struct: EventFilter
+// ---------------------------------------------------------------------------
+
+func Test_EventMatcher_Match(t *testing.T) {
+	events := []model.ParsedEvent{
+		{Index: 0, Type: model.EventTypeSystem},
+		{Index: 1, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Text: "hi"},
+		{Index: 2, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "WebFetch", ToolUseID: "t1"},
+		{Index: 3, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Bash", ToolUseID: "t2"},
+		{Index: 4, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "t2"},
+		{Index: 5, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "t1"},
+	}
+	tests := []struct {
+		name   string
+		filter model.EventFilter
+		want   []int
+	}{
+		{"zero filter", model.EventFilter{}, []int{0, 1, 2, 3, 4, 5}},
+		{"types", model.EventFilter{Types: []model.EventType{model.EventTypeSystem, model.EventTypeUser}}, []int{0, 4, 5}},
+		{"subtypes", model.EventFilter{Subtypes: []model.EventSubtype{model.SubtypeToolUse}}, []int{2, 3}},
+		{"tools include results", model.EventFilter{Tools: []string{"WebFetch"}}, []int{2, 5}},
+		{"tools with type", model.EventFilter{Tools: []string{"WebFetch"}, Types: []model.EventType{model.EventTypeUser}}, []int{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.filter.Matcher()
+			var got []int
+			for _, evt := range events {
+				if m.Match(evt) {
+					got = append(got, evt.Index)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_EventFilter_Dict(t *testing.T) {
+	evt := model.ParsedEvent{
+		Index:      7,
+		Type:       model.EventTypeUser,
+		Subtype:    model.SubtypeToolResult,
+		ToolInput:  map[string]any{"url": "https://example.com/long", "n": 3},
+		ToolResult: "héllo world",
+	}
+	tests := []struct {
+		name           string
+		filter         model.EventFilter
+		wantResult     any
+		wantInput      any
+		wantResultFlag bool
+		wantInputFlag  bool
+	}{
+		{"zero filter", model.EventFilter{}, "héllo world", evt.ToolInput, false, false},
+		{"max_result", model.EventFilter{MaxResult: 5}, "héllo", evt.ToolInput, true, false},
+		{"max_result not reached", model.EventFilter{MaxResult: 50}, "héllo world", evt.ToolInput, false, false},
+		{"max_input", model.EventFilter{MaxInput: 8}, "héllo world", map[string]any{"url": "https://", "n": 3}, false, true},
+		{"omit both", model.EventFilter{OmitResult: true, OmitInput: true}, nil, nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.filter.Dict(evt)
+			if !reflect.DeepEqual(m["tool_result"], tt.wantResult) {
+				t.Errorf("tool_result = %v, want %v", m["tool_result"], tt.wantResult)
+			}
+			if !reflect.DeepEqual(m["tool_input"], tt.wantInput) {
+				t.Errorf("tool_input = %v, want %v", m["tool_input"], tt.wantInput)
+			}
+			if got := m["tool_result_truncated"] == true; got != tt.wantResultFlag {
+				t.Errorf("tool_result_truncated = %v, want %v", got, tt.wantResultFlag)
+			}
+			if got := m["tool_input_truncated"] == true; got != tt.wantInputFlag {
+				t.Errorf("tool_input_truncated = %v, want %v", got, tt.wantInputFlag)
+			}
+		})
+	}
+	if evt.ToolInput["url"] != "https://example.com/long" {
+		t.Error("Dict modified the event's ToolInput")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// RetryPolicy
+// ---------------------------------------------------------------------------
+
+func Test_RetryPolicy_Backoff(t *testing.T) {
+	p := model.RetryPolicy{
+		MaxAttempts:       4,
+		BackoffSeconds:    30,
+		MaxBackoffSeconds: 100,
+		RetryOn:           []model.ErrorKind{model.ErrorKindRateLimited},
+	}
+	tests := []struct {
+		name      string
+		kind      model.ErrorKind
+		attempt   int
+		wantDelay time.Duration
+		wantOK    bool
+	}{
+		{"first retry", model.ErrorKindRateLimited, 1, 30 * time.Second, true},
+		{"doubles", model.ErrorKindRateLimited, 2, 60 * time.Second, true},
+		{"capped", model.ErrorKindRateLimited, 3, 100 * time.Second, true},
+		{"attempts exhausted", model.ErrorKindRateLimited, 4, 0, false},
+		{"kind not retried", model.ErrorKindCrash, 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := p.Backoff(tt.kind, tt.attempt)
+			if delay != tt.wantDelay || ok != tt.wantOK {
+				t.Errorf("Backoff(%q, %d) = (%v, %v), want (%v, %v)", tt.kind, tt.attempt, delay, ok, tt.wantDelay, tt.wantOK)
+			}
+		})
+	}
+}
+
+func Test_RetryPolicy_WithDefaults(t *testing.T) {
+	d := model.RetryPolicy{
+		MaxAttempts:       3,
+		BackoffSeconds:    30,
+		MaxBackoffSeconds: 600,
+		RetryOn:           []model.ErrorKind{model.ErrorKindRateLimited},
+	}
+	got := model.RetryPolicy{MaxAttempts: 5, RetryOn: []model.ErrorKind{}}.WithDefaults(d)
+	want := model.RetryPolicy{MaxAttempts: 5, BackoffSeconds: 30, MaxBackoffSeconds: 600, RetryOn: []model.ErrorKind{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WithDefaults() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_RetryPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  model.RetryPolicy
+		wantErr bool
+	}{
+		{"zero", model.RetryPolicy{}, false},
+		{"valid", model.RetryPolicy{MaxAttempts: 10, BackoffSeconds: 5, RetryOn: []model.ErrorKind{model.ErrorKindNetwork}}, false},
+		{"negative attempts", model.RetryPolicy{MaxAttempts: -1}, true},
+		{"too many attempts", model.RetryPolicy{MaxAttempts: 11}, true},
+		{"negative backoff", model.RetryPolicy{BackoffSeconds: -1}, true},
+		{"negative max backoff", model.RetryPolicy{MaxBackoffSeconds: -1}, true},
+		{"permanent kind", model.RetryPolicy{RetryOn: []model.ErrorKind{model.ErrorKindAuthFailed}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// OutputDirName
+// ---------------------------------------------------------------------------
+
+func Test_OutputDirName(t *testing.T) {
+	created := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query string
+		id    string
+		want  string
+	}{
+		{"simple query", "AI trends 2026", "3f2a9c1e-0b7d-4e21-9a3c-5d6e7f809a1b", "research-ai-trends-2026-20260314-150926-3f2a9c1e"},
+		{"punctuation", "What's new in Go 1.25?", "abc", "research-what-s-new-in-go-1-20260314-150926-abc"},
+		{"long word cut", strings.Repeat("a", 60), "abc", "research-" + strings.Repeat("a", 48) + "-20260314-150926-abc"},
+		{"length limit drops words", strings.Repeat("abcdefghij ", 5), "abc", "research-abcdefghij-abcdefghij-abcdefghij-abcdefghij-20260314-150926-abc"},
+		{"no letters or digits", "¿¡?!", "abc", "research-query-20260314-150926-abc"},
+		{"short id", "x", "test-job-1", "research-x-20260314-150926-test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := model.OutputDirName(tt.query, created, tt.id); got != tt.want {
+				t.Errorf("OutputDirName(%q, %v, %q) = %q, want %q", tt.query, created, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ParseOutputDirName(t *testing.T) {
+	tests := []struct {
+		name      string
+		dir       string
+		wantTopic string
+		wantTime  time.Time
+		wantOK    bool
+	}{
+		{"assigned name", "research-ai-trends-2026-20260314-150926-3f2a9c1e", "ai trends 2026", time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC), true},
+		{"legacy name in local time", "research-quantum-computing-20240101-083000", "quantum computing", time.Date(2024, 1, 1, 8, 30, 0, 0, time.Local), true},
+		{"no time", "research-notes", "notes", time.Time{}, false},
+		{"date only", "research-test-20240101", "test-20240101", time.Time{}, false},
+		{"no prefix", "other-20240101-083000", "other-20240101-083000", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic, created, ok := model.ParseOutputDirName(tt.dir)
+			if topic != tt.wantTopic || !created.Equal(tt.wantTime) || ok != tt.wantOK {
+				t.Errorf("ParseOutputDirName(%q) = (%q, %v, %v), want (%q, %v, %v)", tt.dir, topic, created, ok, tt.wantTopic, tt.wantTime, tt.wantOK)
+			}
+		})
+	}
+}
+
+func Test_ParseOutputDirName_RoundTrip(t *testing.T) {
+	created := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	topic, got, ok := model.ParseOutputDirName(model.OutputDirName("Solid-state batteries?", created, "abc"))
+	if topic != "solid state batteries" || !got.Equal(created) || !ok {
+		t.Errorf("ParseOutputDirName(OutputDirName()) = (%q, %v, %v)", topic, got, ok)
+	}
+}
+
+func Test_OutputDirName_UsesUTC(t *testing.T) {
+	local := time.Date(2026, 3, 14, 8, 9, 26, 0, time.FixedZone("PDT", -7*60*60))
+	if got, want := model.OutputDirName("q", local, "id"), "research-q-20260314-150926-id"; got != want {
+		t.Errorf("OutputDirName() = %q, want %q", got, want)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Manifest
+// ---------------------------------------------------------------------------
+
+func Test_Manifest_Fill(t *testing.T) {
+	started := time.Date(2026, 3, 14, 15, 0, 0, 0, time.FixedZone("CET", 3600))
+	m := model.Manifest{
+		RunManifest: model.RunManifest{
+			JobID:      "job-1",
+			Query:      "q",
+			Model:      model.ModelOpus,
+			MaxTurns:   5,
+			Status:     model.StatusFailed,
+			ErrorKind:  model.ErrorKindCrash,
+			Error:      "boom",
+			CreatedAt:  started,
+			StartedAt:  started,
+			FinishedAt: started.Add(2500 * time.Millisecond),
+		},
+		FollowUps: []model.RunManifest{{JobID: "job-2", ParentID: "job-1"}},
+	}
+	run := model.PastRun{Name: "research-q", HasReport: true}
+	m.Fill(&run)
+
+	want := model.PastRun{
+		Name:       "research-q",
+		HasReport:  true,
+		JobID:      "job-1",
+		Query:      "q",
+		Model:      model.ModelOpus,
+		MaxTurns:   5,
+		Status:     model.StatusFailed,
+		ErrorKind:  model.ErrorKindCrash,
+		Error:      "boom",
+		CreatedAt:  "2026-03-14T14:00:00Z",
+		FinishedAt: "2026-03-14T14:00:02Z",
+		DurationMS: 2500,
+		FollowUps:  m.FollowUps,
+	}
+	if !reflect.DeepEqual(run, want) {
+		t.Errorf("Fill() = %+v, want %+v", run, want)
+	}
+}
+
+func Test_Manifest_Fill_NoTimes(t *testing.T) {
+	var run model.PastRun
+	model.Manifest{RunManifest: model.RunManifest{JobID: "job-1"}}.Fill(&run)
+	if run.CreatedAt != "" || run.FinishedAt != "" || run.DurationMS != 0 {
+		t.Errorf("Fill() = %+v, want no times", run)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// ListQuery
+// ---------------------------------------------------------------------------
+
+func Test_ListQuery_Match(t *testing.T) {
+	created := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		q    model.ListQuery
+		want bool
+	}{
+		{"zero query", model.ListQuery{}, true},
+		{"status listed", model.ListQuery{Statuses: []model.Status{model.StatusFailed, model.StatusCompleted}}, true},
+		{"status not listed", model.ListQuery{Statuses: []model.Status{model.StatusFailed}}, false},
+		{"model listed", model.ListQuery{Models: []model.ModelName{model.ModelOpus}}, true},
+		{"model not listed", model.ListQuery{Models: []model.ModelName{model.ModelHaiku}}, false},
+		{"since is inclusive", model.ListQuery{Since: created}, true},
+		{"created before since", model.ListQuery{Since: created.Add(time.Second)}, false},
+		{"until is exclusive", model.ListQuery{Until: created}, false},
+		{"created before until", model.ListQuery{Until: created.Add(time.Second)}, true},
+		{"text in second text", model.ListQuery{Text: "OUTLOOK"}, true},
+		{"text nowhere", model.ListQuery{Text: "wind"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.q.Match(model.StatusCompleted, model.ModelOpus, created, "solar power", "Solar Outlook")
+			if got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ListQuery_Less(t *testing.T) {
+	older := model.ListKey{Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), ID: "b"}
+	newer := model.ListKey{Time: older.Time.Add(time.Hour), ID: "a"}
+	tie := model.ListKey{Time: older.Time, ID: "a"}
+
+	desc, asc := model.ListQuery{}, model.ListQuery{Ascending: true}
+	if !desc.Less(newer, older) || desc.Less(older, newer) {
+		t.Error("descending order should list newer keys first")
+	}
+	if !asc.Less(older, newer) || asc.Less(newer, older) {
+		t.Error("ascending order should list older keys first")
+	}
+	if !desc.Less(older, tie) || !asc.Less(tie, older) {
+		t.Error("keys with equal times should be ordered by ID")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Test helpers
 // ---------------------------------------------------------------------------
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/jamesprial/research-dashboard/internal/model"
 )
@@ -55,16 +56,16 @@ func ParseStreamLine(line string, counter *atomic.Int64) []model.ParsedEvent {
 		})}
 
 	case "assistant":
-		return parseAssistantBlocks(data, counter)
+		return withParent(data, parseAssistantBlocks(data, counter))
 
 	case "user":
-		return parseUserBlocks(data, counter)
+		return withParent(data, parseUserBlocks(data, counter))
 
 	case "result":
 		return parseResult(data, counter)
 
 	case "stream_event":
-		return parseStreamEvent(data, counter)
+		return withParent(data, parseStreamEvent(data, counter))
 
 	case "":
 		// No type field present — treat as raw.
@@ -90,9 +91,11 @@ func ParseStreamLine(line string, counter *atomic.Int64) []model.ParsedEvent {
 func parseAssistantBlocks(data map[string]any, counter *atomic.Int64) []model.ParsedEvent {
 	blocks := extractContentBlocks(data)
 	if len(blocks) == 0 {
-		return []model.ParsedEvent{emit(counter, model.ParsedEvent{
+		events := []model.ParsedEvent{emit(counter, model.ParsedEvent{
 			Type: model.EventTypeAssistant,
 		})}
+		attachMessageMeta(data, events)
+		return events
 	}
 
 	var events []model.ParsedEvent
@@ -112,6 +115,7 @@ func parseAssistantBlocks(data map[string]any, counter *atomic.Int64) []model.Pa
 			}))
 		case "tool_use":
 			name, _ := stringVal(block, "name")
+			id, _ := stringVal(block, "id")
 			var toolInput map[string]any
 			if raw, ok := block["input"]; ok {
 				toolInput, _ = raw.(map[string]any)
@@ -121,6 +125,7 @@ func parseAssistantBlocks(data map[string]any, counter *atomic.Int64) []model.Pa
 				Subtype:   model.SubtypeToolUse,
 				ToolName:  name,
 				ToolInput: toolInput,
+				ToolUseID: id,
 			}))
 		}
 		// Unknown block types are silently skipped.
@@ -128,10 +133,52 @@ func parseAssistantBlocks(data map[string]any, counter *atomic.Int64) []model.Pa
 
 	if len(events) == 0 {
 		// Content array was non-empty but contained no recognized block types.
-		return []model.ParsedEvent{emit(counter, model.ParsedEvent{
+		events = []model.ParsedEvent{emit(counter, model.ParsedEvent{
 			Type: model.EventTypeAssistant,
 		})}
 	}
+	attachMessageMeta(data, events)
+	return events
+}
+
+// attachMessageMeta copies the message ID and model of an assistant message
+// onto every event parsed from it, and its usage block onto the first event
+// only, so that usage is reported once per line rather than once per content
+// block.
+func attachMessageMeta(data map[string]any, events []model.ParsedEvent) {
+	message, ok := data["message"].(map[string]any)
+	if !ok {
+		return
+	}
+	id, _ := stringVal(message, "id")
+	mdl, _ := stringVal(message, "model")
+	for i := range events {
+		events[i].MessageID = id
+		events[i].MessageModel = mdl
+	}
+	usageMap, ok := message["usage"].(map[string]any)
+	if !ok {
+		return
+	}
+	usage := model.TokenUsage{
+		InputTokens:              intVal(usageMap, "input_tokens"),
+		OutputTokens:             intVal(usageMap, "output_tokens"),
+		CacheCreationInputTokens: intVal(usageMap, "cache_creation_input_tokens"),
+		CacheReadInputTokens:     intVal(usageMap, "cache_read_input_tokens"),
+	}
+	events[0].Usage = &usage
+}
+
+// withParent tags every event parsed from a line with the line's
+// parent_tool_use_id, which the CLI sets on messages produced by a subagent.
+func withParent(data map[string]any, events []model.ParsedEvent) []model.ParsedEvent {
+	parent, _ := stringVal(data, "parent_tool_use_id")
+	if parent == "" {
+		return events
+	}
+	for i := range events {
+		events[i].ParentToolUseID = parent
+	}
 	return events
 }
 
@@ -157,12 +204,14 @@ func parseUserBlocks(data map[string]any, counter *atomic.Int64) []model.ParsedE
 
 		toolResult := extractToolResultContent(block)
 		isError, _ := boolVal(block, "is_error")
+		toolUseID, _ := stringVal(block, "tool_use_id")
 
 		events = append(events, emit(counter, model.ParsedEvent{
 			Type:       model.EventTypeUser,
 			Subtype:    model.SubtypeToolResult,
 			ToolResult: toolResult,
 			IsError:    isError,
+			ToolUseID:  toolUseID,
 		}))
 	}
 
@@ -231,10 +280,12 @@ func parseStreamEvent(data map[string]any, counter *atomic.Int64) []model.Parsed
 			return nil
 		}
 		name, _ := stringVal(block, "name")
+		id, _ := stringVal(block, "id")
 		return []model.ParsedEvent{emit(counter, model.ParsedEvent{
-			Type:     model.EventTypeAssistant,
-			Subtype:  model.SubtypeToolStart,
-			ToolName: name,
+			Type:      model.EventTypeAssistant,
+			Subtype:   model.SubtypeToolStart,
+			ToolName:  name,
+			ToolUseID: id,
 		})}
 
 	default:
@@ -243,6 +294,134 @@ func parseStreamEvent(data map[string]any, counter *atomic.Int64) []model.Parsed
 	}
 }
 
+// ---------------------------------------------------------------------------
+// UsageTracker
+// ---------------------------------------------------------------------------
+
+// UsageTracker accumulates token usage across the assistant events of a
+// single run. The CLI emits one assistant line per content block, each
+// repeating the usage of the whole message, so usage is keyed by message ID
+// and the latest report for a message replaces earlier ones. Usage on events
+// without a message ID is summed as-is. Usage is also kept by the model tier
+// of its message, so that subagents running on other tiers are priced as
+// such. A UsageTracker is not safe for concurrent use.
+type UsageTracker struct {
+	byMessage map[string]messageUsage
+	anonymous map[model.ModelName]model.TokenUsage
+}
+
+// messageUsage is the latest usage reported for one message, and the model
+// tier of the message, if known.
+type messageUsage struct {
+	usage model.TokenUsage
+	tier  model.ModelName
+}
+
+// Observe records the usage carried by evt, if any, and reports whether the
+// running total may have changed.
+func (t *UsageTracker) Observe(evt model.ParsedEvent) bool {
+	if evt.Usage == nil {
+		return false
+	}
+	tier := model.ModelTier(evt.MessageModel)
+	if evt.MessageID == "" {
+		if t.anonymous == nil {
+			t.anonymous = make(map[model.ModelName]model.TokenUsage)
+		}
+		t.anonymous[tier] = t.anonymous[tier].Add(*evt.Usage)
+		return true
+	}
+	if t.byMessage == nil {
+		t.byMessage = make(map[string]messageUsage)
+	}
+	if tier == "" {
+		tier = t.byMessage[evt.MessageID].tier
+	}
+	t.byMessage[evt.MessageID] = messageUsage{usage: *evt.Usage, tier: tier}
+	return true
+}
+
+// Total returns the cumulative usage observed so far.
+func (t *UsageTracker) Total() model.TokenUsage {
+	var total model.TokenUsage
+	for _, u := range t.anonymous {
+		total = total.Add(u)
+	}
+	for _, m := range t.byMessage {
+		total = total.Add(m.usage)
+	}
+	return total
+}
+
+// CostUSD returns the estimated cost of the usage observed so far, pricing
+// each message by its model tier, or by fallback when the message does not
+// name a known model.
+func (t *UsageTracker) CostUSD(fallback model.ModelName) float64 {
+	tierOr := func(tier model.ModelName) model.ModelName {
+		if tier == "" {
+			return fallback
+		}
+		return tier
+	}
+	var cost float64
+	for tier, u := range t.anonymous {
+		cost += model.EstimateCostUSD(tierOr(tier), u)
+	}
+	for _, m := range t.byMessage {
+		cost += model.EstimateCostUSD(tierOr(m.tier), m.usage)
+	}
+	return cost
+}
+
+// ---------------------------------------------------------------------------
+// ToolTimer
+// ---------------------------------------------------------------------------
+
+// ToolTimer measures how long tool calls take by pairing each tool_result
+// event with its tool_use event. Events are matched by ToolUseID; events
+// without one fall back to pairing with the oldest outstanding call that also
+// lacks an ID, in the order the CLI reports them. Events must carry receive
+// times. A ToolTimer is not safe for concurrent use.
+type ToolTimer struct {
+	byID      map[string]time.Time
+	anonymous []time.Time
+}
+
+// Observe records a tool_use event's start time, or sets DurationMS on a
+// tool_result event from its matching call. Other events are ignored.
+func (t *ToolTimer) Observe(evt *model.ParsedEvent) {
+	switch {
+	case evt.Type == model.EventTypeAssistant && evt.Subtype == model.SubtypeToolUse:
+		if evt.ToolUseID == "" {
+			t.anonymous = append(t.anonymous, evt.Time)
+			return
+		}
+		if t.byID == nil {
+			t.byID = make(map[string]time.Time)
+		}
+		t.byID[evt.ToolUseID] = evt.Time
+
+	case evt.Type == model.EventTypeUser && evt.Subtype == model.SubtypeToolResult:
+		var start time.Time
+		if evt.ToolUseID != "" {
+			var ok bool
+			if start, ok = t.byID[evt.ToolUseID]; !ok {
+				return
+			}
+			delete(t.byID, evt.ToolUseID)
+		} else {
+			if len(t.anonymous) == 0 {
+				return
+			}
+			start = t.anonymous[0]
+			t.anonymous = t.anonymous[1:]
+		}
+		if !start.IsZero() && !evt.Time.IsZero() {
+			evt.DurationMS = evt.Time.Sub(start).Milliseconds()
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Helper functions
 // ---------------------------------------------------------------------------
@@ -349,6 +528,13 @@ func stringVal(m map[string]any, key string) (string, bool) {
 	return s, ok
 }
 
+// intVal retrieves a JSON-decoded number from a map by key as an int.
+// Returns 0 if the key is absent or the value is not a number.
+func intVal(m map[string]any, key string) int {
+	f, _ := m[key].(float64)
+	return int(f)
+}
+
 // boolVal safely retrieves a bool value from a map by key.
 // Returns (false, false) if the key is absent or the value is not a bool.
 func boolVal(m map[string]any, key string) (bool, bool) {
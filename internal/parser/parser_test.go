@@ -2,9 +2,11 @@ package parser_test
 
 import (
 	"encoding/json"
+	"math"
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/jamesprial/research-dashboard/internal/model"
 	"github.com/jamesprial/research-dashboard/internal/parser"
@@ -252,6 +254,253 @@ func Test_ParseStreamLine_AssistantMultipleBlocks(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Test: Assistant events — usage
+// ---------------------------------------------------------------------------
+
+func Test_ParseStreamLine_AssistantUsage(t *testing.T) {
+	line := `{"type":"assistant","message":{"id":"msg_1","content":[{"type":"text","text":"a"},{"type":"text","text":"b"}],"usage":{"input_tokens":10,"output_tokens":20,"cache_creation_input_tokens":30,"cache_read_input_tokens":40}}}`
+	events := parser.ParseStreamLine(line, newCounter())
+
+	assertEventCount(t, events, 2)
+	want := model.TokenUsage{InputTokens: 10, OutputTokens: 20, CacheCreationInputTokens: 30, CacheReadInputTokens: 40}
+	if events[0].Usage == nil || *events[0].Usage != want {
+		t.Errorf("events[0].Usage = %+v, want %+v", events[0].Usage, want)
+	}
+	if events[0].MessageID != "msg_1" {
+		t.Errorf("events[0].MessageID = %q, want %q", events[0].MessageID, "msg_1")
+	}
+	if events[1].Usage != nil {
+		t.Errorf("events[1].Usage = %+v, want nil (usage reported once per line)", events[1].Usage)
+	}
+}
+
+func Test_ParseStreamLine_AssistantWithoutUsage(t *testing.T) {
+	line := `{"type":"assistant","message":{"id":"msg_1","content":[{"type":"text","text":"a"}]}}`
+	events := parser.ParseStreamLine(line, newCounter())
+
+	assertEventCount(t, events, 1)
+	if events[0].Usage != nil {
+		t.Errorf("Usage = %+v, want nil", events[0].Usage)
+	}
+	if events[0].MessageID != "msg_1" {
+		t.Errorf("MessageID = %q, want %q", events[0].MessageID, "msg_1")
+	}
+}
+
+func Test_UsageTracker_DeduplicatesByMessage(t *testing.T) {
+	lines := []string{
+		// The CLI repeats a message's usage for every content block line.
+		`{"type":"assistant","message":{"id":"msg_1","content":[{"type":"text","text":"a"}],"usage":{"input_tokens":100,"output_tokens":5}}}`,
+		`{"type":"assistant","message":{"id":"msg_1","content":[{"type":"tool_use","name":"Read"}],"usage":{"input_tokens":100,"output_tokens":50}}}`,
+		`{"type":"user","message":{"content":[{"type":"tool_result","content":"ok"}]}}`,
+		`{"type":"assistant","message":{"id":"msg_2","content":[{"type":"text","text":"b"}],"usage":{"input_tokens":200,"output_tokens":10}}}`,
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"c"}],"usage":{"input_tokens":1,"output_tokens":1}}}`,
+	}
+
+	var tracker parser.UsageTracker
+	counter := newCounter()
+	changes := 0
+	for _, line := range lines {
+		for _, evt := range parser.ParseStreamLine(line, counter) {
+			if tracker.Observe(evt) {
+				changes++
+			}
+		}
+	}
+
+	if changes != 4 {
+		t.Errorf("Observe() reported %d changes, want 4", changes)
+	}
+	want := model.TokenUsage{InputTokens: 301, OutputTokens: 61}
+	if got := tracker.Total(); got != want {
+		t.Errorf("Total() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_UsageTracker_CostUSD_PricesEachMessageByTier(t *testing.T) {
+	lines := []string{
+		`{"type":"assistant","message":{"id":"msg_1","model":"claude-opus-4","content":[{"type":"text","text":"a"}],"usage":{"input_tokens":1000000}}}`,
+		// A subagent's message on another tier.
+		`{"type":"assistant","parent_tool_use_id":"task_1","message":{"id":"msg_2","model":"claude-haiku-4-5","content":[{"type":"text","text":"b"}],"usage":{"input_tokens":1000000}}}`,
+		// No model named: priced at the fallback.
+		`{"type":"assistant","message":{"id":"msg_3","content":[{"type":"text","text":"c"}],"usage":{"input_tokens":1000000}}}`,
+	}
+
+	var tracker parser.UsageTracker
+	for _, line := range lines {
+		for _, evt := range parser.ParseStreamLine(line, nil) {
+			tracker.Observe(evt)
+		}
+	}
+
+	// $15 for opus, $1 for haiku and $3 for the sonnet fallback.
+	if got := tracker.CostUSD(model.ModelSonnet); math.Abs(got-19) > 1e-9 {
+		t.Errorf("CostUSD() = %v, want 19", got)
+	}
+}
+
+func Test_ToolTimer_PairsInOrder(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	use := func(ms int) model.ParsedEvent {
+		return model.ParsedEvent{Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, Time: at(ms)}
+	}
+	result := func(ms int) model.ParsedEvent {
+		return model.ParsedEvent{Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, Time: at(ms)}
+	}
+
+	events := []model.ParsedEvent{
+		use(0),
+		use(10),
+		{Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Time: at(20)},
+		result(250),
+		result(400),
+		result(500), // unmatched
+		use(600),
+		{Type: model.EventTypeUser, Subtype: model.SubtypeToolResult}, // no time
+	}
+	var timer parser.ToolTimer
+	for i := range events {
+		timer.Observe(&events[i])
+	}
+
+	want := []int64{0, 0, 0, 250, 390, 0, 0, 0}
+	for i, evt := range events {
+		if evt.DurationMS != want[i] {
+			t.Errorf("events[%d].DurationMS = %d, want %d", i, evt.DurationMS, want[i])
+		}
+	}
+}
+
+func Test_ToolTimer_PairsByToolUseID(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	events := []model.ParsedEvent{
+		{Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolUseID: "a", Time: at(0)},
+		{Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolUseID: "b", Time: at(5)},
+		// Parallel calls finish out of order.
+		{Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "b", Time: at(105)},
+		{Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "a", Time: at(900)},
+		{Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "zzz", Time: at(950)},
+	}
+	var timer parser.ToolTimer
+	for i := range events {
+		timer.Observe(&events[i])
+	}
+
+	want := []int64{0, 0, 100, 900, 0}
+	for i, evt := range events {
+		if evt.DurationMS != want[i] {
+			t.Errorf("events[%d].DurationMS = %d, want %d", i, evt.DurationMS, want[i])
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Tool use IDs
+// ---------------------------------------------------------------------------
+
+func Test_ParseStreamLine_ToolUseIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		subtype model.EventSubtype
+		wantID  string
+	}{
+		{
+			name:    "tool_use block id",
+			line:    `{"type":"assistant","message":{"content":[{"type":"tool_use","id":"toolu_01","name":"Task","input":{}}]}}`,
+			subtype: model.SubtypeToolUse,
+			wantID:  "toolu_01",
+		},
+		{
+			name:    "tool_result tool_use_id",
+			line:    `{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_01","content":"done"}]}}`,
+			subtype: model.SubtypeToolResult,
+			wantID:  "toolu_01",
+		},
+		{
+			name:    "streamed tool start id",
+			line:    `{"type":"stream_event","event":{"type":"content_block_start","content_block":{"type":"tool_use","id":"toolu_02","name":"Read"}}}`,
+			subtype: model.SubtypeToolStart,
+			wantID:  "toolu_02",
+		},
+		{
+			name:    "missing id",
+			line:    `{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Read"}]}}`,
+			subtype: model.SubtypeToolUse,
+			wantID:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := parser.ParseStreamLine(tt.line, newCounter())
+			assertEventCount(t, events, 1)
+			assertEventSubtype(t, events[0], tt.subtype)
+			if events[0].ToolUseID != tt.wantID {
+				t.Errorf("ToolUseID = %q, want %q", events[0].ToolUseID, tt.wantID)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Subagent events
+// ---------------------------------------------------------------------------
+
+func Test_ParseStreamLine_ParentToolUseID(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantCount int
+		want      string
+	}{
+		{
+			name:      "subagent assistant message",
+			line:      `{"type":"assistant","parent_tool_use_id":"toolu_task","message":{"id":"msg_9","model":"claude-sonnet-4-5","content":[{"type":"text","text":"a"},{"type":"tool_use","id":"toolu_x","name":"WebSearch","input":{}}]}}`,
+			wantCount: 2,
+			want:      "toolu_task",
+		},
+		{
+			name:      "subagent tool result",
+			line:      `{"type":"user","parent_tool_use_id":"toolu_task","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_x","content":"r"}]}}`,
+			wantCount: 1,
+			want:      "toolu_task",
+		},
+		{
+			name:      "main agent null parent",
+			line:      `{"type":"assistant","parent_tool_use_id":null,"message":{"content":[{"type":"text","text":"a"}]}}`,
+			wantCount: 1,
+			want:      "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := parser.ParseStreamLine(tt.line, newCounter())
+			assertEventCount(t, events, tt.wantCount)
+			for i, evt := range events {
+				if evt.ParentToolUseID != tt.want {
+					t.Errorf("events[%d].ParentToolUseID = %q, want %q", i, evt.ParentToolUseID, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_ParseStreamLine_MessageMetaOnEveryBlock(t *testing.T) {
+	line := `{"type":"assistant","message":{"id":"msg_9","model":"claude-haiku-4-5","content":[{"type":"text","text":"a"},{"type":"text","text":"b"}]}}`
+	events := parser.ParseStreamLine(line, newCounter())
+
+	assertEventCount(t, events, 2)
+	for i, evt := range events {
+		if evt.MessageID != "msg_9" || evt.MessageModel != "claude-haiku-4-5" {
+			t.Errorf("events[%d] MessageID/MessageModel = %q/%q, want msg_9/claude-haiku-4-5", i, evt.MessageID, evt.MessageModel)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Test: Assistant events — empty or missing content
 // ---------------------------------------------------------------------------
@@ -0,0 +1,164 @@
+// Package queue schedules research jobs onto a bounded number of concurrent
+// runners in first-in, first-out order.
+package queue
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/jamesprial/research-dashboard/internal/jobstore"
+)
+
+// ErrNotQueued is returned when an operation targets a job that is not
+// waiting in the queue (it has already started, finished, or never existed).
+var ErrNotQueued = errors.New("job is not queued")
+
+// RunFunc executes a single job to completion. It is called on its own
+// goroutine once a worker slot is available.
+type RunFunc func(job *jobstore.Job)
+
+// Queue holds pending jobs and dispatches them to at most MaxConcurrent
+// simultaneous RunFunc invocations. Each pending job's 1-based position is
+// mirrored onto the job via SetQueuePosition whenever the queue changes.
+type Queue struct {
+	mu      sync.Mutex
+	pending []*jobstore.Job
+	running int
+	max     int
+	run     RunFunc
+}
+
+// New returns a Queue that runs at most maxConcurrent jobs at once using run.
+// Values of maxConcurrent below 1 are treated as 1.
+func New(maxConcurrent int, run RunFunc) *Queue {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &Queue{max: maxConcurrent, run: run}
+}
+
+// MaxConcurrent returns the number of jobs that may run at once.
+func (q *Queue) MaxConcurrent() int {
+	return q.max
+}
+
+// Enqueue appends job to the back of the queue and starts it immediately if a
+// worker slot is free. It returns the job's 1-based queue position, or 0 if
+// the job was started right away.
+func (q *Queue) Enqueue(job *jobstore.Job) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = append(q.pending, job)
+	q.dispatchLocked()
+	return q.positionLocked(job.ID())
+}
+
+// Remove drops the job with the given id from the queue. It returns false if
+// the job was not waiting in the queue.
+func (q *Queue) Remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexLocked(id)
+	if i < 0 {
+		return false
+	}
+	job := q.pending[i]
+	q.pending = append(q.pending[:i], q.pending[i+1:]...)
+	job.SetQueuePosition(0)
+	q.renumberLocked()
+	return true
+}
+
+// Move repositions a queued job to the given 1-based position. Positions past
+// the end of the queue move the job to the back. It returns ErrNotQueued if
+// the job is not waiting in the queue.
+func (q *Queue) Move(id string, position int) error {
+	if position < 1 {
+		return errors.New("position must be at least 1")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexLocked(id)
+	if i < 0 {
+		return ErrNotQueued
+	}
+	job := q.pending[i]
+	q.pending = append(q.pending[:i], q.pending[i+1:]...)
+
+	target := min(position-1, len(q.pending))
+	q.pending = append(q.pending, nil)
+	copy(q.pending[target+1:], q.pending[target:])
+	q.pending[target] = job
+
+	q.renumberLocked()
+	return nil
+}
+
+// Len returns the number of jobs waiting in the queue.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Running returns the number of jobs currently executing.
+func (q *Queue) Running() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.running
+}
+
+// dispatchLocked starts pending jobs while worker slots are free. Jobs that
+// reached a terminal state while queued (e.g. cancelled) are discarded.
+// Caller must hold q.mu.
+func (q *Queue) dispatchLocked() {
+	for q.running < q.max && len(q.pending) > 0 {
+		job := q.pending[0]
+		q.pending = q.pending[1:]
+		job.SetQueuePosition(0)
+		if job.Status().IsTerminal() {
+			continue
+		}
+
+		q.running++
+		go func() {
+			q.run(job)
+
+			q.mu.Lock()
+			q.running--
+			q.dispatchLocked()
+			q.mu.Unlock()
+		}()
+	}
+	q.renumberLocked()
+}
+
+// renumberLocked mirrors each pending job's 1-based position onto the job.
+// Caller must hold q.mu.
+func (q *Queue) renumberLocked() {
+	for i, job := range q.pending {
+		job.SetQueuePosition(i + 1)
+	}
+}
+
+// indexLocked returns the index of the pending job with the given id, or -1.
+// Caller must hold q.mu.
+func (q *Queue) indexLocked(id string) int {
+	for i, job := range q.pending {
+		if job.ID() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// positionLocked returns the 1-based position of the job with the given id,
+// or 0 if it is not pending.
+// Caller must hold q.mu.
+func (q *Queue) positionLocked(id string) int {
+	return q.indexLocked(id) + 1
+}
@@ -0,0 +1,201 @@
+package queue_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/jobstore"
+	"github.com/jamesprial/research-dashboard/internal/model"
+	"github.com/jamesprial/research-dashboard/internal/queue"
+)
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+// gatedRunner records the order in which jobs start and blocks each run until
+// release is called for it.
+type gatedRunner struct {
+	mu      sync.Mutex
+	started []string
+	gates   map[string]chan struct{}
+	startCh chan string
+}
+
+func newGatedRunner() *gatedRunner {
+	return &gatedRunner{
+		gates:   make(map[string]chan struct{}),
+		startCh: make(chan string, 16),
+	}
+}
+
+func (g *gatedRunner) gate(id string) chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ch, ok := g.gates[id]
+	if !ok {
+		ch = make(chan struct{})
+		g.gates[id] = ch
+	}
+	return ch
+}
+
+func (g *gatedRunner) run(job *jobstore.Job) {
+	g.mu.Lock()
+	g.started = append(g.started, job.ID())
+	g.mu.Unlock()
+	g.startCh <- job.ID()
+	<-g.gate(job.ID())
+}
+
+func (g *gatedRunner) release(id string) {
+	close(g.gate(id))
+}
+
+func (g *gatedRunner) waitStart(t *testing.T) string {
+	t.Helper()
+	select {
+	case id := <-g.startCh:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a job to start")
+		return ""
+	}
+}
+
+func (g *gatedRunner) assertNoStart(t *testing.T) {
+	t.Helper()
+	select {
+	case id := <-g.startCh:
+		t.Fatalf("job %q started unexpectedly", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newJobs(s *jobstore.Store, n int) []*jobstore.Job {
+	jobs := make([]*jobstore.Job, n)
+	for i := range jobs {
+		jobs[i] = s.Create(fmt.Sprintf("job-%d", i), "query", "opus", 10, "/tmp")
+	}
+	return jobs
+}
+
+// ---------------------------------------------------------------------------
+// Tests
+// ---------------------------------------------------------------------------
+
+func Test_Queue_BoundsConcurrencyInFIFOOrder(t *testing.T) {
+	g := newGatedRunner()
+	q := queue.New(2, g.run)
+	jobs := newJobs(jobstore.NewStore(), 4)
+
+	wantPos := []int{0, 0, 1, 2}
+	for i, j := range jobs {
+		if got := q.Enqueue(j); got != wantPos[i] {
+			t.Errorf("Enqueue(%s) = %d, want %d", j.ID(), got, wantPos[i])
+		}
+	}
+
+	first, second := g.waitStart(t), g.waitStart(t)
+	g.assertNoStart(t)
+	if q.Running() != 2 || q.Len() != 2 {
+		t.Fatalf("Running()=%d Len()=%d, want 2 and 2", q.Running(), q.Len())
+	}
+	if jobs[2].QueuePosition() != 1 || jobs[3].QueuePosition() != 2 {
+		t.Errorf("queue positions = %d,%d, want 1,2", jobs[2].QueuePosition(), jobs[3].QueuePosition())
+	}
+
+	g.release(first)
+	if got := g.waitStart(t); got != "job-2" {
+		t.Errorf("next started = %q, want job-2", got)
+	}
+	if jobs[2].QueuePosition() != 0 || jobs[3].QueuePosition() != 1 {
+		t.Errorf("queue positions after dispatch = %d,%d, want 0,1", jobs[2].QueuePosition(), jobs[3].QueuePosition())
+	}
+
+	g.release(second)
+	if got := g.waitStart(t); got != "job-3" {
+		t.Errorf("next started = %q, want job-3", got)
+	}
+	g.release("job-2")
+	g.release("job-3")
+}
+
+func Test_Queue_Move(t *testing.T) {
+	g := newGatedRunner()
+	q := queue.New(1, g.run)
+	jobs := newJobs(jobstore.NewStore(), 4)
+	for _, j := range jobs {
+		q.Enqueue(j)
+	}
+	running := g.waitStart(t)
+
+	if err := q.Move("job-3", 1); err != nil {
+		t.Fatalf("Move() error: %v", err)
+	}
+	want := map[string]int{"job-3": 1, "job-1": 2, "job-2": 3}
+	for _, j := range jobs[1:] {
+		if j.QueuePosition() != want[j.ID()] {
+			t.Errorf("%s QueuePosition() = %d, want %d", j.ID(), j.QueuePosition(), want[j.ID()])
+		}
+	}
+
+	if err := q.Move("job-3", 99); err != nil {
+		t.Fatalf("Move(past end) error: %v", err)
+	}
+	if jobs[3].QueuePosition() != 3 {
+		t.Errorf("job-3 QueuePosition() = %d, want 3 after moving past end", jobs[3].QueuePosition())
+	}
+
+	if err := q.Move(running, 1); !errors.Is(err, queue.ErrNotQueued) {
+		t.Errorf("Move(running job) error = %v, want ErrNotQueued", err)
+	}
+	if err := q.Move("job-1", 0); err == nil {
+		t.Error("Move(position 0) error = nil, want error")
+	}
+
+	g.release(running)
+	if got := g.waitStart(t); got != "job-1" {
+		t.Errorf("next started = %q, want job-1", got)
+	}
+	g.release("job-1")
+	g.waitStart(t)
+	g.release("job-2")
+	g.waitStart(t)
+	g.release("job-3")
+}
+
+func Test_Queue_RemoveAndSkipCancelled(t *testing.T) {
+	g := newGatedRunner()
+	q := queue.New(1, g.run)
+	jobs := newJobs(jobstore.NewStore(), 4)
+	for _, j := range jobs {
+		q.Enqueue(j)
+	}
+	running := g.waitStart(t)
+
+	if !q.Remove("job-1") {
+		t.Error("Remove(job-1) = false, want true")
+	}
+	if q.Remove("job-1") {
+		t.Error("second Remove(job-1) = true, want false")
+	}
+	if jobs[1].QueuePosition() != 0 || jobs[2].QueuePosition() != 1 {
+		t.Errorf("positions after remove = %d,%d, want 0,1", jobs[1].QueuePosition(), jobs[2].QueuePosition())
+	}
+
+	// A job cancelled without being removed is skipped at dispatch time.
+	jobs[2].Cancel()
+
+	g.release(running)
+	if got := g.waitStart(t); got != "job-3" {
+		t.Errorf("next started = %q, want job-3 (job-2 was cancelled)", got)
+	}
+	if jobs[2].Status() != model.StatusCancelled {
+		t.Errorf("job-2 Status() = %q, want cancelled", jobs[2].Status())
+	}
+	g.release("job-3")
+}
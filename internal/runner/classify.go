@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// Lower-case fragments of the messages the claude CLI and the API print for
+// failures that clients may want to handle specially.
+var (
+	authFailurePatterns = []string{
+		"invalid api key",
+		"invalid x-api-key",
+		"authentication_error",
+		"authentication failed",
+		"unauthorized",
+		"please run /login",
+		"not logged in",
+		"oauth token has expired",
+	}
+	rateLimitPatterns = []string{
+		"rate limit",
+		"rate_limit",
+		"too many requests",
+		"overloaded",
+		"usage limit",
+	}
+	networkPatterns = []string{
+		"econnreset",
+		"econnrefused",
+		"etimedout",
+		"enotfound",
+		"connection reset",
+		"connection refused",
+		"socket hang up",
+		"fetch failed",
+		"network error",
+	}
+)
+
+// resultSubtypeMaxTurns is the subtype of the result event the CLI emits when
+// the agent runs out of turns.
+const resultSubtypeMaxTurns = "error_max_turns"
+
+// runOutcome collects what is known about a finished subprocess for
+// classifyFailure.
+type runOutcome struct {
+	exitCode int
+	// result is the last result event, or nil if none was received.
+	result *model.ParsedEvent
+	// stderr is the tail of the subprocess's stderr.
+	stderr string
+	// unreadable reports that stdout could not be read as stream-json: it
+	// failed to scan, or held only lines the parser did not recognize.
+	unreadable bool
+}
+
+// classifyFailure derives the ErrorKind of a job whose subprocess did not
+// finish successfully. In order of precedence, it checks for a result event
+// reporting that max turns were reached, authentication, rate-limit and
+// network messages in stderr or the result text, and unreadable output. Anything
+// else, including death by signal, is a crash.
+func classifyFailure(o runOutcome) model.ErrorKind {
+	var resultText string
+	if o.result != nil {
+		if subtype, _ := o.result.Raw["subtype"].(string); subtype == resultSubtypeMaxTurns {
+			return model.ErrorKindMaxTurns
+		}
+		resultText = o.result.Text
+	}
+
+	text := strings.ToLower(o.stderr + "\n" + resultText)
+	switch {
+	case containsAny(text, authFailurePatterns):
+		return model.ErrorKindAuthFailed
+	case containsAny(text, rateLimitPatterns):
+		return model.ErrorKindRateLimited
+	case containsAny(text, networkPatterns):
+		return model.ErrorKindNetwork
+	case o.unreadable && o.result == nil:
+		return model.ErrorKindParseFailure
+	}
+	return model.ErrorKindCrash
+}
+
+// failureMessage returns the error recorded for a failed job: the tail of
+// stderr, or a description of the failure when stderr was empty.
+func failureMessage(kind model.ErrorKind, o runOutcome) string {
+	if o.stderr != "" {
+		return o.stderr
+	}
+	switch {
+	case kind == model.ErrorKindMaxTurns:
+		return "reached max turns without finishing"
+	case o.result != nil && o.result.Text != "":
+		return o.result.Text
+	case kind == model.ErrorKindParseFailure:
+		return "subprocess output was not stream-json"
+	case o.exitCode < 0:
+		return "subprocess was killed"
+	}
+	return fmt.Sprintf("subprocess exited with code %d", o.exitCode)
+}
+
+// classifyStartError returns the ErrorKind for a subprocess that could not be
+// started.
+func classifyStartError(err error) model.ErrorKind {
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return model.ErrorKindBinaryNotFound
+	}
+	return model.ErrorKindCrash
+}
+
+// containsAny reports whether s contains any of the substrings.
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package runner
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// phaseWeights is the share of the estimated completion percentage assigned
+// to each phase, indexed like model.Phases. The weights sum to 100.
+var phaseWeights = []int{5, 45, 10, 15, 5, 20}
+
+// Subagent types dispatched by the orchestration prompt.
+const (
+	researchWorkerAgent = "research-worker"
+	sourceArchiverAgent = "source-archiver"
+)
+
+// PhaseTracker infers a job's position in the six-phase research workflow
+// from the tool activity of the orchestrating agent:
+//
+//   - the first research-worker dispatch starts broad research;
+//   - once every dispatched worker has returned, synthesis starts;
+//   - a further research-worker dispatch during synthesis starts follow-up;
+//   - a source-archiver dispatch starts archival;
+//   - a Write or Edit of report.md starts report generation.
+//
+// Phases only move forward; later phases may be entered without passing
+// through earlier ones. Events from subagents are ignored. A PhaseTracker
+// is not safe for concurrent use.
+type PhaseTracker struct {
+	current   int
+	timings   []model.PhaseTiming
+	started   []time.Time
+	finished  bool
+	completed bool
+
+	outputDirCreated bool
+	// outstanding holds the tool_use IDs of research-worker calls that have
+	// not returned yet.
+	outstanding map[string]bool
+	// dispatched and returned count research-worker calls made during the
+	// current phase.
+	dispatched, returned int
+}
+
+// NewPhaseTracker returns a tracker positioned at the start of the
+// decomposition phase at time start.
+func NewPhaseTracker(start time.Time) *PhaseTracker {
+	t := &PhaseTracker{outstanding: make(map[string]bool)}
+	t.timings = []model.PhaseTiming{{Phase: model.Phases[0], StartedAt: formatTime(start)}}
+	t.started = []time.Time{start}
+	return t
+}
+
+// Phase returns the current phase.
+func (t *PhaseTracker) Phase() model.Phase {
+	return model.Phases[t.current]
+}
+
+// Observe updates the tracker from a single event and reports whether the
+// progress it reports may have changed.
+func (t *PhaseTracker) Observe(evt model.ParsedEvent) bool {
+	if t.finished || evt.ParentToolUseID != "" {
+		return false
+	}
+	at := evt.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	switch {
+	case evt.Type == model.EventTypeAssistant && evt.Subtype == model.SubtypeToolUse:
+		return t.observeToolUse(evt, at)
+
+	case evt.Type == model.EventTypeUser && evt.Subtype == model.SubtypeToolResult:
+		if !t.outstanding[evt.ToolUseID] {
+			return false
+		}
+		delete(t.outstanding, evt.ToolUseID)
+		t.returned++
+		if len(t.outstanding) == 0 && t.Phase() == model.PhaseBroadResearch {
+			t.enter(model.PhaseSynthesis, at)
+		}
+		return true
+	}
+	return false
+}
+
+// observeToolUse handles a tool call made by the orchestrating agent.
+func (t *PhaseTracker) observeToolUse(evt model.ParsedEvent, at time.Time) bool {
+	switch evt.ToolName {
+	case "Task", "Agent":
+		agentType, _ := evt.ToolInput["subagent_type"].(string)
+		switch agentType {
+		case researchWorkerAgent:
+			switch t.Phase() {
+			case model.PhaseDecomposition:
+				t.enter(model.PhaseBroadResearch, at)
+			case model.PhaseSynthesis:
+				t.enter(model.PhaseFollowUp, at)
+			}
+			if evt.ToolUseID != "" {
+				t.outstanding[evt.ToolUseID] = true
+				t.dispatched++
+			}
+			return true
+		case sourceArchiverAgent:
+			return t.enter(model.PhaseArchival, at)
+		}
+
+	case "Write", "Edit":
+		filePath, _ := evt.ToolInput["file_path"].(string)
+		if path.Base(filePath) == "report.md" {
+			return t.enter(model.PhaseReport, at)
+		}
+
+	case "Bash":
+		command, _ := evt.ToolInput["command"].(string)
+		if !t.outputDirCreated && strings.Contains(command, "mkdir") && strings.Contains(command, model.ResearchDirPrefix) {
+			t.outputDirCreated = true
+			return true
+		}
+	}
+	return false
+}
+
+// enter moves the tracker forward to phase p at time at. It reports whether
+// the phase changed; moving backwards is ignored.
+func (t *PhaseTracker) enter(p model.Phase, at time.Time) bool {
+	next := phaseIndex(p)
+	if next <= t.current {
+		return false
+	}
+	t.closeCurrent(at)
+	t.current = next
+	t.dispatched, t.returned = len(t.outstanding), 0
+	t.timings = append(t.timings, model.PhaseTiming{Phase: p, StartedAt: formatTime(at)})
+	t.started = append(t.started, at)
+	return true
+}
+
+// Finish closes the current phase at time at. If completed is true the job
+// finished successfully and the estimated completion becomes 100%.
+func (t *PhaseTracker) Finish(at time.Time, completed bool) {
+	if t.finished {
+		return
+	}
+	t.closeCurrent(at)
+	t.finished = true
+	t.completed = completed
+}
+
+// closeCurrent records the end time of the current phase.
+func (t *PhaseTracker) closeCurrent(at time.Time) {
+	last := len(t.timings) - 1
+	ended := formatTime(at)
+	d := at.Sub(t.started[last]).Milliseconds()
+	t.timings[last].EndedAt = &ended
+	t.timings[last].DurationMS = &d
+}
+
+// Progress returns a snapshot of the tracker's state. The returned value
+// does not share memory with the tracker.
+func (t *PhaseTracker) Progress() model.Progress {
+	phases := make([]model.PhaseTiming, len(t.timings))
+	copy(phases, t.timings)
+	return model.Progress{
+		Phase:       t.Phase(),
+		PhaseNumber: t.current + 1,
+		Percent:     t.percent(),
+		Phases:      phases,
+	}
+}
+
+// percent estimates overall completion: the weights of all earlier phases
+// plus the completed fraction of the current one. It stays below 100 until
+// the job has finished successfully.
+func (t *PhaseTracker) percent() int {
+	if t.completed {
+		return 100
+	}
+	total := 0
+	for _, w := range phaseWeights[:t.current] {
+		total += w
+	}
+	var fraction float64
+	switch t.Phase() {
+	case model.PhaseDecomposition:
+		if t.outputDirCreated {
+			fraction = 0.5
+		}
+	case model.PhaseBroadResearch, model.PhaseFollowUp:
+		if t.dispatched > 0 {
+			fraction = float64(t.returned) / float64(t.dispatched)
+		}
+	}
+	total += int(fraction * float64(phaseWeights[t.current]))
+	return min(total, 99)
+}
+
+// phaseIndex returns the position of p in model.Phases.
+func phaseIndex(p model.Phase) int {
+	for i, q := range model.Phases {
+		if q == p {
+			return i
+		}
+	}
+	return 0
+}
+
+// formatTime renders t as an RFC 3339 string in UTC.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,144 @@
+package runner_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/model"
+	"github.com/jamesprial/research-dashboard/internal/runner"
+)
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+var trackerStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at returns trackerStart plus the given number of seconds.
+func at(sec int) time.Time {
+	return trackerStart.Add(time.Duration(sec) * time.Second)
+}
+
+// toolUse builds a main-agent tool_use event.
+func toolUse(sec int, name, id string, input map[string]any) model.ParsedEvent {
+	return model.ParsedEvent{
+		Type:      model.EventTypeAssistant,
+		Subtype:   model.SubtypeToolUse,
+		ToolName:  name,
+		ToolUseID: id,
+		ToolInput: input,
+		Time:      at(sec),
+	}
+}
+
+// dispatch builds a Task tool_use event for the given subagent type.
+func dispatch(sec int, id, agentType string) model.ParsedEvent {
+	return toolUse(sec, "Task", id, map[string]any{"subagent_type": agentType})
+}
+
+// toolResult builds a main-agent tool_result event.
+func toolResult(sec int, id string) model.ParsedEvent {
+	return model.ParsedEvent{
+		Type:      model.EventTypeUser,
+		Subtype:   model.SubtypeToolResult,
+		ToolUseID: id,
+		Time:      at(sec),
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: PhaseTracker
+// ---------------------------------------------------------------------------
+
+func Test_PhaseTracker_FullWorkflow(t *testing.T) {
+	tracker := runner.NewPhaseTracker(at(0))
+
+	steps := []struct {
+		name        string
+		evt         model.ParsedEvent
+		wantChanged bool
+		wantPhase   model.Phase
+		wantPercent int
+	}{
+		{"text is ignored", model.ParsedEvent{Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Time: at(1)}, false, model.PhaseDecomposition, 0},
+		{"mkdir output dir", toolUse(2, "Bash", "b1", map[string]any{"command": "mkdir -p ./research-ai-20260101-000000/sources"}), true, model.PhaseDecomposition, 2},
+		{"first worker", dispatch(10, "w1", "research-worker"), true, model.PhaseBroadResearch, 5},
+		{"second worker", dispatch(10, "w2", "research-worker"), true, model.PhaseBroadResearch, 5},
+		{"subagent activity ignored", model.ParsedEvent{Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Write", ToolInput: map[string]any{"file_path": "report.md"}, ParentToolUseID: "w1"}, false, model.PhaseBroadResearch, 5},
+		{"first worker returns", toolResult(60, "w1"), true, model.PhaseBroadResearch, 27},
+		{"unrelated result", toolResult(61, "b1"), false, model.PhaseBroadResearch, 27},
+		{"last worker returns", toolResult(90, "w2"), true, model.PhaseSynthesis, 50},
+		{"follow-up worker", dispatch(100, "w3", "research-worker"), true, model.PhaseFollowUp, 60},
+		{"follow-up returns", toolResult(130, "w3"), true, model.PhaseFollowUp, 75},
+		{"archiver", dispatch(140, "a1", "source-archiver"), true, model.PhaseArchival, 75},
+		{"report written", toolUse(150, "Write", "r1", map[string]any{"file_path": "/tmp/research-ai/report.md"}), true, model.PhaseReport, 80},
+		{"late worker does not rewind", dispatch(160, "w4", "research-worker"), true, model.PhaseReport, 80},
+	}
+	for _, step := range steps {
+		changed := tracker.Observe(step.evt)
+		p := tracker.Progress()
+		if changed != step.wantChanged || p.Phase != step.wantPhase || p.Percent != step.wantPercent {
+			t.Errorf("%s: changed/phase/percent = %v/%q/%d, want %v/%q/%d",
+				step.name, changed, p.Phase, p.Percent, step.wantChanged, step.wantPhase, step.wantPercent)
+		}
+	}
+
+	tracker.Finish(at(200), true)
+	p := tracker.Progress()
+	if p.Percent != 100 || p.PhaseNumber != 6 {
+		t.Errorf("after Finish: percent/phase_number = %d/%d, want 100/6", p.Percent, p.PhaseNumber)
+	}
+	if len(p.Phases) != 6 {
+		t.Fatalf("len(Phases) = %d, want 6", len(p.Phases))
+	}
+	wantDurations := []int64{10_000, 80_000, 10_000, 40_000, 10_000, 50_000}
+	for i, timing := range p.Phases {
+		if timing.Phase != model.Phases[i] {
+			t.Errorf("Phases[%d].Phase = %q, want %q", i, timing.Phase, model.Phases[i])
+		}
+		if timing.DurationMS == nil || *timing.DurationMS != wantDurations[i] {
+			t.Errorf("Phases[%d].DurationMS = %v, want %d", i, timing.DurationMS, wantDurations[i])
+		}
+	}
+}
+
+func Test_PhaseTracker_SkippedFollowUpAndFailure(t *testing.T) {
+	tracker := runner.NewPhaseTracker(at(0))
+	tracker.Observe(dispatch(1, "w1", "research-worker"))
+	tracker.Observe(toolResult(5, "w1"))
+	tracker.Observe(dispatch(6, "a1", "source-archiver"))
+
+	p := tracker.Progress()
+	if p.Phase != model.PhaseArchival || p.PhaseNumber != 5 {
+		t.Errorf("phase = %q (#%d), want archival (#5)", p.Phase, p.PhaseNumber)
+	}
+	got := make([]model.Phase, 0, len(p.Phases))
+	for _, timing := range p.Phases {
+		got = append(got, timing.Phase)
+	}
+	want := []model.Phase{model.PhaseDecomposition, model.PhaseBroadResearch, model.PhaseSynthesis, model.PhaseArchival}
+	if len(got) != len(want) {
+		t.Fatalf("phases = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("phases = %v, want %v", got, want)
+			break
+		}
+	}
+	if last := p.Phases[len(p.Phases)-1]; last.EndedAt != nil {
+		t.Errorf("current phase EndedAt = %v, want nil", *last.EndedAt)
+	}
+
+	tracker.Finish(at(10), false)
+	p = tracker.Progress()
+	if p.Percent >= 100 {
+		t.Errorf("percent after failure = %d, want < 100", p.Percent)
+	}
+	if last := p.Phases[len(p.Phases)-1]; last.EndedAt == nil {
+		t.Error("current phase EndedAt = nil after Finish, want set")
+	}
+	if tracker.Observe(dispatch(11, "w2", "research-worker")) {
+		t.Error("Observe() after Finish = true, want false")
+	}
+}
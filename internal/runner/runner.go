@@ -1,27 +1,26 @@
-// Package runner manages the subprocess lifecycle for research jobs executed
-// via the claude CLI.
+// Package runner manages the lifecycle of research jobs, executed via the
+// claude CLI or another backend.
 package runner
 
 import (
 	"bufio"
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"sort"
 	"strings"
-	"sync/atomic"
-	"syscall"
+	"sync"
 	"time"
 
-	"github.com/jamesprial/research-dashboard/internal/envutil"
+	"github.com/jamesprial/research-dashboard/internal/backend"
 	"github.com/jamesprial/research-dashboard/internal/jobstore"
 	"github.com/jamesprial/research-dashboard/internal/model"
 	"github.com/jamesprial/research-dashboard/internal/parser"
+	"github.com/jamesprial/research-dashboard/internal/pathutil"
 )
 
 // PromptPrefix is prepended to every research query before it is passed to
@@ -31,16 +30,60 @@ import (
 //go:embed prompt.md
 var PromptPrefix string
 
-// Runner manages the lifecycle of claude CLI subprocesses for research jobs.
+// OutputDirPlaceholder marks where PromptPrefix names the job's output
+// directory. Run replaces it with the directory assigned to the job.
+const OutputDirPlaceholder = "{{output_dir}}"
+
+// unassignedOutputDir replaces OutputDirPlaceholder for backends that do not
+// write output directories.
+const unassignedOutputDir = "./research-{topic-slug}-{YYYYMMDD-HHMMSS}"
+
+// FollowUpPrefix is prepended to the query of jobs that resume an existing
+// agent session. The session already carries the orchestration prompt, so
+// this only explains how to revise the earlier research.
+//
+//go:embed followup.md
+var FollowUpPrefix string
+
+// RetryPrefix is prepended to the query of a retried job that resumes the
+// session its failed attempt started, asking the agent to carry on rather
+// than start over.
+//
+//go:embed retry.md
+var RetryPrefix string
+
+// DefaultTermGrace is how long a cancelled subprocess is given to exit after
+// SIGTERM before its whole process group is killed.
+const DefaultTermGrace = backend.DefaultTermGrace
+
+// Cancellation causes used when the runner itself stops a job.
+var (
+	// errBudgetExceeded is used when a job crosses its token or cost ceiling.
+	errBudgetExceeded = errors.New("budget exceeded")
+	// errTimedOut is used when a job runs past its wall-clock timeout.
+	errTimedOut = errors.New("timed out")
+)
+
+// shutdownError is recorded on jobs stopped because the server shut down.
+const shutdownError = "interrupted: server shut down while the job was running"
+
+// Runner manages the lifecycle of research jobs run by a backend.
 type Runner struct {
 	// ClaudePath is the path to the claude binary. When empty, "claude" is
 	// used, which relies on the PATH environment variable.
 	ClaudePath string
-}
 
-// DirClaimer atomically claims a research output directory.
-type DirClaimer interface {
-	ClaimDir(dir string) bool
+	// TermGrace is how long the subprocess group may take to exit after
+	// SIGTERM before it is sent SIGKILL.
+	TermGrace time.Duration
+
+	// Backend runs the jobs. When nil, the claude CLI at ClaudePath is
+	// used, with TermGrace.
+	Backend backend.Backend
+
+	// WatchInterval is how often a job's output directory is polled for
+	// files while it runs. Non-positive values select DefaultWatchInterval.
+	WatchInterval time.Duration
 }
 
 // New creates a Runner. If claudePath is empty, the binary name defaults to
@@ -49,73 +92,171 @@ func New(claudePath string) *Runner {
 	if claudePath == "" {
 		claudePath = "claude"
 	}
-	return &Runner{ClaudePath: claudePath}
+	return &Runner{ClaudePath: claudePath, TermGrace: DefaultTermGrace}
 }
 
-// Run executes a research job as a subprocess. It:
-//  1. Sets job status to running
-//  2. Snapshots existing research-* directories in job's cwd
-//  3. Builds and starts the claude command
-//  4. Reads stdout line-by-line, parsing via parser.ParseStreamLine
-//  5. Appends events to job, captures session_id and result_info
-//  6. After exit: diffs dirs to find new output, claims it via store
-//  7. Sets final status (completed/failed) and error if any
-func (r *Runner) Run(ctx context.Context, job *jobstore.Job, store *jobstore.Store) error {
-	job.SetStatus(model.StatusRunning)
-
-	cwd := job.CWD()
+// Capabilities reports the optional features of the runner's backend.
+func (r *Runner) Capabilities() backend.Capabilities {
+	return r.backend().Capabilities()
+}
 
-	// Snapshot existing research-* directories before the subprocess runs.
-	preDirs := researchDirs(cwd)
-	slog.Debug("runner: pre-run directory snapshot", "job_id", job.ID(), "count", len(preDirs))
+// backend returns the Backend that runs jobs.
+func (r *Runner) backend() backend.Backend {
+	if r.Backend != nil {
+		return r.Backend
+	}
+	return &backend.Claude{Path: r.ClaudePath, TermGrace: r.TermGrace}
+}
 
-	// Build the command arguments.
-	query := fmt.Sprintf("%s%s", PromptPrefix, job.Query())
-	args := []string{
-		"-p",
-		"--dangerously-skip-permissions",
-		"--verbose",
-		"--output-format", "stream-json",
-		"--model", job.Model(),
-		"--max-turns", fmt.Sprintf("%d", job.MaxTurns()),
-		query,
+// watchInterval returns how often output directories are polled.
+func (r *Runner) watchInterval() time.Duration {
+	if r.WatchInterval > 0 {
+		return r.WatchInterval
 	}
+	return DefaultWatchInterval
+}
 
-	slog.Debug("runner: starting subprocess", "job_id", job.ID(), "claude_path", r.ClaudePath, "cwd", cwd, "model", job.Model())
+// Run executes a research job on the runner's backend. It:
+//  1. Sets job status to running (or returns early if already cancelled)
+//  2. Assigns the job's output directory, unless it already has one (jobs
+//     created by the server do)
+//  3. Builds the prompt, naming the output directory in place of
+//     OutputDirPlaceholder, and starts the backend, which for the claude
+//     CLI runs the command in its own process group
+//  4. Reads stdout line-by-line, parsing via parser.ParseStreamLine
+//  5. Stamps events with their receive time and tool results with the
+//     duration of their call, appends them to the job, and captures
+//     session_id and result_info
+//  6. Infers the workflow phase from tool activity, recording progress on
+//     the job and a system "phase" event on every phase change
+//  7. Sets final status (completed/failed/cancelled) and error if any,
+//     classifying failures with an ErrorKind (see classifyFailure)
+//  8. Records the outcome in the research.json manifest of the output
+//     directory (see jobstore.WriteManifest)
+//
+// Lines the subprocess writes to stderr are recorded as they arrive as
+// EventTypeStderr events, up to a size limit, and the tail of stderr becomes
+// the error of a failed job. The output directory is polled every
+// WatchInterval while the run goes on, and each file that appears in it, or
+// in its sources subdirectory, or that changes, is recorded as an
+// EventTypeFile event.
+//
+// Jobs with a ResumeSessionID continue that session (via --resume for the
+// claude CLI) using FollowUpPrefix instead of PromptPrefix. A job whose
+// output directory is already set (e.g. a follow-up writing into its
+// parent's directory) keeps it.
+//
+// A failure whose kind the job's RetryPolicy retries returns the job to the
+// pending state with a system "retry" event instead of failing it; the
+// caller is responsible for running it again once its RetryAt has passed.
+// A retry that follows an attempt which recorded a session ID resumes that
+// session using RetryPrefix. Event indexes and token usage continue from the
+// earlier attempts, so budgets apply across all of them. Backends that
+// cannot resume sessions start every run afresh with PromptPrefix.
+//
+// Cancelling ctx cancels the backend's run, which for the claude CLI sends
+// SIGTERM to the subprocess group, escalating to SIGKILL after TermGrace. A
+// job cancelled through Job.Cancel records a final "cancelled" system event
+// as it is marked cancelled; one stopped by ctx alone, as at server shutdown,
+// fails with ErrorKindInterrupted.
+//
+// Token usage reported on assistant events is accumulated as it streams in.
+// If the job's MaxTokens or MaxCostUSD ceiling is crossed, the subprocess is
+// terminated the same way and the job fails with ErrorKindBudgetExceeded.
+// Likewise a job running past its Timeout fails with ErrorKindTimeout.
+func (r *Runner) Run(ctx context.Context, job *jobstore.Job, store *jobstore.Store) error {
+	if ctx.Err() != nil || !job.TryStart() {
+		slog.Info("runner: job cancelled before start", "job_id", job.ID())
+		return nil
+	}
+	started := time.Now()
+
+	// runCtx is additionally cancelled, with errBudgetExceeded as the cause,
+	// when the job crosses its budget, or with errTimedOut once its timeout
+	// elapses.
+	runCtx, stopRun := context.WithCancelCause(ctx)
+	defer stopRun(nil)
+	timeout := job.Timeout()
+	if timeout > 0 {
+		var stopTimer context.CancelFunc
+		runCtx, stopTimer = context.WithTimeoutCause(runCtx, timeout, errTimedOut)
+		defer stopTimer()
+	}
 
-	cmd := exec.CommandContext(ctx, r.ClaudePath, args...)
+	cwd := job.CWD()
+	b := r.backend()
+	caps := b.Capabilities()
+
+	// Jobs created by the server already have an output directory; others
+	// are assigned one now.
+	outputDir := unassignedOutputDir
+	if caps.OutputDir {
+		outputDir = promptPath(cwd, store.AssignOutputDir(job))
+	}
 
-	// Send SIGTERM on context cancellation, then wait up to 10s for exit.
-	cmd.Cancel = func() error {
-		if cmd.Process != nil {
-			return cmd.Process.Signal(syscall.SIGTERM)
-		}
-		return nil
+	// Build the prompt.
+	prefix := PromptPrefix
+	resumeID := job.ResumeSessionID()
+	switch sessionID := job.SessionID(); {
+	case !caps.Resume:
+		resumeID = ""
+	case job.Attempt() > 1 && sessionID != "":
+		// A retry continues the session of its failed attempt.
+		prefix = RetryPrefix
+		resumeID = sessionID
+	case resumeID != "":
+		prefix = FollowUpPrefix
 	}
-	cmd.WaitDelay = 10 * time.Second
+	prefix = strings.ReplaceAll(prefix, OutputDirPlaceholder, outputDir)
+
+	// Record stderr lines as events as they arrive, and keep the tail to
+	// report on failure. The job numbers events as it records them. The
+	// backend may write stderr on its own goroutine, so emitMu keeps the
+	// events of one stdout line, recorded by the loop below, together.
+	var emitMu sync.Mutex
+	stderr := newStderrLog(func(line string) {
+		emitMu.Lock()
+		defer emitMu.Unlock()
+		job.AddEvent(stderrEvent(line, time.Now()))
+	})
 
-	// Use a filtered environment (strips CLAUDE_* variables).
-	cmd.Env = envutil.FilteredEnv()
-	cmd.Dir = cwd
+	// Files already in the output directory, e.g. those of a follow-up's
+	// parent, are not reported.
+	var watcher *fileWatcher
+	if caps.OutputDir && job.OutputDir() != "" {
+		watcher = newFileWatcher(job.OutputDir())
+	}
 
-	// Capture stderr separately so we can report it on failure.
-	var stderrBuf strings.Builder
-	cmd.Stderr = &stderrBuf
+	slog.Debug("runner: starting run", "job_id", job.ID(), "backend", b.Name(), "cwd", cwd, "model", job.Model(), "resume", resumeID)
 
-	stdout, err := cmd.StdoutPipe()
+	execution, err := b.Start(runCtx, backend.Spec{
+		Dir:             cwd,
+		Prompt:          prefix + job.Query(),
+		Model:           job.Model(),
+		MaxTurns:        job.MaxTurns(),
+		ResumeSessionID: resumeID,
+		Stderr:          stderr,
+	})
 	if err != nil {
-		return fmt.Errorf("runner: failed to create stdout pipe: %w", err)
+		failOrRetry(job, classifyStartError(err), err.Error())
+		return fmt.Errorf("runner: failed to start %s: %w", b.Name(), err)
 	}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("runner: failed to start claude subprocess: %w", err)
+	slog.Info("runner: run started", "job_id", job.ID(), "backend", b.Name())
+
+	// Report files as they are written to the output directory.
+	stopWatch := func() {}
+	if watcher != nil {
+		stopWatch = watcher.watch(r.watchInterval(), func(c fileChange) {
+			emitMu.Lock()
+			defer emitMu.Unlock()
+			job.AddEvent(fileEvent(c, time.Now()))
+			slog.Debug("runner: output file written", "job_id", job.ID(), "path", c.Path, "created", c.Created)
+		})
 	}
 
-	slog.Info("runner: subprocess started", "job_id", job.ID(), "pid", cmd.Process.Pid)
-
 	// Read stdout line-by-line with a 512 KB scanner buffer.
-	var counter atomic.Int64
-	scanner := bufio.NewScanner(stdout)
+	scanner := bufio.NewScanner(execution.Stdout())
 	const bufSize = 512 * 1024
 	scanner.Buffer(make([]byte, bufSize), bufSize)
 
@@ -124,12 +265,58 @@ func (r *Runner) Run(ctx context.Context, job *jobstore.Job, store *jobstore.Sto
 	// when the research completed successfully and a result was emitted.
 	gotResult := false
 	resultIsError := false
+	var lastResult model.ParsedEvent
+
+	// Track whether stdout held any stream-json at all, to tell a broken or
+	// wrong binary from a crash.
+	sawRaw, sawStructured := false, false
+
+	// Usage of earlier attempts counts towards the budget.
+	var usage parser.UsageTracker
+	baseUsage, baseCost := job.Usage()
+	budgetMsg := ""
+
+	var tools parser.ToolTimer
+	phases := NewPhaseTracker(time.Now())
+	job.SetProgress(phases.Progress())
 
 	for scanner.Scan() {
+		emitMu.Lock()
 		line := scanner.Text()
-		events := parser.ParseStreamLine(line, &counter)
+		events := parser.ParseStreamLine(line, nil)
+		received := time.Now()
 		for _, evt := range events {
-			job.AddEvent(evt)
+			evt.Time = received
+			tools.Observe(&evt)
+			evt.Index = job.AddEvent(evt)
+			if evt.Type == model.EventTypeRaw {
+				sawRaw = true
+			} else {
+				sawStructured = true
+			}
+
+			// Track workflow progress, announcing phase changes as events.
+			prevPhase := phases.Phase()
+			if phases.Observe(evt) {
+				progress := phases.Progress()
+				job.SetProgress(progress)
+				if progress.Phase != prevPhase {
+					job.AddEvent(phaseEvent(progress, received))
+					slog.Debug("runner: phase changed", "job_id", job.ID(), "phase", progress.Phase)
+				}
+			}
+
+			// Accumulate live usage and enforce the job's budget.
+			if usage.Observe(evt) {
+				total := baseUsage.Add(usage.Total())
+				cost := baseCost + usage.CostUSD(model.ModelName(job.Model()))
+				job.SetUsage(total, cost)
+				if msg := checkBudget(job, total, cost); msg != "" && budgetMsg == "" {
+					budgetMsg = msg
+					slog.Warn("runner: job exceeded its budget", "job_id", job.ID(), "reason", msg)
+					stopRun(errBudgetExceeded)
+				}
+			}
 
 			// Capture session_id from system events.
 			if evt.Type == model.EventTypeSystem && evt.Raw != nil {
@@ -145,6 +332,7 @@ func (r *Runner) Run(ctx context.Context, job *jobstore.Job, store *jobstore.Sto
 			if evt.Type == model.EventTypeResult {
 				gotResult = true
 				resultIsError = evt.IsError
+				lastResult = evt
 				slog.Debug("runner: received result event", "job_id", job.ID(), "is_error", evt.IsError)
 				if evt.Raw != nil {
 					stats := extractResultStats(evt.Raw)
@@ -155,39 +343,57 @@ func (r *Runner) Run(ctx context.Context, job *jobstore.Job, store *jobstore.Sto
 		if len(events) > 0 {
 			slog.Debug("runner: parsed events", "job_id", job.ID(), "count", len(events))
 		}
+		emitMu.Unlock()
 	}
 
-	if scanErr := scanner.Err(); scanErr != nil && scanErr != io.EOF {
+	scanErr := scanner.Err()
+	if scanErr != nil && scanErr != io.EOF {
 		slog.Warn("runner: scanner error reading stdout", "job_id", job.ID(), "err", scanErr)
 	}
 
-	// Wait for the subprocess to exit.
-	waitErr := cmd.Wait()
+	// Wait for the run to end.
+	exitCode, waitErr := execution.Wait()
+	if waitErr != nil {
+		slog.Warn("runner: error waiting for run", "job_id", job.ID(), "err", waitErr)
+	}
+	stderr.Flush()
+	stopWatch()
+
+	// Record how the run ended in the output directory's manifest.
+	if caps.OutputDir {
+		defer writeManifest(job, started)
+	}
 
-	// If the job was cancelled externally, respect that and return cleanly.
+	// Close the current phase; a successful finish completes the progress.
+	defer func() {
+		phases.Finish(time.Now(), job.Status() == model.StatusCompleted)
+		job.SetProgress(phases.Progress())
+	}()
+
+	// If the job was cancelled, return cleanly. The backend has already
+	// cleaned up after the run. A job cancelled through Job.Cancel recorded
+	// its cancellation then; one stopped by ctx alone, i.e. at shutdown, is
+	// interrupted.
 	if job.Status() == model.StatusCancelled {
 		slog.Info("runner: job was cancelled", "job_id", job.ID())
 		return nil
 	}
-
-	// Determine exit status.
-	exitCode := 0
-	if waitErr != nil {
-		if exitErr, ok := waitErr.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			// Non-exit error (e.g. SIGTERM with WaitDelay timeout).
-			exitCode = -1
-		}
+	if ctx.Err() != nil {
+		failJob(job, model.ErrorKindInterrupted, shutdownError)
+		slog.Info("runner: job was interrupted by shutdown", "job_id", job.ID())
+		return nil
 	}
 
-	// Detect new output directory produced by the subprocess.
-	postDirs := researchDirs(cwd)
-	slog.Debug("runner: post-run directory snapshot", "job_id", job.ID(), "count", len(postDirs))
-	if newDir := detectNewOutputDir(preDirs, postDirs, store); newDir != "" {
-		// detectNewOutputDir already claimed the directory atomically.
-		job.SetOutputDir(newDir)
-		slog.Info("runner: claimed output dir", "job_id", job.ID(), "dir", newDir)
+	// If the runner stopped the job itself, fail it with a distinct error
+	// kind regardless of how the run ended.
+	switch cause := context.Cause(runCtx); {
+	case errors.Is(cause, errBudgetExceeded):
+		failJob(job, model.ErrorKindBudgetExceeded, budgetMsg)
+		return nil
+	case errors.Is(cause, errTimedOut):
+		failJob(job, model.ErrorKindTimeout, fmt.Sprintf("timed out after %s", timeout))
+		slog.Warn("runner: job timed out", "job_id", job.ID(), "timeout", timeout)
+		return nil
 	}
 
 	// A job is considered successful if:
@@ -203,13 +409,18 @@ func (r *Runner) Run(ctx context.Context, job *jobstore.Job, store *jobstore.Sto
 			slog.Info("runner: job completed", "job_id", job.ID())
 		}
 	} else {
-		job.SetStatus(model.StatusFailed)
-		errMsg := strings.TrimSpace(stderrBuf.String())
-		if errMsg == "" {
-			errMsg = fmt.Sprintf("subprocess exited with code %d", exitCode)
+		outcome := runOutcome{
+			exitCode:   exitCode,
+			stderr:     stderr.Tail(),
+			unreadable: (scanErr != nil && scanErr != io.EOF) || (sawRaw && !sawStructured),
+		}
+		if gotResult {
+			outcome.result = &lastResult
 		}
-		job.SetError(errMsg)
-		slog.Error("runner: job failed", "job_id", job.ID(), "exit_code", exitCode, "stderr", errMsg)
+		kind := classifyFailure(outcome)
+		errMsg := failureMessage(kind, outcome)
+		slog.Error("runner: job failed", "job_id", job.ID(), "exit_code", exitCode, "error_kind", kind, "stderr", errMsg)
+		failOrRetry(job, kind, errMsg)
 	}
 
 	return nil
@@ -219,64 +430,135 @@ func (r *Runner) Run(ctx context.Context, job *jobstore.Job, store *jobstore.Sto
 // Helpers
 // ---------------------------------------------------------------------------
 
-// researchDirs returns a map of absolute directory paths for all "research-*"
-// subdirectories inside dir. Non-existent directories and read errors are
-// silently ignored.
-func researchDirs(dir string) map[string]time.Time {
-	result := make(map[string]time.Time)
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return result
+// phaseEvent builds the system event announcing that a job entered a new
+// workflow phase.
+func phaseEvent(p model.Progress, at time.Time) model.ParsedEvent {
+	return model.ParsedEvent{
+		Type: model.EventTypeSystem,
+		Text: "phase",
+		Raw: map[string]any{
+			"type":         "system",
+			"subtype":      "phase",
+			"phase":        string(p.Phase),
+			"phase_number": p.PhaseNumber,
+			"percent":      p.Percent,
+		},
+		Time: at,
 	}
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		if !strings.HasPrefix(entry.Name(), model.ResearchDirPrefix) {
-			continue
-		}
-		absPath := filepath.Join(dir, entry.Name())
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-		result[absPath] = info.ModTime()
+}
+
+// fileEvent builds the event reporting a file written to the job's output
+// directory.
+func fileEvent(c fileChange, at time.Time) model.ParsedEvent {
+	subtype := model.SubtypeFileUpdated
+	if c.Created {
+		subtype = model.SubtypeFileCreated
+	}
+	return model.ParsedEvent{
+		Type:    model.EventTypeFile,
+		Subtype: subtype,
+		Text:    c.Path,
+		Raw: map[string]any{
+			"type":      "file",
+			"subtype":   string(subtype),
+			"path":      c.Path,
+			"size":      c.Size,
+			"file_type": string(pathutil.ClassifyFileType(c.Path)),
+		},
+		Time: at,
 	}
-	return result
 }
 
-// detectNewOutputDir diffs pre-run and post-run research-* directory snapshots,
-// atomically claims the newest unclaimed new directory via the store, and
-// returns its path. Returns an empty string if no new unclaimed directory
-// is found.
-func detectNewOutputDir(pre, post map[string]time.Time, claimer DirClaimer) string {
-	// Collect directories that are new (present after run but not before).
-	var candidates []string
-	for path := range post {
-		if _, existed := pre[path]; !existed {
-			candidates = append(candidates, path)
-		}
+// stderrEvent builds the event recording a line the subprocess wrote to
+// stderr.
+func stderrEvent(line string, at time.Time) model.ParsedEvent {
+	return model.ParsedEvent{
+		Type: model.EventTypeStderr,
+		Text: line,
+		Raw:  map[string]any{"type": "stderr"},
+		Time: at,
 	}
-	if len(candidates) == 0 {
-		return ""
+}
+
+// failOrRetry schedules the next attempt of a job whose current attempt
+// failed with kind, if its retry policy allows one, recording a system
+// "retry" event. Otherwise it fails the job with failJob.
+func failOrRetry(job *jobstore.Job, kind model.ErrorKind, msg string) {
+	attempt := job.Attempt()
+	if delay, ok := job.RetryPolicy().Backoff(kind, attempt); ok {
+		at := time.Now().Add(delay)
+		if job.ScheduleRetry(kind, msg, at) {
+			job.AddEvent(model.ParsedEvent{
+				Type: model.EventTypeSystem,
+				Text: "retry",
+				Raw: map[string]any{
+					"type":       "system",
+					"subtype":    "retry",
+					"attempt":    attempt + 1,
+					"error_kind": string(kind),
+					"error":      msg,
+					"retry_at":   at.UTC().Format(time.RFC3339),
+				},
+				Time: time.Now(),
+			})
+			slog.Warn("runner: retrying job", "job_id", job.ID(), "attempt", attempt+1, "error_kind", kind, "delay", delay)
+			return
+		}
 	}
+	failJob(job, kind, msg)
+}
 
-	// Sort newest first by mtime.
-	sort.Slice(candidates, func(i, j int) bool {
-		return post[candidates[i]].After(post[candidates[j]])
+// failJob records a final system event whose text is the error kind, then
+// marks the job as failed with the given kind and message. The event comes
+// first so that streams, which end once the job fails, still send it.
+func failJob(job *jobstore.Job, kind model.ErrorKind, msg string) {
+	job.AddEvent(model.ParsedEvent{
+		Type: model.EventTypeSystem,
+		Text: string(kind),
+		Raw:  map[string]any{"type": "system", "subtype": string(kind)},
+		Time: time.Now(),
 	})
+	job.Fail(kind, msg)
+}
 
-	// Claim the first directory that has not yet been claimed by another job.
-	// store.ClaimDir is the atomic test-and-set for ownership.
-	for _, path := range candidates {
-		if claimer.ClaimDir(path) {
-			return path
-		}
-		// Already claimed by another job — try the next candidate.
+// writeManifest records the job in the manifest of its output directory, if
+// it has ended and the directory exists. A job waiting to be retried is
+// recorded when its last attempt ends.
+func writeManifest(job *jobstore.Job, started time.Time) {
+	dir := job.OutputDir()
+	if dir == "" || !job.Status().IsTerminal() {
+		return
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return
+	}
+	if err := jobstore.WriteManifest(dir, job.ManifestRun(started, time.Now())); err != nil {
+		slog.Warn("runner: failed to write manifest", "job_id", job.ID(), "dir", dir, "err", err)
+	}
+}
+
+// checkBudget returns a description of the ceiling crossed by usage and cost,
+// or an empty string if the job is within its budget.
+func checkBudget(job *jobstore.Job, usage model.TokenUsage, cost float64) string {
+	if limit := job.MaxTokens(); limit > 0 && usage.Total() >= limit {
+		return fmt.Sprintf("budget exceeded: used %d tokens (max_tokens %d)", usage.Total(), limit)
+	}
+	if limit := job.MaxCostUSD(); limit > 0 && cost >= limit {
+		return fmt.Sprintf("budget exceeded: estimated cost $%.4f (max_cost_usd $%.4f)", cost, limit)
 	}
 	return ""
 }
 
+// promptPath returns how the prompt refers to dir: relative to the working
+// directory cwd when dir is inside it, or else as an absolute path.
+func promptPath(cwd, dir string) string {
+	rel, err := filepath.Rel(cwd, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return dir
+	}
+	return "./" + filepath.ToSlash(rel)
+}
+
 // extractResultStats converts a raw result event map into a model.ResultStats.
 func extractResultStats(raw map[string]any) model.ResultStats {
 	var stats model.ResultStats
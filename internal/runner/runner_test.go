@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/jamesprial/research-dashboard/internal/backend"
 	"github.com/jamesprial/research-dashboard/internal/jobstore"
 	"github.com/jamesprial/research-dashboard/internal/model"
 	"github.com/jamesprial/research-dashboard/internal/runner"
@@ -33,12 +37,57 @@ func TestMain(m *testing.M) {
 	case "slow":
 		fakeClaudeSlow()
 		os.Exit(0)
+	case "ignoreterm":
+		fakeClaudeIgnoreTerm()
+		os.Exit(0)
 	case "outputdir":
 		fakeClaudeOutputDir()
 		os.Exit(0)
 	case "maxturns":
 		fakeClaudeMaxTurns()
 		os.Exit(2)
+	case "resume":
+		fakeClaudeResume()
+		os.Exit(0)
+	case "tools":
+		fakeClaudeTools()
+		os.Exit(0)
+	case "workflow":
+		fakeClaudeWorkflow()
+		os.Exit(0)
+	case "spender":
+		fakeClaudeSpender()
+		os.Exit(0)
+	case "slowoutputdir":
+		fakeClaudeSlowOutputDir()
+		os.Exit(0)
+	case "stderr":
+		fakeClaudeStderr()
+		os.Exit(0)
+	case "stderrflood":
+		fakeClaudeStderrFlood()
+		os.Exit(1)
+	case "authfail":
+		fmt.Fprintln(os.Stderr, "Invalid API key · Please run /login")
+		os.Exit(1)
+	case "ratelimited":
+		fmt.Println(`{"type":"system","subtype":"init","session_id":"sess-limited"}`)
+		fmt.Fprintln(os.Stderr, `API Error: 429 {"type":"error","error":{"type":"rate_limit_error","message":"Rate limit reached"}}`)
+		os.Exit(1)
+	case "offline":
+		fmt.Fprintln(os.Stderr, "API Error: Connection error. (fetch failed: connect ECONNREFUSED 160.79.104.10:443)")
+		os.Exit(1)
+	case "maxturnsfail":
+		fmt.Println(`{"type":"result","subtype":"error_max_turns","is_error":true,"num_turns":10,"session_id":"sess-turns"}`)
+		os.Exit(1)
+	case "garbage":
+		fmt.Println("Usage: claude [options] [command] [prompt]")
+		os.Exit(1)
+	case "flaky":
+		fakeClaudeFlaky()
+	case "writefiles":
+		fakeClaudeWriteFiles()
+		os.Exit(0)
 	default:
 		// Normal test run — execute all tests.
 		os.Exit(m.Run())
@@ -63,12 +112,42 @@ func fakeClaudeFailure() {
 	fmt.Fprintln(os.Stderr, "claude: fatal error: model unavailable")
 }
 
+// fakeClaudeStderr interleaves warnings on stderr with stream-json events on
+// stdout and exits 0. The final warning has no trailing newline.
+func fakeClaudeStderr() {
+	fmt.Fprintln(os.Stderr, "warning: rate limited, retrying in 1s")
+	fmt.Println(`{"type":"system","subtype":"init","session_id":"sess-stderr"}`)
+	time.Sleep(50 * time.Millisecond)
+	fmt.Fprintln(os.Stderr, "warning: retry succeeded")
+	fmt.Println(`{"type":"assistant","message":{"content":[{"type":"text","text":"Done."}]}}`)
+	time.Sleep(50 * time.Millisecond)
+	fmt.Fprint(os.Stderr, "notice: exiting")
+}
+
+// fakeClaudeStderrFlood writes far more stderr than the runner records,
+// including one very long line, and exits 1.
+func fakeClaudeStderrFlood() {
+	fmt.Fprintln(os.Stderr, strings.Repeat("x", 10000))
+	for i := range 5000 {
+		fmt.Fprintf(os.Stderr, "noise line %d %s\n", i, strings.Repeat("y", 80))
+	}
+	fmt.Fprintln(os.Stderr, "claude: fatal error: out of patience")
+}
+
 // fakeClaudeSlow sleeps long enough to be cancelled, then emits nothing.
 func fakeClaudeSlow() {
 	// Sleep for 30s; the test will cancel the context well before this.
 	time.Sleep(30 * time.Second)
 }
 
+// fakeClaudeIgnoreTerm emits an init event and then ignores SIGTERM, so only
+// SIGKILL escalation can stop it.
+func fakeClaudeIgnoreTerm() {
+	signal.Ignore(syscall.SIGTERM)
+	fmt.Println(`{"type":"system","subtype":"init","session_id":"sess-stubborn"}`)
+	time.Sleep(30 * time.Second)
+}
+
 // fakeClaudeMaxTurns emits a successful result event and exits with code 2,
 // simulating the claude CLI behavior when max turns is reached.
 func fakeClaudeMaxTurns() {
@@ -83,15 +162,133 @@ func fakeClaudeMaxTurns() {
 	fmt.Fprintln(os.Stderr, "Max turns reached")
 }
 
-// fakeClaudeOutputDir creates a research-* directory in the cwd before emitting events.
-func fakeClaudeOutputDir() {
-	cwd, err := os.Getwd()
-	if err != nil {
-		os.Exit(2)
+// fakeClaudeResume reports the session ID passed via --resume (or a fresh
+// one) and echoes whether the follow-up prompt was used.
+func fakeClaudeResume() {
+	sessionID := "sess-fresh"
+	for i, arg := range os.Args {
+		if arg == "--resume" && i+1 < len(os.Args) {
+			sessionID = os.Args[i+1]
+		}
 	}
-	dirName := "research-outputdir-test"
-	if err := os.MkdirAll(filepath.Join(cwd, dirName), 0o755); err != nil {
-		os.Exit(2)
+	prompt := os.Args[len(os.Args)-1]
+	followUp := strings.HasPrefix(prompt, runner.FollowUpPrefix)
+	fmt.Printf(`{"type":"system","subtype":"init","session_id":%q}`+"\n", sessionID)
+	fmt.Printf(`{"type":"assistant","message":{"content":[{"type":"text","text":"follow-up=%t"}]}}`+"\n", followUp)
+	fmt.Println(`{"type":"result","result":"done","is_error":false}`)
+}
+
+// fakeClaudeFlaky is rate limited on a fresh session and succeeds when it
+// resumes one with the retry prompt, echoing the session it resumed.
+func fakeClaudeFlaky() {
+	prompt := os.Args[len(os.Args)-1]
+	for i, arg := range os.Args {
+		if arg == "--resume" && i+1 < len(os.Args) && strings.HasPrefix(prompt, runner.RetryPrefix) {
+			fmt.Printf(`{"type":"system","subtype":"init","session_id":%q}`+"\n", os.Args[i+1])
+			fmt.Println(`{"type":"result","result":"resumed","is_error":false}`)
+			os.Exit(0)
+		}
+	}
+	fmt.Println(`{"type":"system","subtype":"init","session_id":"sess-flaky"}`)
+	fmt.Fprintln(os.Stderr, "API Error: 429 rate limit reached")
+	os.Exit(1)
+}
+
+// fakeClaudeTools emits a tool call whose result arrives 150ms later.
+func fakeClaudeTools() {
+	fmt.Println(`{"type":"system","subtype":"init","session_id":"sess-tools"}`)
+	fmt.Println(`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"WebFetch","input":{"url":"https://example.com"}}]}}`)
+	time.Sleep(150 * time.Millisecond)
+	fmt.Println(`{"type":"user","message":{"content":[{"type":"tool_result","content":"page"}]}}`)
+	fmt.Println(`{"type":"result","result":"done","is_error":false}`)
+}
+
+// fakeClaudeWorkflow dispatches a research worker, waits for it, and writes
+// the report, walking through the main workflow phases.
+func fakeClaudeWorkflow() {
+	lines := []string{
+		`{"type":"system","subtype":"init","session_id":"sess-workflow"}`,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"w1","name":"Task","input":{"subagent_type":"research-worker","description":"history"}}]}}`,
+		`{"type":"assistant","parent_tool_use_id":"w1","message":{"content":[{"type":"text","text":"searching"}]}}`,
+		`{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"w1","content":"findings"}]}}`,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"r1","name":"Write","input":{"file_path":"research-x/report.md","content":"# Report"}}]}}`,
+		`{"type":"result","result":"done","is_error":false}`,
+	}
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+// fakeClaudeSpender emits assistant messages that each report 1000 tokens
+// (400 input, 600 output), repeating the first message's usage as the CLI
+// does for multi-block messages, then keeps running until it is stopped.
+func fakeClaudeSpender() {
+	fmt.Println(`{"type":"system","subtype":"init","session_id":"sess-spender"}`)
+	usage := `"usage":{"input_tokens":400,"output_tokens":600}`
+	fmt.Println(`{"type":"assistant","message":{"id":"msg_1","content":[{"type":"text","text":"one"}],` + usage + `}}`)
+	fmt.Println(`{"type":"assistant","message":{"id":"msg_1","content":[{"type":"tool_use","name":"WebSearch"}],` + usage + `}}`)
+	for i := 2; i <= 5; i++ {
+		fmt.Printf(`{"type":"assistant","message":{"id":"msg_%d","content":[{"type":"text","text":"more"}],%s}}`+"\n", i, usage)
+	}
+	time.Sleep(30 * time.Second)
+}
+
+// assignedOutputDir returns the output directory named in the prompt, which
+// is the last argument.
+func assignedOutputDir() string {
+	prompt := os.Args[len(os.Args)-1]
+	for line := range strings.Lines(prompt) {
+		if dir, ok := strings.CutPrefix(line, "mkdir -p "); ok {
+			return strings.TrimSuffix(strings.TrimSpace(dir), "/sources")
+		}
+	}
+	fmt.Fprintln(os.Stderr, "no output directory in prompt")
+	os.Exit(1)
+	return ""
+}
+
+// fakeClaudeSlowOutputDir starts writing its assigned output directory and
+// then hangs, simulating a run stuck mid-research.
+func fakeClaudeSlowOutputDir() {
+	if err := os.MkdirAll(assignedOutputDir(), 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "mkdir: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(`{"type":"system","subtype":"init","session_id":"sess-hung"}`)
+	time.Sleep(30 * time.Second)
+}
+
+// fakeClaudeWriteFiles writes a source into its assigned output directory,
+// pauses, then writes the report and extends the source before finishing.
+func fakeClaudeWriteFiles() {
+	dir := assignedOutputDir()
+	write := func(name, content string, flag int) {
+		f, err := os.OpenFile(filepath.Join(dir, name), flag|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprint(f, content)
+		f.Close()
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sources"), 0o755); err != nil {
+		os.Exit(1)
+	}
+	write("sources/a.md", "# Source A\n", os.O_TRUNC)
+	fmt.Println(`{"type":"system","subtype":"init","session_id":"sess-files"}`)
+	time.Sleep(300 * time.Millisecond)
+	write("report.md", "# Report\n", os.O_TRUNC)
+	write("sources/a.md", "More notes.\n", os.O_APPEND)
+	fmt.Println(`{"type":"result","result":"done","is_error":false}`)
+}
+
+// fakeClaudeOutputDir creates its assigned output directory, and a stray
+// research-* directory beside it, before emitting events.
+func fakeClaudeOutputDir() {
+	for _, dir := range []string{assignedOutputDir(), "research-stray-output"} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			os.Exit(2)
+		}
 	}
 	lines := []string{
 		`{"type":"system","subtype":"init","session_id":"sess-dir-456"}`,
@@ -155,6 +352,9 @@ func Test_PromptPrefix(t *testing.T) {
 			t.Errorf("PromptPrefix missing expected phrase %q", phrase)
 		}
 	}
+	if !strings.Contains(runner.PromptPrefix, runner.OutputDirPlaceholder) {
+		t.Errorf("PromptPrefix missing %q", runner.OutputDirPlaceholder)
+	}
 	// Must end with the query concatenation anchor.
 	if !strings.HasSuffix(runner.PromptPrefix, "Research question:\n\n") {
 		t.Errorf("PromptPrefix does not end with %q", "Research question:\\n\\n")
@@ -182,6 +382,46 @@ func Test_New_PreservesCustomPath(t *testing.T) {
 	}
 }
 
+func Test_Runner_Capabilities(t *testing.T) {
+	if caps := runner.New("").Capabilities(); !caps.Resume || !caps.OutputDir {
+		t.Errorf("claude Capabilities() = %+v, want Resume and OutputDir", caps)
+	}
+	r := &runner.Runner{Backend: &backend.Replay{}}
+	if caps := r.Capabilities(); caps.Resume || caps.OutputDir {
+		t.Errorf("replay Capabilities() = %+v, want none", caps)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Replay backend
+// ---------------------------------------------------------------------------
+
+func Test_Run_ReplayBackend(t *testing.T) {
+	r := &runner.Runner{Backend: &backend.Replay{
+		Path:  filepath.Join("..", "backend", "testdata", "research.ndjson"),
+		Speed: 1000,
+	}}
+	store, job := newJob(t, t.TempDir())
+	// A replay cannot resume; the session is ignored.
+	job.SetResumeSessionID("sess-parent")
+
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusCompleted {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCompleted)
+	}
+	if job.SessionID() != "replay-session" {
+		t.Errorf("SessionID() = %q, want %q", job.SessionID(), "replay-session")
+	}
+	if usage, _ := job.Usage(); usage.Total() == 0 {
+		t.Error("Usage() is zero, want the replayed usage")
+	}
+	if info := job.ResultInfo(); info.NumTurns == nil || *info.NumTurns != 9 {
+		t.Errorf("ResultInfo().NumTurns = %v, want 9 from the replayed result", info.NumTurns)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Test: Successful run
 // ---------------------------------------------------------------------------
@@ -276,6 +516,213 @@ func Test_Run_Failure(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Test: Failure classification
+// ---------------------------------------------------------------------------
+
+func Test_Run_ClassifiesFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		behavior   string
+		claudePath string
+		wantKind   model.ErrorKind
+		wantErr    string
+	}{
+		{"auth failure", "authfail", "", model.ErrorKindAuthFailed, "Invalid API key"},
+		{"rate limited", "ratelimited", "", model.ErrorKindRateLimited, "rate_limit_error"},
+		{"network error", "offline", "", model.ErrorKindNetwork, "ECONNREFUSED"},
+		{"max turns", "maxturnsfail", "", model.ErrorKindMaxTurns, "max turns"},
+		{"unreadable output", "garbage", "", model.ErrorKindParseFailure, "not stream-json"},
+		{"crash", "failure", "", model.ErrorKindCrash, "fatal error"},
+		{"binary not found", "success", filepath.Join(os.TempDir(), "no-such-claude"), model.ErrorKindBinaryNotFound, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSubprocessBehavior(t, tt.behavior)
+			r := newTestRunner(t)
+			if tt.claudePath != "" {
+				r = runner.New(tt.claudePath)
+			}
+			store, job := newJob(t, t.TempDir())
+
+			err := r.Run(context.Background(), job, store)
+			if (err != nil) != (tt.wantKind == model.ErrorKindBinaryNotFound) {
+				t.Errorf("Run() error = %v", err)
+			}
+			if job.Status() != model.StatusFailed {
+				t.Errorf("Status() = %q, want %q", job.Status(), model.StatusFailed)
+			}
+			if job.ErrorKind() != tt.wantKind {
+				t.Errorf("ErrorKind() = %q, want %q", job.ErrorKind(), tt.wantKind)
+			}
+			if !strings.Contains(job.Error(), tt.wantErr) {
+				t.Errorf("Error() = %q, want it to contain %q", job.Error(), tt.wantErr)
+			}
+			if got := job.ToDetail().ErrorKind; got != tt.wantKind {
+				t.Errorf("ToDetail().ErrorKind = %q, want %q", got, tt.wantKind)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: retries
+// ---------------------------------------------------------------------------
+
+func Test_Run_RetriesTransientFailure(t *testing.T) {
+	setSubprocessBehavior(t, "flaky")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+	job.SetRetryPolicy(model.RetryPolicy{
+		MaxAttempts: 2,
+		RetryOn:     []model.ErrorKind{model.ErrorKindRateLimited},
+	})
+
+	// The first attempt is rate limited and scheduled to run again.
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusPending {
+		t.Fatalf("Status() = %q, want %q", job.Status(), model.StatusPending)
+	}
+	if job.Attempt() != 2 {
+		t.Errorf("Attempt() = %d, want 2", job.Attempt())
+	}
+	if job.ErrorKind() != model.ErrorKindRateLimited {
+		t.Errorf("ErrorKind() = %q, want %q", job.ErrorKind(), model.ErrorKindRateLimited)
+	}
+	if job.RetryAt().IsZero() {
+		t.Error("RetryAt() is zero, want the time of the next attempt")
+	}
+	events := job.EventsSince(0)
+	last := events[len(events)-1]
+	if last.Text != "retry" || last.Raw["attempt"] != 2 {
+		t.Errorf("last event = %+v, want a retry event for attempt 2", last)
+	}
+	firstAttempt := len(events)
+
+	// The second attempt resumes the session and succeeds.
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusCompleted {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCompleted)
+	}
+	if job.Error() != "" || job.ErrorKind() != "" {
+		t.Errorf("Error() = %q, ErrorKind() = %q, want both cleared", job.Error(), job.ErrorKind())
+	}
+	if job.SessionID() != "sess-flaky" {
+		t.Errorf("SessionID() = %q, want resumed %q", job.SessionID(), "sess-flaky")
+	}
+	events = job.EventsSince(0)
+	for i, evt := range events {
+		if evt.Index != i {
+			t.Fatalf("events[%d].Index = %d, want indexes to continue across attempts", i, evt.Index)
+		}
+	}
+	if len(events) <= firstAttempt {
+		t.Errorf("got %d events after the retry, want more than %d", len(events), firstAttempt)
+	}
+}
+
+func Test_Run_DoesNotRetryPermanentFailure(t *testing.T) {
+	setSubprocessBehavior(t, "authfail")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+	job.SetRetryPolicy(model.RetryPolicy{
+		MaxAttempts: 3,
+		RetryOn:     []model.ErrorKind{model.ErrorKindRateLimited, model.ErrorKindCrash},
+	})
+
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusFailed {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusFailed)
+	}
+	if job.Attempt() != 1 {
+		t.Errorf("Attempt() = %d, want 1", job.Attempt())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: stderr events
+// ---------------------------------------------------------------------------
+
+func Test_Run_StreamsStderr(t *testing.T) {
+	setSubprocessBehavior(t, "stderr")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusCompleted {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCompleted)
+	}
+
+	var stderr []string
+	for i, evt := range job.EventsSince(0) {
+		if evt.Index != i {
+			t.Errorf("events[%d].Index = %d, want %d", i, evt.Index, i)
+		}
+		if evt.Type == model.EventTypeStderr {
+			stderr = append(stderr, evt.Text)
+		}
+	}
+	want := []string{"warning: rate limited, retrying in 1s", "warning: retry succeeded", "notice: exiting"}
+	if !slices.Equal(stderr, want) {
+		t.Errorf("stderr events = %q, want %q", stderr, want)
+	}
+}
+
+func Test_Run_BoundsStderr(t *testing.T) {
+	setSubprocessBehavior(t, "stderrflood")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusFailed {
+		t.Fatalf("Status() = %q, want %q", job.Status(), model.StatusFailed)
+	}
+
+	var stderr []model.ParsedEvent
+	total := 0
+	for _, evt := range job.EventsSince(0) {
+		if evt.Type == model.EventTypeStderr {
+			stderr = append(stderr, evt)
+			total += len(evt.Text)
+		}
+	}
+	if len(stderr) < 2 {
+		t.Fatalf("got %d stderr events, want many", len(stderr))
+	}
+	if n := len(stderr[0].Text); n > 4096 {
+		t.Errorf("first stderr event is %d bytes, want at most 4096", n)
+	}
+	if total > 256<<10+64 {
+		t.Errorf("stderr events total %d bytes, want at most ~256 KiB", total)
+	}
+	if last := stderr[len(stderr)-1].Text; !strings.Contains(last, "omitted") {
+		t.Errorf("last stderr event = %q, want a truncation notice", last)
+	}
+
+	errMsg := job.Error()
+	if !strings.HasSuffix(errMsg, "claude: fatal error: out of patience") {
+		t.Errorf("Error() ends %q, want the last stderr line", errMsg[max(len(errMsg)-60, 0):])
+	}
+	if len(errMsg) > 8<<10 {
+		t.Errorf("len(Error()) = %d, want at most 8 KiB", len(errMsg))
+	}
+	if !strings.HasPrefix(errMsg, "noise line") {
+		t.Errorf("Error() starts %q, want it to start at a line boundary", errMsg[:min(len(errMsg), 40)])
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Test: Cancel during run
 // ---------------------------------------------------------------------------
@@ -298,8 +745,8 @@ func Test_Run_Cancel(t *testing.T) {
 	// Give the subprocess a moment to start, then cancel.
 	time.Sleep(200 * time.Millisecond)
 
-	// Simulate external cancellation by setting status then cancelling context.
-	job.SetStatus(model.StatusCancelled)
+	// Simulate external cancellation by cancelling the job then its context.
+	job.Cancel()
 	cancel()
 
 	select {
@@ -315,13 +762,376 @@ func Test_Run_Cancel(t *testing.T) {
 	if job.Status() != model.StatusCancelled {
 		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCancelled)
 	}
+	if job.ErrorKind() != model.ErrorKindCancelled {
+		t.Errorf("ErrorKind() = %q, want %q", job.ErrorKind(), model.ErrorKindCancelled)
+	}
+}
+
+func Test_Run_ContextCancelled_Interrupts(t *testing.T) {
+	setSubprocessBehavior(t, "slow")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(ctx, job, store)
+	}()
+
+	// Cancelling the context alone, as the server does at shutdown,
+	// interrupts the job rather than cancelling it.
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() returned error after cancel: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("Run() did not return within 15s after cancel")
+	}
+
+	if job.Status() != model.StatusFailed || job.ErrorKind() != model.ErrorKindInterrupted {
+		t.Errorf("Status() = %q, ErrorKind() = %q; want failed with %q",
+			job.Status(), job.ErrorKind(), model.ErrorKindInterrupted)
+	}
+	if events := job.EventsSince(0); len(events) == 0 || events[len(events)-1].Text != string(model.ErrorKindInterrupted) {
+		t.Errorf("last event = %+v, want the interrupted event", events)
+	}
+}
+
+func Test_Run_JobCancel_EscalatesToSIGKILL(t *testing.T) {
+	setSubprocessBehavior(t, "ignoreterm")
+
+	cwd := t.TempDir()
+	r := newTestRunner(t)
+	r.TermGrace = 300 * time.Millisecond
+	store, job := newJob(t, cwd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	job.SetCancelFunc(cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(ctx, job, store)
+	}()
+
+	// Wait until the subprocess has emitted its init event.
+	deadline := time.Now().Add(5 * time.Second)
+	for job.EventCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subprocess did not emit init event within 5s")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if !job.Cancel() {
+		t.Fatal("Cancel() = false, want true for running job")
+	}
+
+	// The WaitDelay backstop is TermGrace+5s, so returning well before that
+	// proves the process group was killed by the SIGKILL escalation.
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() returned error after cancel: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run() did not return within 3s; SIGKILL escalation did not fire")
+	}
+
+	if job.Status() != model.StatusCancelled {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCancelled)
+	}
+
+	events := job.EventsSince(0)
+	last := events[len(events)-1]
+	if last.Type != model.EventTypeSystem || last.Text != "cancelled" {
+		t.Errorf("last event = %+v, want system event with text %q", last, "cancelled")
+	}
+	if last.Index != len(events)-1 {
+		t.Errorf("last event Index = %d, want %d", last.Index, len(events)-1)
+	}
+}
+
+func Test_Run_CancelledBeforeStart(t *testing.T) {
+	setSubprocessBehavior(t, "success")
+
+	cwd := t.TempDir()
+	r := newTestRunner(t)
+	store, job := newJob(t, cwd)
+	job.Cancel()
+
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusCancelled {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCancelled)
+	}
+	// Only the cancellation itself is recorded; the subprocess never starts.
+	if events := job.EventsSince(0); len(events) != 1 || events[0].Text != "cancelled" {
+		t.Errorf("events = %+v, want only the cancelled event (subprocess should not start)", events)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Event timestamps and tool durations
+// ---------------------------------------------------------------------------
+
+func Test_Run_StampsEventTimes(t *testing.T) {
+	setSubprocessBehavior(t, "tools")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+
+	before := time.Now()
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	events := job.EventsSince(0)
+	if len(events) != 4 {
+		t.Fatalf("len(events) = %d, want 4", len(events))
+	}
+	for i, evt := range events {
+		if evt.Time.Before(before) || evt.Time.After(time.Now()) {
+			t.Errorf("events[%d].Time = %v, want a receive time during the run", i, evt.Time)
+		}
+		if i > 0 && evt.Time.Before(events[i-1].Time) {
+			t.Errorf("events[%d].Time precedes events[%d].Time", i, i-1)
+		}
+	}
+
+	toolResult := events[2]
+	if toolResult.Subtype != model.SubtypeToolResult {
+		t.Fatalf("events[2].Subtype = %q, want tool_result", toolResult.Subtype)
+	}
+	if toolResult.DurationMS < 100 {
+		t.Errorf("tool_result DurationMS = %d, want >= 100", toolResult.DurationMS)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Workflow progress
+// ---------------------------------------------------------------------------
+
+func Test_Run_ReportsProgress(t *testing.T) {
+	setSubprocessBehavior(t, "workflow")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	p := job.Progress()
+	if p == nil {
+		t.Fatal("Progress() = nil, want progress")
+	}
+	if p.Phase != model.PhaseReport || p.Percent != 100 {
+		t.Errorf("Progress = %q/%d%%, want report/100%%", p.Phase, p.Percent)
+	}
+
+	var phases []string
+	for _, evt := range job.EventsSince(0) {
+		if evt.Type == model.EventTypeSystem && evt.Text == "phase" {
+			phases = append(phases, evt.Raw["phase"].(string))
+		}
+	}
+	want := []string{"broad_research", "synthesis", "report"}
+	if strings.Join(phases, ",") != strings.Join(want, ",") {
+		t.Errorf("phase events = %v, want %v", phases, want)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Budget enforcement
+// ---------------------------------------------------------------------------
+
+func Test_Run_BudgetExceeded(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxCostUSD float64
+		maxTokens  int
+	}{
+		// msg_1 is reported twice but counted once, so both ceilings are
+		// crossed by msg_2 (each opus message costs $0.051).
+		{name: "max_tokens", maxTokens: 1500},
+		{name: "max_cost_usd", maxCostUSD: 0.08},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSubprocessBehavior(t, "spender")
+
+			r := newTestRunner(t)
+			store, job := newJob(t, t.TempDir())
+			job.SetBudget(tt.maxCostUSD, tt.maxTokens)
+
+			done := make(chan error, 1)
+			go func() {
+				done <- r.Run(context.Background(), job, store)
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("Run() error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run() did not stop the job within 5s of crossing its budget")
+			}
+
+			if job.Status() != model.StatusFailed {
+				t.Errorf("Status() = %q, want %q", job.Status(), model.StatusFailed)
+			}
+			if job.ErrorKind() != model.ErrorKindBudgetExceeded {
+				t.Errorf("ErrorKind() = %q, want %q", job.ErrorKind(), model.ErrorKindBudgetExceeded)
+			}
+			if !strings.Contains(job.Error(), "budget exceeded") {
+				t.Errorf("Error() = %q, want it to mention the budget", job.Error())
+			}
+			status := job.ToStatus()
+			// Lines already buffered when the job was stopped are still
+			// counted, so only a lower bound is deterministic.
+			if status.TotalTokens < 2000 {
+				t.Errorf("TotalTokens = %d, want >= 2000", status.TotalTokens)
+			}
+			if status.EstimatedCostUSD <= 0 {
+				t.Errorf("EstimatedCostUSD = %v, want > 0", status.EstimatedCostUSD)
+			}
+
+			events := job.EventsSince(0)
+			last := events[len(events)-1]
+			if last.Type != model.EventTypeSystem || last.Text != "budget_exceeded" {
+				t.Errorf("last event = %+v, want system budget_exceeded event", last)
+			}
+		})
+	}
+}
+
+func Test_Run_WithinBudget_TracksUsage(t *testing.T) {
+	setSubprocessBehavior(t, "resume")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+	job.SetBudget(100, 1_000_000)
+
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusCompleted {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCompleted)
+	}
+	if job.ErrorKind() != "" {
+		t.Errorf("ErrorKind() = %q, want empty", job.ErrorKind())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Wall-clock timeout
+// ---------------------------------------------------------------------------
+
+func Test_Run_Timeout(t *testing.T) {
+	setSubprocessBehavior(t, "slowoutputdir")
+
+	cwd := t.TempDir()
+	r := newTestRunner(t)
+	store, job := newJob(t, cwd)
+	job.SetTimeout(300 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(context.Background(), job, store)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return within 5s of its 300ms timeout")
+	}
+
+	if job.Status() != model.StatusFailed {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusFailed)
+	}
+	if job.ErrorKind() != model.ErrorKindTimeout {
+		t.Errorf("ErrorKind() = %q, want %q", job.ErrorKind(), model.ErrorKindTimeout)
+	}
+	if !strings.Contains(job.Error(), "timed out") {
+		t.Errorf("Error() = %q, want it to mention the timeout", job.Error())
+	}
+	if _, err := os.Stat(job.OutputDir()); err != nil {
+		t.Errorf("partial output in OutputDir() = %q: %v", job.OutputDir(), err)
+	}
+	events := job.EventsSince(0)
+	if last := events[len(events)-1]; last.Text != string(model.ErrorKindTimeout) {
+		t.Errorf("last event = %+v, want system timeout event", last)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Resuming a session
+// ---------------------------------------------------------------------------
+
+func Test_Run_ResumesSession(t *testing.T) {
+	setSubprocessBehavior(t, "resume")
+
+	cwd := t.TempDir()
+	outputDir := filepath.Join(cwd, "research-parent-output")
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRunner(t)
+	store, job := newJob(t, cwd)
+	job.SetResumeSessionID("sess-parent-1")
+	job.SetOutputDir(outputDir)
+
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.Status() != model.StatusCompleted {
+		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCompleted)
+	}
+	if job.SessionID() != "sess-parent-1" {
+		t.Errorf("SessionID() = %q, want %q (passed via --resume)", job.SessionID(), "sess-parent-1")
+	}
+	if job.OutputDir() != outputDir {
+		t.Errorf("OutputDir() = %q, want preassigned %q", job.OutputDir(), outputDir)
+	}
+	events := job.EventsSince(0)
+	if len(events) < 2 || events[1].Text != "follow-up=true" {
+		t.Errorf("events = %+v, want follow-up prompt to be used", events)
+	}
+}
+
+func Test_Run_FreshSessionUsesResearchPrompt(t *testing.T) {
+	setSubprocessBehavior(t, "resume")
+
+	r := newTestRunner(t)
+	store, job := newJob(t, t.TempDir())
+
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if job.SessionID() != "sess-fresh" {
+		t.Errorf("SessionID() = %q, want %q", job.SessionID(), "sess-fresh")
+	}
+	events := job.EventsSince(0)
+	if len(events) < 2 || events[1].Text != "follow-up=false" {
+		t.Errorf("events = %+v, want research prompt to be used", events)
+	}
 }
 
 // ---------------------------------------------------------------------------
-// Test: Output directory detection
+// Test: Output directory assignment
 // ---------------------------------------------------------------------------
 
-func Test_Run_OutputDirDetection(t *testing.T) {
+func Test_Run_AssignsOutputDir(t *testing.T) {
 	setSubprocessBehavior(t, "outputdir")
 
 	cwd := t.TempDir()
@@ -338,55 +1148,130 @@ func Test_Run_OutputDirDetection(t *testing.T) {
 		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCompleted)
 	}
 
-	// The output directory should be set because the fake binary creates one.
+	// The assigned directory is named after the query and the job ID, and
+	// the stray directory the agent also created is ignored.
 	outputDir := job.OutputDir()
-	if outputDir == "" {
-		t.Fatal("OutputDir() is empty, want a research-* directory path")
-	}
-	if !strings.Contains(outputDir, "research-outputdir-test") {
-		t.Errorf("OutputDir() = %q, want it to contain %q", outputDir, "research-outputdir-test")
+	prefix := filepath.Join(cwd, "research-ai-trends-2026-")
+	if !strings.HasPrefix(outputDir, prefix) || !strings.HasSuffix(outputDir, "-test") {
+		t.Errorf("OutputDir() = %q, want %q...-test", outputDir, prefix)
 	}
 
-	// The directory should actually exist.
+	// The agent created the directory the prompt named.
 	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
 		t.Errorf("OutputDir %q does not exist on disk", outputDir)
 	}
 }
 
-// ---------------------------------------------------------------------------
-// Test: Output dir claimed by another job is not assigned
-// ---------------------------------------------------------------------------
-
-func Test_Run_OutputDirAlreadyClaimed(t *testing.T) {
+func Test_Run_KeepsPreassignedOutputDir(t *testing.T) {
 	setSubprocessBehavior(t, "outputdir")
 
 	cwd := t.TempDir()
+	store, job := newJob(t, cwd)
+	outputDir := filepath.Join(cwd, "research-preassigned")
+	job.SetOutputDir(outputDir)
 
-	// Use a shared store and claim the directory that the fake binary will
-	// create. Because the directory does NOT exist at run start (it is not
-	// in preDirs), the runner will find it as a new candidate and attempt
-	// to claim it — but it will already be claimed so OutputDir stays empty.
-	store := jobstore.NewStore()
-	targetDir := filepath.Join(cwd, "research-outputdir-test")
-	// Claim the path in the store before the run begins (the path need not
-	// exist on disk yet — ClaimDir just tracks string paths).
-	store.ClaimDir(targetDir)
+	if err := newTestRunner(t).Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() returned unexpected error: %v", err)
+	}
+	if job.OutputDir() != outputDir {
+		t.Errorf("OutputDir() = %q, want preassigned %q", job.OutputDir(), outputDir)
+	}
+	if _, err := os.Stat(outputDir); err != nil {
+		t.Errorf("preassigned dir was not named in the prompt: %v", err)
+	}
+}
 
-	job := store.Create("test-job-claim", "query", "opus", 10, cwd)
-	r := newTestRunner(t)
+func Test_Run_WritesManifest(t *testing.T) {
+	setSubprocessBehavior(t, "outputdir")
 
-	ctx := context.Background()
-	if err := r.Run(ctx, job, store); err != nil {
-		t.Fatalf("Run() returned unexpected error: %v", err)
+	store, job := newJob(t, t.TempDir())
+	if err := newTestRunner(t).Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
 	}
 
-	// Job should complete but OutputDir should be empty because the dir was
-	// already claimed in the store before the run.
+	m, err := jobstore.ReadManifest(job.OutputDir())
+	if err != nil {
+		t.Fatalf("ReadManifest() error: %v", err)
+	}
+	if m.JobID != "test-job-1" || m.Query != "AI trends 2026" || m.Model != model.ModelOpus || m.MaxTurns != 10 {
+		t.Errorf("manifest = %+v, want the job's query and settings", m)
+	}
+	if m.Status != model.StatusCompleted || m.SessionID != "sess-dir-456" {
+		t.Errorf("manifest = %+v, want completed with session sess-dir-456", m)
+	}
+	if m.StartedAt.IsZero() || m.FinishedAt.Before(m.StartedAt) {
+		t.Errorf("StartedAt = %v, FinishedAt = %v, want the run's span", m.StartedAt, m.FinishedAt)
+	}
+}
+
+func Test_Run_NoManifestWithoutOutputDir(t *testing.T) {
+	setSubprocessBehavior(t, "success")
+
+	store, job := newJob(t, t.TempDir())
+	if err := newTestRunner(t).Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	// The agent never created its output directory, so there is nowhere to
+	// write a manifest, and the directory is not created for one.
+	if _, err := os.Stat(job.OutputDir()); !os.IsNotExist(err) {
+		t.Errorf("Stat(%q) error = %v, want the directory not to exist", job.OutputDir(), err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: Output directory watching
+// ---------------------------------------------------------------------------
+
+func Test_Run_ReportsOutputFiles(t *testing.T) {
+	setSubprocessBehavior(t, "writefiles")
+
+	cwd := t.TempDir()
+	store, job := newJob(t, cwd)
+	// A file left by an earlier run is not reported.
+	outputDir := filepath.Join(cwd, "research-existing")
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "notes.md"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	job.SetOutputDir(outputDir)
+
+	r := newTestRunner(t)
+	r.WatchInterval = 20 * time.Millisecond
+	if err := r.Run(context.Background(), job, store); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
 	if job.Status() != model.StatusCompleted {
-		t.Errorf("Status() = %q, want %q", job.Status(), model.StatusCompleted)
+		t.Fatalf("Status() = %q, want %q", job.Status(), model.StatusCompleted)
+	}
+
+	var files []string
+	sourceSeen, resultIndex := -1, -1
+	for _, evt := range job.EventsSince(0) {
+		switch evt.Type {
+		case model.EventTypeFile:
+			files = append(files, string(evt.Subtype)+" "+evt.Text)
+			if evt.Text == "sources/a.md" && sourceSeen < 0 {
+				sourceSeen = evt.Index
+			}
+			if evt.Raw["size"] == nil || evt.Raw["file_type"] != "md" {
+				t.Errorf("file event Raw = %v, want size and file_type", evt.Raw)
+			}
+		case model.EventTypeResult:
+			resultIndex = evt.Index
+		}
+	}
+	want := []string{
+		"file_created sources/a.md",
+		"file_created report.md",
+		"file_updated sources/a.md",
+	}
+	if !slices.Equal(files, want) {
+		t.Errorf("file events = %q, want %q", files, want)
 	}
-	if job.OutputDir() != "" {
-		t.Errorf("OutputDir() = %q, want empty (dir was pre-claimed in store)", job.OutputDir())
+	if sourceSeen < 0 || sourceSeen > resultIndex {
+		t.Errorf("source reported at index %d, want it before the result at %d", sourceSeen, resultIndex)
 	}
 }
 
@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits on the stderr output recorded for a job.
+const (
+	// stderrEventBudget caps the total bytes of stderr lines recorded as
+	// events. Later lines are dropped from the event log but still reach
+	// the tail.
+	stderrEventBudget = 256 << 10
+	// stderrMaxLine caps a single stderr event's text; longer lines are cut.
+	stderrMaxLine = 4 << 10
+	// stderrTailSize is how much of the end of stderr is kept for the
+	// failure message.
+	stderrTailSize = 8 << 10
+)
+
+// stderrTruncatedText is the text of the final stderr event recorded once
+// stderrEventBudget is spent.
+const stderrTruncatedText = "[further stderr output omitted]"
+
+// stderrLog is an io.Writer for the subprocess's stderr. It passes each
+// complete line to emit as it arrives, within stderrEventBudget, and keeps
+// the last stderrTailSize bytes for the failure message. exec.Cmd copies
+// stderr from a single goroutine, so a stderrLog is not safe for concurrent
+// use; call Flush and Tail only after the command has been waited for.
+type stderrLog struct {
+	emit func(line string)
+
+	partial  []byte
+	skipping bool
+	emitted  int
+	dropped  bool
+
+	tail      []byte
+	truncated bool
+}
+
+// newStderrLog returns a stderrLog that records lines through emit.
+func newStderrLog(emit func(line string)) *stderrLog {
+	return &stderrLog{emit: emit}
+}
+
+// Write records p, emitting every line it completes.
+func (w *stderrLog) Write(p []byte) (int, error) {
+	w.keepTail(p)
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if !w.skipping {
+			w.line(w.partial[:i])
+		}
+		w.skipping = false
+		w.partial = w.partial[i+1:]
+	}
+	// Emit the start of an overlong line now and skip the rest of it, so
+	// that a line never buffers more than stderrMaxLine bytes.
+	if len(w.partial) > stderrMaxLine {
+		if !w.skipping {
+			w.line(w.partial)
+		}
+		w.skipping = true
+		w.partial = w.partial[:0]
+	}
+	return len(p), nil
+}
+
+// Flush emits any final line that was not terminated by a newline.
+func (w *stderrLog) Flush() {
+	if len(w.partial) > 0 && !w.skipping {
+		w.line(w.partial)
+	}
+	w.partial = nil
+}
+
+// Tail returns the end of the stderr output, trimmed of surrounding
+// whitespace. When earlier output was discarded the tail starts at a line
+// boundary.
+func (w *stderrLog) Tail() string {
+	tail := w.tail
+	if w.truncated {
+		if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+	}
+	return strings.TrimSpace(string(tail))
+}
+
+// line emits one line of output, unless the event budget is spent.
+func (w *stderrLog) line(b []byte) {
+	b = bytes.TrimRight(b, "\r")
+	if len(bytes.TrimSpace(b)) == 0 || w.dropped {
+		return
+	}
+	if len(b) > stderrMaxLine {
+		cut := stderrMaxLine
+		for cut > 0 && !utf8.RuneStart(b[cut]) {
+			cut--
+		}
+		b = b[:cut]
+	}
+	if w.emitted+len(b) > stderrEventBudget {
+		w.dropped = true
+		w.emit(stderrTruncatedText)
+		return
+	}
+	w.emitted += len(b)
+	w.emit(string(b))
+}
+
+// keepTail appends p to the tail, discarding all but the last
+// stderrTailSize bytes.
+func (w *stderrLog) keepTail(p []byte) {
+	w.tail = append(w.tail, p...)
+	if over := len(w.tail) - stderrTailSize; over > 0 {
+		w.tail = append(w.tail[:0], w.tail[over:]...)
+		w.truncated = true
+	}
+}
@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often a running job's output directory is
+// polled for new and changed files when Runner.WatchInterval is not set.
+const DefaultWatchInterval = time.Second
+
+// sourcesDir is the output subdirectory holding archived sources. Like the
+// file listing endpoints, the watcher looks at the top level of the output
+// directory and at this subdirectory only.
+const sourcesDir = "sources"
+
+// fileChange is a file that appeared or changed in a watched directory.
+type fileChange struct {
+	// Path is the file's slash-separated path relative to the directory.
+	Path    string
+	Size    int64
+	Created bool
+}
+
+// fileStamp is what a fileWatcher remembers about a file to tell whether
+// it changed.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// equal reports whether s and o describe the same file contents. Times are
+// compared with Equal, since == also compares their locations and monotonic
+// readings.
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+// fileWatcher polls a directory, which need not exist yet, and reports the
+// files that appear or change in it between scans.
+type fileWatcher struct {
+	dir   string
+	known map[string]fileStamp
+}
+
+// newFileWatcher returns a watcher for dir. Files already in dir are taken
+// as the baseline, so that only files written afterwards are reported.
+func newFileWatcher(dir string) *fileWatcher {
+	w := &fileWatcher{dir: dir, known: make(map[string]fileStamp)}
+	w.scan()
+	return w
+}
+
+// scan returns the files created or changed since the previous scan,
+// sorted by path. Files that cannot be read are skipped until they can.
+func (w *fileWatcher) scan() []fileChange {
+	var changes []fileChange
+	for _, sub := range []string{"", sourcesDir} {
+		entries, err := os.ReadDir(filepath.Join(w.dir, sub))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			rel := path.Join(sub, entry.Name())
+			stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+			prev, seen := w.known[rel]
+			if seen && prev.equal(stamp) {
+				continue
+			}
+			w.known[rel] = stamp
+			changes = append(changes, fileChange{Path: rel, Size: stamp.size, Created: !seen})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// watch scans w every interval on its own goroutine, passing each change to
+// emit. The returned stop function ends the polling and runs a final scan,
+// so that files written just before the run ended are still reported.
+func (w *fileWatcher) watch(interval time.Duration, emit func(fileChange)) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, c := range w.scan() {
+					emit(c)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			for _, c := range w.scan() {
+				emit(c)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jamesprial/research-dashboard/internal/model"
+)
+
+// handleGetEvent handles GET /research/{id}/events/{index}.
+// It returns a single event in full, for clients that received a filtered
+// or truncated copy.
+func (s *Server) handleGetEvent(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 {
+		writeError(w, http.StatusBadRequest, "index must be a non-negative integer")
+		return
+	}
+	evt, ok := job.Event(index)
+	if !ok {
+		writeError(w, http.StatusNotFound, "event not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, model.EventToDict(evt))
+}
+
+// parseEventFilter builds an event filter from the query parameters shared
+// by the stream and detail endpoints:
+//
+//   - types, subtypes, tools: comma-separated values to keep;
+//   - max_result, max_input: rune limits for tool_result and for each
+//     string value of tool_input;
+//   - omit: comma-separated bodies to drop (tool_result, tool_input).
+//
+// List parameters may also be repeated.
+func parseEventFilter(q url.Values) (model.EventFilter, error) {
+	var f model.EventFilter
+	for _, v := range splitParam(q, "types") {
+		f.Types = append(f.Types, model.EventType(v))
+	}
+	for _, v := range splitParam(q, "subtypes") {
+		f.Subtypes = append(f.Subtypes, model.EventSubtype(v))
+	}
+	f.Tools = splitParam(q, "tools")
+
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"max_result", &f.MaxResult},
+		{"max_input", &f.MaxInput},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return model.EventFilter{}, fmt.Errorf("%s must be a non-negative integer", p.name)
+		}
+		*p.dst = n
+	}
+
+	for _, v := range splitParam(q, "omit") {
+		if err := setOmit(&f, v); err != nil {
+			return model.EventFilter{}, err
+		}
+	}
+	return f, nil
+}
+
+// setOmit marks the body named by v, tool_result or tool_input, as omitted
+// by f.
+func setOmit(f *model.EventFilter, v string) error {
+	switch v {
+	case "tool_result":
+		f.OmitResult = true
+	case "tool_input":
+		f.OmitInput = true
+	default:
+		return fmt.Errorf("omit must be tool_result or tool_input, got %q", v)
+	}
+	return nil
+}
+
+// parseEventPage builds an event page from the detail endpoint's paging
+// parameters:
+//
+//   - offset: event index at which the page starts (forward) or ends,
+//     exclusive (reverse); 0 in reverse means the end of the log;
+//   - limit: maximum number of events in the page; all when absent;
+//   - order: asc (default) or desc, for newest first.
+func parseEventPage(q url.Values) (model.EventPage, error) {
+	var p model.EventPage
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return model.EventPage{}, errors.New("offset must be a non-negative integer")
+		}
+		p.Offset = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return model.EventPage{}, errors.New("limit must be a positive integer")
+		}
+		p.Limit = n
+	}
+	switch order := q.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		p.Reverse = true
+	default:
+		return model.EventPage{}, fmt.Errorf("order must be asc or desc, got %q", order)
+	}
+	return p, nil
+}
+
+// splitParam returns the non-empty comma-separated values of every
+// occurrence of the query parameter name.
+func splitParam(q url.Values, name string) []string {
+	var out []string
+	for _, v := range q[name] {
+		for part := range strings.SplitSeq(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
@@ -3,19 +3,28 @@ package server
 import (
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jamesprial/research-dashboard/internal/jobstore"
 	"github.com/jamesprial/research-dashboard/internal/model"
 )
 
 // handleStartResearch handles POST /research.
 // It decodes and validates the request, creates a new job in the store,
-// and launches the runner in a goroutine.
+// assigns its output directory so that its files can be browsed as soon as
+// they are written, and submits it to the run queue. The job stays pending
+// until a worker slot is free.
 func (s *Server) handleStartResearch(w http.ResponseWriter, r *http.Request) {
 	var req model.ResearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -26,6 +35,15 @@ func (s *Server) handleStartResearch(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	timeout := s.defaultTimeout
+	if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+		if timeout > s.maxTimeout {
+			writeError(w, http.StatusBadRequest,
+				fmt.Sprintf("timeout_seconds must not exceed %d", int(s.maxTimeout/time.Second)))
+			return
+		}
+	}
 
 	s.store.CleanupExpired(maxJobAge)
 
@@ -36,51 +54,420 @@ func (s *Server) handleStartResearch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	job := s.store.Create(id, req.Query, string(req.Model), req.MaxTurns, cwd)
-	slog.Debug("job created", "id", id, "model", string(req.Model), "max_turns", req.MaxTurns)
+	if req.MaxCostUSD > 0 || req.MaxTokens > 0 {
+		job.SetBudget(req.MaxCostUSD, req.MaxTokens)
+	}
+	job.SetTimeout(timeout)
+	retry := s.retryPolicy
+	if req.Retry != nil {
+		retry = req.Retry.WithDefaults(s.retryPolicy)
+	}
+	job.SetRetryPolicy(retry)
+	if s.runner.Capabilities().OutputDir {
+		s.store.AssignOutputDir(job)
+	}
+	slog.Debug("job created", "id", id, "model", string(req.Model), "max_turns", req.MaxTurns,
+		"max_cost_usd", req.MaxCostUSD, "max_tokens", req.MaxTokens, "timeout", timeout)
 
-	go func() {
-		ctx := context.Background()
-		if err := s.runner.Run(ctx, job, s.store); err != nil {
-			slog.Error("job failed", "id", id, "err", err)
-		}
-	}()
+	pos := s.queue.Enqueue(job)
+	slog.Debug("job queued", "id", id, "position", pos)
+
+	writeJSON(w, http.StatusCreated, job.ToStatus())
+}
 
+// handleFollowUpResearch handles POST /research/{id}/followup.
+// It starts a new job that resumes the parent job's agent session with a
+// follow-up question; see startFollowUp.
+func (s *Server) handleFollowUpResearch(w http.ResponseWriter, r *http.Request) {
+	parent, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	var req model.FollowUpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	job, code, err := s.startFollowUp(parent, req)
+	if err != nil {
+		writeError(w, code, err.Error())
+		return
+	}
 	writeJSON(w, http.StatusCreated, job.ToStatus())
 }
 
+// startFollowUp validates req against parent and enqueues a follow-up job.
+// The new job is linked to the parent, runs in the same working directory,
+// writes into the parent's output directory, and inherits the parent's
+// budget, timeout and retry policy. The parent must have finished and
+// recorded a session ID, and the runner's backend must be able to resume it.
+// On failure it returns the HTTP status code describing the error.
+func (s *Server) startFollowUp(parent *jobstore.Job, req model.FollowUpRequest) (*jobstore.Job, int, error) {
+	if err := req.Validate(); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if !s.runner.Capabilities().Resume {
+		return nil, http.StatusNotImplemented, errors.New("the runner backend cannot resume sessions")
+	}
+	if !parent.Status().IsTerminal() {
+		return nil, http.StatusConflict, errors.New("parent job is still running")
+	}
+	sessionID := parent.SessionID()
+	if sessionID == "" {
+		return nil, http.StatusConflict, errors.New("parent job has no session to resume")
+	}
+
+	mdl := parent.Model()
+	if req.Model != "" {
+		mdl = string(req.Model)
+	}
+	maxTurns := parent.MaxTurns()
+	if req.MaxTurns > 0 {
+		maxTurns = req.MaxTurns
+	}
+
+	id := generateID()
+	job := s.store.Create(id, req.Query, mdl, maxTurns, parent.CWD())
+	job.SetParentID(parent.ID())
+	job.SetResumeSessionID(sessionID)
+	if maxCost, maxTokens := parent.MaxCostUSD(), parent.MaxTokens(); maxCost > 0 || maxTokens > 0 {
+		job.SetBudget(maxCost, maxTokens)
+	}
+	timeout := parent.Timeout()
+	if timeout <= 0 {
+		timeout = s.defaultTimeout
+	}
+	job.SetTimeout(timeout)
+	job.SetRetryPolicy(parent.RetryPolicy())
+	if dir := parent.OutputDir(); dir != "" {
+		job.SetOutputDir(dir)
+	} else if s.runner.Capabilities().OutputDir {
+		s.store.AssignOutputDir(job)
+	}
+	slog.Debug("follow-up job created", "id", id, "parent_id", parent.ID(), "session_id", sessionID)
+
+	pos := s.queue.Enqueue(job)
+	slog.Debug("job queued", "id", id, "position", pos)
+	return job, http.StatusCreated, nil
+}
+
+// runJob executes a job on the runner under a cancellable context that is
+// registered on the job, so that cancelling the job terminates the runner.
+// The context derives from the server's, so shutting down the server stops
+// the job too. It is invoked by the queue once a worker slot is free; once
+// the server is stopping, the job is left pending instead. A job the runner
+// scheduled for another attempt is re-enqueued when its retry is due.
+func (s *Server) runJob(job *jobstore.Job) {
+	s.jobsMu.Lock()
+	if s.stopping || s.ctx.Err() != nil {
+		s.jobsMu.Unlock()
+		return
+	}
+	s.jobs.Add(1)
+	s.jobsMu.Unlock()
+	defer s.jobs.Done()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	job.SetCancelFunc(cancel)
+
+	if err := s.runner.Run(ctx, job, s.store); err != nil {
+		slog.Error("job failed", "id", job.ID(), "err", err)
+	}
+	if at := job.RetryAt(); job.Status() == model.StatusPending && !at.IsZero() {
+		go s.awaitRetry(job, at)
+	}
+}
+
+// awaitRetry retries job at the given time, unless the server shuts down
+// first. Pending retries are not persisted, so a job still waiting for one
+// when the server stops is marked interrupted on the next start.
+func (s *Server) awaitRetry(job *jobstore.Job, at time.Time) {
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-s.ctx.Done():
+	case <-timer.C:
+		s.retryJob(job)
+	}
+}
+
+// retryJob enqueues the next attempt of a job, unless the job was cancelled
+// or deleted while it waited or the server is shutting down.
+func (s *Server) retryJob(job *jobstore.Job) {
+	if s.ctx.Err() != nil || job.Status().IsTerminal() {
+		return
+	}
+	if _, ok := s.store.Get(job.ID()); !ok {
+		return
+	}
+	pos := s.queue.Enqueue(job)
+	slog.Debug("job queued for retry", "id", job.ID(), "attempt", job.Attempt(), "position", pos)
+}
+
 // handleListResearch handles GET /research.
-// It returns the list of active jobs along with past run directories.
+// It returns the list of active jobs along with past run directories. The
+// parameters described at parseListQuery filter, order and page both lists.
 func (s *Server) handleListResearch(w http.ResponseWriter, r *http.Request) {
+	q, cursor, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.findJobList(q, cursor))
+}
+
+// jobList drops expired jobs and returns the active jobs along with past
+// run directories.
+func (s *Server) jobList() model.JobList {
+	return s.findJobList(model.ListQuery{}, listCursor{})
+}
+
+// findJobList drops expired jobs and returns the page of active jobs and
+// past run directories selected by q, continuing from cursor. A list that
+// the cursor marks as exhausted is left empty but still counted.
+func (s *Server) findJobList(q model.ListQuery, cursor listCursor) model.JobList {
 	s.store.CleanupExpired(maxJobAge)
 
-	active := s.store.List()
-	past := s.store.PastRuns(s.cwd)
+	var list model.JobList
+	var next listCursor
 
-	writeJSON(w, http.StatusOK, model.JobList{
-		Active: active,
-		Past:   past,
-	})
+	aq := q
+	aq.After = cursor.Active
+	list.Active, list.ActiveTotal, next.Active = s.store.FindJobs(aq)
+	if cursor.ActiveDone {
+		list.Active = nil
+		next.Active = nil
+	}
+
+	pq := q
+	pq.After = cursor.Past
+	list.Past, list.PastTotal, next.Past = s.store.FindPastRuns(s.cwd, pq)
+	if cursor.PastDone {
+		list.Past = nil
+		next.Past = nil
+	}
+
+	if next.Active != nil || next.Past != nil {
+		next.ActiveDone = next.Active == nil
+		next.PastDone = next.Past == nil
+		list.NextCursor = next.encode()
+	}
+	return list
+}
+
+// parseListQuery builds a list query and cursor from the list endpoint's
+// parameters:
+//
+//   - status, model: comma-separated values to keep;
+//   - since, until: RFC 3339 times or YYYY-MM-DD dates (UTC) bounding the
+//     creation time; an until date includes the whole day;
+//   - q: text to find in the query, report title or directory name,
+//     ignoring case;
+//   - order: desc (default), for newest first, or asc;
+//   - limit: maximum number of entries in each list; all when absent;
+//   - cursor: the next_cursor of the previous page.
+//
+// List parameters may also be repeated.
+func parseListQuery(q url.Values) (model.ListQuery, listCursor, error) {
+	var lq model.ListQuery
+	for _, v := range splitParam(q, "status") {
+		switch status := model.Status(v); status {
+		case model.StatusPending, model.StatusRunning, model.StatusCompleted,
+			model.StatusFailed, model.StatusCancelled, model.StatusUnknown:
+			lq.Statuses = append(lq.Statuses, status)
+		default:
+			return model.ListQuery{}, listCursor{}, fmt.Errorf("unknown status %q", v)
+		}
+	}
+	for _, v := range splitParam(q, "model") {
+		if !model.ValidModel(v) {
+			return model.ListQuery{}, listCursor{}, fmt.Errorf("unknown model %q", v)
+		}
+		lq.Models = append(lq.Models, model.ModelName(v))
+	}
+
+	for _, p := range []struct {
+		name     string
+		dst      *time.Time
+		dayAfter bool
+	}{
+		{"since", &lq.Since, false},
+		{"until", &lq.Until, true},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, v)
+			if err != nil {
+				return model.ListQuery{}, listCursor{}, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", p.name)
+			}
+			if p.dayAfter {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		*p.dst = t
+	}
+
+	lq.Text = strings.TrimSpace(q.Get("q"))
+
+	switch order := q.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		lq.Ascending = true
+	default:
+		return model.ListQuery{}, listCursor{}, fmt.Errorf("order must be asc or desc, got %q", order)
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return model.ListQuery{}, listCursor{}, errors.New("limit must be a positive integer")
+		}
+		lq.Limit = n
+	}
+
+	var cursor listCursor
+	if v := q.Get("cursor"); v != "" {
+		var err error
+		if cursor, err = decodeListCursor(v); err != nil {
+			return model.ListQuery{}, listCursor{}, errors.New("invalid cursor")
+		}
+	}
+	return lq, cursor, nil
+}
+
+// listCursor is the position of a page of the job list in each of its two
+// lists. A list is Done once its last entry has been served.
+type listCursor struct {
+	Active     *model.ListKey `json:"active,omitempty"`
+	Past       *model.ListKey `json:"past,omitempty"`
+	ActiveDone bool           `json:"active_done,omitempty"`
+	PastDone   bool           `json:"past_done,omitempty"`
+}
+
+// encode returns c as an opaque URL-safe string.
+func (c listCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListCursor parses a cursor returned by listCursor.encode.
+func decodeListCursor(s string) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
 }
 
 // handleGetResearch handles GET /research/{id}.
-// It returns the full job detail for the requested job.
+// It returns the job detail for the requested job. The filter parameters
+// described at parseEventFilter select and trim the events included, and
+// the paging parameters described at parseEventPage limit them to a page;
+// without paging parameters the whole log is returned.
 func (s *Server) handleGetResearch(w http.ResponseWriter, r *http.Request) {
 	job, ok := s.lookupJob(w, r)
 	if !ok {
 		return
 	}
-	writeJSON(w, http.StatusOK, job.ToDetail())
+	q := r.URL.Query()
+	filter, err := parseEventFilter(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := parseEventPage(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job.ToDetailPage(filter, page))
+}
+
+// handleListTools handles GET /research/{id}/tools.
+// It returns the job's tool calls paired with their results.
+func (s *Server) handleListTools(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, model.ToolCallList{
+		Tools: model.PairToolCalls(job.EventsSince(0)),
+	})
+}
+
+// handleListAgents handles GET /research/{id}/agents.
+// It returns the subagents spawned by the job, with their activity grouped
+// under the tool call that started them.
+func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, model.SubagentList{
+		Agents: model.BuildSubagents(job.EventsSince(0), model.ModelName(job.Model())),
+	})
 }
 
 // handleCancelResearch handles DELETE /research/{id}.
-// It sets the job status to cancelled and returns the updated status.
+// It marks the job cancelled, which also terminates its subprocess or drops
+// it from the run queue, and returns the updated status. Jobs that already
+// finished yield 409.
 func (s *Server) handleCancelResearch(w http.ResponseWriter, r *http.Request) {
 	job, ok := s.lookupJob(w, r)
 	if !ok {
 		return
 	}
-	job.SetStatus(model.StatusCancelled)
-	slog.Debug("job cancelled", "id", r.PathValue("id"))
+	if !s.cancelJob(job) {
+		writeError(w, http.StatusConflict, "job already finished")
+		return
+	}
+	writeJSON(w, http.StatusOK, job.ToStatus())
+}
+
+// cancelJob cancels job and drops it from the run queue. It returns false if
+// the job had already finished.
+func (s *Server) cancelJob(job *jobstore.Job) bool {
+	if !job.Cancel() {
+		return false
+	}
+	s.queue.Remove(job.ID())
+	slog.Debug("job cancelled", "id", job.ID())
+	return true
+}
+
+// moveRequest is the body accepted by PUT /research/{id}/position.
+type moveRequest struct {
+	Position int `json:"position"`
+}
+
+// handleMoveResearch handles PUT /research/{id}/position.
+// It moves a queued job to the given 1-based queue position and returns the
+// updated status. Jobs that are not waiting in the queue yield 409.
+func (s *Server) handleMoveResearch(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	var req moveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Position < 1 {
+		writeError(w, http.StatusBadRequest, "position must be at least 1")
+		return
+	}
+	if err := s.queue.Move(job.ID(), req.Position); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	slog.Debug("job moved in queue", "id", job.ID(), "position", req.Position)
 	writeJSON(w, http.StatusOK, job.ToStatus())
 }
 
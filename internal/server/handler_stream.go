@@ -8,23 +8,57 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/jamesprial/research-dashboard/internal/jobstore"
 	"github.com/jamesprial/research-dashboard/internal/model"
 )
 
+// sseRetryMS is the reconnection delay, in milliseconds, suggested to SSE
+// clients through the stream's retry field.
+const sseRetryMS = 3000
+
 // handleStreamResearch handles GET /research/{id}/stream.
-// It streams job events as Server-Sent Events (SSE). The optional query
-// parameter "after" specifies the cursor index to resume from (default 0).
-// The connection is held open and polled every 300ms until the job reaches
-// a terminal state or either the server or request context is cancelled.
+// It streams job events as Server-Sent Events (SSE), using each event's
+// Index as its SSE id. The optional query parameter "after" specifies the
+// cursor index to resume from (default 0); a Last-Event-ID header, sent by
+// reconnecting EventSource clients, takes precedence and resumes just after
+// the identified event. Negative cursors are rejected; a Last-Event-ID that
+// is not a number is ignored. The filter parameters described at parseEventFilter
+// select and trim the events sent; event ids are unaffected, so resuming a
+// filtered stream works the same way.
+// The handler sleeps until the job signals a change, so new events are
+// delivered as soon as they are recorded. While the job is idle a comment
+// line is sent every heartbeat interval to keep intermediaries from closing
+// the connection. The stream ends when the job reaches a terminal state or
+// either the server or request context is cancelled.
 func (s *Server) handleStreamResearch(w http.ResponseWriter, r *http.Request) {
 	job, ok := s.lookupJob(w, r)
 	if !ok {
 		return
 	}
 
+	filter, err := parseEventFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	after := 0
 	if v := r.URL.Query().Get("after"); v != "" {
-		after, _ = strconv.Atoi(v)
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "after must be a non-negative integer")
+			return
+		}
+		after = n
+	}
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if id, err := strconv.Atoi(v); err == nil {
+			if id < 0 {
+				writeError(w, http.StatusBadRequest, "Last-Event-ID must be a non-negative integer")
+				return
+			}
+			after = id + 1
+		}
 	}
 	slog.Debug("SSE stream opened", "job_id", r.PathValue("id"), "cursor", after)
 
@@ -33,39 +67,74 @@ func (s *Server) handleStreamResearch(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 
 	rc := http.NewResponseController(w)
-	ticker := time.NewTicker(300 * time.Millisecond)
-	defer ticker.Stop()
+	_, _ = fmt.Fprintf(w, "retry: %d\n\n", sseRetryMS)
+	_ = rc.Flush()
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
 
+	matcher := resumeMatcher(job, filter, after)
 	cursor := after
+	sendEvents := func() {
+		sent := 0
+		for _, evt := range job.EventsSince(cursor) {
+			cursor = evt.Index + 1
+			if !matcher.Match(evt) {
+				continue
+			}
+			data, _ := json.Marshal(filter.Dict(evt))
+			_, _ = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", evt.Index, data)
+			sent++
+		}
+		if sent > 0 {
+			_ = rc.Flush()
+			heartbeat.Reset(s.heartbeat)
+		}
+	}
 	for {
+		// Subscribe before reading so that a change landing between the
+		// read and the wait still wakes the loop.
+		changed := job.Changed()
+		sendEvents()
+
+		// Check whether the job has reached a terminal state. Events
+		// recorded between the read above and the status change are sent
+		// before done.
+		if status := job.Status(); status.IsTerminal() {
+			sendEvents()
+			doneData := map[string]string{
+				"status":     string(status),
+				"output_dir": job.OutputDir(),
+			}
+			data, _ := json.Marshal(doneData)
+			_, _ = fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			_ = rc.Flush()
+			return
+		}
+
 		select {
 		case <-s.ctx.Done():
 			return
 		case <-r.Context().Done():
 			return
-		case <-ticker.C:
-			events := job.EventsSince(cursor)
-			for _, evt := range events {
-				data, _ := json.Marshal(model.EventToDict(evt))
-				_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
-				cursor++
-			}
-			if len(events) > 0 {
-				_ = rc.Flush()
-			}
+		case <-changed:
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(w, ": heartbeat\n\n")
+			_ = rc.Flush()
+		}
+	}
+}
 
-			// Check whether the job has reached a terminal state.
-			status := job.Status()
-			if status == model.StatusCompleted || status == model.StatusFailed || status == model.StatusCancelled {
-				doneData := map[string]string{
-					"status":     string(status),
-					"output_dir": job.OutputDir(),
-				}
-				data, _ := json.Marshal(doneData)
-				_, _ = fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
-				_ = rc.Flush()
-				return
-			}
+// resumeMatcher returns a matcher for filter that has seen the job's events
+// before cursor, so that tool results after the cursor still match tool
+// calls made before it.
+func resumeMatcher(job *jobstore.Job, filter model.EventFilter, cursor int) *model.EventMatcher {
+	matcher := filter.Matcher()
+	if len(filter.Tools) > 0 && cursor > 0 {
+		prior := job.EventsSince(0)
+		for _, evt := range prior[:min(cursor, len(prior))] {
+			matcher.Match(evt)
 		}
 	}
+	return matcher
 }
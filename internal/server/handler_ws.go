@@ -0,0 +1,408 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/jobstore"
+	"github.com/jamesprial/research-dashboard/internal/model"
+	"github.com/jamesprial/research-dashboard/internal/websocket"
+)
+
+// jobListInterval is the minimum spacing between job-list updates pushed to
+// a WebSocket client, so that busy jobs do not flood it with snapshots.
+const jobListInterval = time.Second
+
+// WebSocket message types. Clients send subscribe, unsubscribe,
+// subscribe_jobs, unsubscribe_jobs, cancel and follow_up; the server sends
+// event, done, jobs, job and error.
+const (
+	wsSubscribe       = "subscribe"
+	wsUnsubscribe     = "unsubscribe"
+	wsSubscribeJobs   = "subscribe_jobs"
+	wsUnsubscribeJobs = "unsubscribe_jobs"
+	wsCancel          = "cancel"
+	wsFollowUp        = "follow_up"
+
+	wsEvent = "event"
+	wsDone  = "done"
+	wsJobs  = "jobs"
+	wsJob   = "job"
+	wsError = "error"
+)
+
+// wsRequest is a control message sent by a WebSocket client. Ref is an
+// optional client-chosen token echoed in the reply. After is the event
+// cursor for subscribe and the embedded wsFilter its event filter, and the
+// embedded FollowUpRequest carries the follow_up fields.
+type wsRequest struct {
+	Type  string `json:"type"`
+	Ref   string `json:"ref,omitempty"`
+	JobID string `json:"job_id,omitempty"`
+	After int    `json:"after,omitempty"`
+	wsFilter
+	model.FollowUpRequest
+}
+
+// wsFilter holds the event filter fields of a subscribe message. They mirror
+// the stream endpoint's query parameters (see parseEventFilter), with lists
+// given as JSON arrays.
+type wsFilter struct {
+	Types     []model.EventType    `json:"types,omitempty"`
+	Subtypes  []model.EventSubtype `json:"subtypes,omitempty"`
+	Tools     []string             `json:"tools,omitempty"`
+	MaxResult int                  `json:"max_result,omitempty"`
+	MaxInput  int                  `json:"max_input,omitempty"`
+	Omit      []string             `json:"omit,omitempty"`
+}
+
+// eventFilter validates f and converts it to an event filter.
+func (f wsFilter) eventFilter() (model.EventFilter, error) {
+	if f.MaxResult < 0 {
+		return model.EventFilter{}, errors.New("max_result must be a non-negative integer")
+	}
+	if f.MaxInput < 0 {
+		return model.EventFilter{}, errors.New("max_input must be a non-negative integer")
+	}
+	filter := model.EventFilter{
+		Types:     f.Types,
+		Subtypes:  f.Subtypes,
+		Tools:     f.Tools,
+		MaxResult: f.MaxResult,
+		MaxInput:  f.MaxInput,
+	}
+	for _, v := range f.Omit {
+		if err := setOmit(&filter, v); err != nil {
+			return model.EventFilter{}, err
+		}
+	}
+	return filter, nil
+}
+
+// wsMessage is a message sent to a WebSocket client.
+type wsMessage struct {
+	Type      string           `json:"type"`
+	Ref       string           `json:"ref,omitempty"`
+	JobID     string           `json:"job_id,omitempty"`
+	Event     map[string]any   `json:"event,omitempty"`
+	Status    model.Status     `json:"status,omitempty"`
+	OutputDir *string          `json:"output_dir,omitempty"`
+	Job       *model.JobStatus `json:"job,omitempty"`
+	Jobs      *model.JobList   `json:"jobs,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// handleWebSocket handles GET /ws.
+// It upgrades the connection to a WebSocket over which a client can follow
+// the events of any number of jobs, receive job-list updates, and cancel or
+// follow up on jobs. See wsRequest and wsMessage for the message format.
+// Pings are sent every heartbeat interval to keep the connection alive.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		slog.Debug("websocket upgrade failed", "err", err)
+		return
+	}
+	slog.Debug("websocket opened", "remote", conn.RemoteAddr())
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	sess := &wsSession{
+		server: s,
+		conn:   conn,
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[string]wsSubscription),
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.CloseWithStatus(websocket.CloseGoingAway, "")
+	})
+	defer func() {
+		cancel()
+		stop()
+		sess.wg.Wait()
+		_ = conn.Close()
+		slog.Debug("websocket closed", "remote", conn.RemoteAddr())
+	}()
+
+	sess.wg.Go(sess.ping)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			sess.send(wsMessage{Type: wsError, Error: "invalid message"})
+			continue
+		}
+		sess.handle(req)
+	}
+}
+
+// wsSession is the state of one WebSocket connection. Its subscriptions are
+// only modified by the goroutine reading from the connection.
+type wsSession struct {
+	server *Server
+	conn   *websocket.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	subs       map[string]wsSubscription
+	stopListen context.CancelFunc
+}
+
+// wsSubscription is a running job event stream. done is closed once its
+// goroutine has returned.
+type wsSubscription struct {
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// handle dispatches a single client request.
+func (c *wsSession) handle(req wsRequest) {
+	switch req.Type {
+	case wsSubscribe:
+		if req.After < 0 {
+			c.sendError(req, errors.New("after must be a non-negative integer"))
+			return
+		}
+		filter, err := req.eventFilter()
+		if err != nil {
+			c.sendError(req, err)
+			return
+		}
+		job, ok := c.lookup(req)
+		if !ok {
+			return
+		}
+		// The new stream waits for the previous one to stop, so that the two
+		// never interleave their events. It waits on its own goroutine: the
+		// previous stream may be blocked writing to the client, and this
+		// goroutine must stay free to read control messages.
+		prev, resubscribed := c.subs[job.ID()]
+		c.unsubscribe(job.ID())
+		ctx, stop := context.WithCancel(c.ctx)
+		sub := wsSubscription{stop: stop, done: make(chan struct{})}
+		c.subs[job.ID()] = sub
+		c.wg.Go(func() {
+			defer close(sub.done)
+			if resubscribed {
+				<-prev.done
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			c.streamJob(ctx, job, req.After, filter)
+		})
+
+	case wsUnsubscribe:
+		c.unsubscribe(req.JobID)
+
+	case wsSubscribeJobs:
+		if c.stopListen != nil {
+			return
+		}
+		ctx, stop := context.WithCancel(c.ctx)
+		c.stopListen = stop
+		c.wg.Go(func() { c.streamJobList(ctx) })
+
+	case wsUnsubscribeJobs:
+		if c.stopListen != nil {
+			c.stopListen()
+			c.stopListen = nil
+		}
+
+	case wsCancel:
+		job, ok := c.lookup(req)
+		if !ok {
+			return
+		}
+		if !c.server.cancelJob(job) {
+			c.sendError(req, errors.New("job already finished"))
+			return
+		}
+		status := job.ToStatus()
+		c.send(wsMessage{Type: wsJob, Ref: req.Ref, JobID: job.ID(), Job: &status})
+
+	case wsFollowUp:
+		parent, ok := c.lookup(req)
+		if !ok {
+			return
+		}
+		job, _, err := c.server.startFollowUp(parent, req.FollowUpRequest)
+		if err != nil {
+			c.sendError(req, err)
+			return
+		}
+		status := job.ToStatus()
+		c.send(wsMessage{Type: wsJob, Ref: req.Ref, JobID: job.ID(), Job: &status})
+
+	default:
+		c.sendError(req, errors.New("unknown message type"))
+	}
+}
+
+// unsubscribe stops the stream of the job with the given ID, if any. The
+// stream returns once a write in progress completes.
+func (c *wsSession) unsubscribe(jobID string) {
+	sub, ok := c.subs[jobID]
+	if !ok {
+		return
+	}
+	sub.stop()
+	delete(c.subs, jobID)
+}
+
+// lookup resolves the job named by req, replying with an error if it does
+// not exist.
+func (c *wsSession) lookup(req wsRequest) (*jobstore.Job, bool) {
+	job, ok := c.server.store.Get(req.JobID)
+	if !ok {
+		c.sendError(req, errors.New("job not found"))
+	}
+	return job, ok
+}
+
+// streamJob sends the job's events from cursor onwards that match filter as
+// they are recorded, followed by a done message once the job reaches a
+// terminal state.
+func (c *wsSession) streamJob(ctx context.Context, job *jobstore.Job, cursor int, filter model.EventFilter) {
+	matcher := resumeMatcher(job, filter, cursor)
+	sendEvents := func() bool {
+		for _, evt := range job.EventsSince(cursor) {
+			cursor = evt.Index + 1
+			if !matcher.Match(evt) {
+				continue
+			}
+			if !c.send(wsMessage{Type: wsEvent, JobID: job.ID(), Event: filter.Dict(evt)}) {
+				return false
+			}
+		}
+		return true
+	}
+	for {
+		changed := job.Changed()
+		if !sendEvents() {
+			return
+		}
+
+		// Events recorded between the read above and the status change
+		// are sent before done.
+		if status := job.Status(); status.IsTerminal() {
+			if !sendEvents() {
+				return
+			}
+			outputDir := job.OutputDir()
+			c.send(wsMessage{Type: wsDone, JobID: job.ID(), Status: status, OutputDir: &outputDir})
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// streamJobList sends the job list now and again whenever the store changes,
+// at most once per jobListInterval. The list is shared with other sessions
+// woken by the same change; see Server.sharedJobList.
+func (c *wsSession) streamJobList(ctx context.Context) {
+	since := time.Now()
+	for {
+		list, changed := c.server.sharedJobList(since)
+		if !c.send(wsMessage{Type: wsJobs, Jobs: &list}) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+		since = time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jobListInterval):
+		}
+	}
+}
+
+// jobListCache is the job list last built for WebSocket sessions. changed is
+// the store's change channel obtained just before it was built, at builtAt.
+type jobListCache struct {
+	mu      sync.Mutex
+	list    model.JobList
+	builtAt time.Time
+	changed <-chan struct{}
+}
+
+// sharedJobList returns the job list for a session that learnt of a change
+// at since, together with the channel that fires on the next change to it.
+// A list built after since, or one the store has not changed since, is
+// reused, so that sessions woken by the same change share a single scan of
+// the store and the past runs on disk.
+func (s *Server) sharedJobList(since time.Time) (model.JobList, <-chan struct{}) {
+	c := &s.listCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.changed != nil {
+		select {
+		case <-c.changed:
+			if !c.builtAt.Before(since) {
+				return c.list, c.changed
+			}
+		default:
+			return c.list, c.changed
+		}
+	}
+	c.builtAt = time.Now()
+	c.changed = s.store.Changed()
+	c.list = s.jobList()
+	return c.list, c.changed
+}
+
+// ping sends a ping every heartbeat interval until the session ends.
+func (c *wsSession) ping() {
+	ticker := time.NewTicker(c.server.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.conn.Ping(); err != nil {
+				c.cancel()
+				return
+			}
+		}
+	}
+}
+
+// send writes msg to the client. On a write failure the session is ended
+// and send returns false.
+func (c *wsSession) send(msg wsMessage) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("websocket: failed to encode message", "type", msg.Type, "err", err)
+		return true
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		c.cancel()
+		return false
+	}
+	return true
+}
+
+// sendError replies to req with an error message.
+func (c *wsSession) sendError(req wsRequest, err error) {
+	c.send(wsMessage{Type: wsError, Ref: req.Ref, JobID: req.JobID, Error: err.Error()})
+}
@@ -10,23 +10,56 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/jamesprial/research-dashboard/internal/backend"
 	"github.com/jamesprial/research-dashboard/internal/jobstore"
+	"github.com/jamesprial/research-dashboard/internal/model"
+	"github.com/jamesprial/research-dashboard/internal/queue"
 )
 
 // maxJobAge is the duration after which completed, failed, or cancelled jobs
 // are eligible for removal during a cleanup pass.
 const maxJobAge = 24 * time.Hour
 
+// DefaultMaxConcurrentJobs is the number of research jobs that may run at
+// once when no WithMaxConcurrentJobs option is given.
+const DefaultMaxConcurrentJobs = 2
+
+// DefaultJobTimeout is the wall-clock limit applied to jobs that do not
+// request their own timeout, when no WithDefaultJobTimeout option is given.
+const DefaultJobTimeout = 2 * time.Hour
+
+// DefaultMaxJobTimeout is the largest timeout a job may request when no
+// WithMaxJobTimeout option is given.
+const DefaultMaxJobTimeout = 6 * time.Hour
+
+// DefaultHeartbeatInterval is how often an idle SSE stream sends a comment
+// line when no WithHeartbeatInterval option is given.
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// DefaultRetryPolicy is the retry policy of jobs whose request does not
+// override it, when no WithRetryPolicy option is given: up to three attempts
+// for rate-limit and network failures, backing off from 30 seconds.
+var DefaultRetryPolicy = model.RetryPolicy{
+	MaxAttempts:       3,
+	BackoffSeconds:    30,
+	MaxBackoffSeconds: 600,
+	RetryOn:           []model.ErrorKind{model.ErrorKindRateLimited, model.ErrorKindNetwork},
+}
+
 // pastRunPrefix is the URL prefix for past-run routes. These are handled
 // outside the mux to avoid Go 1.22+ ServeMux ambiguity with the
 // GET /research/{id}/files/{path...} wildcard pattern.
 const pastRunPrefix = "/research/past/"
 
-// JobRunner launches a research job subprocess.
+// JobRunner runs research jobs.
 type JobRunner interface {
 	Run(ctx context.Context, job *jobstore.Job, store *jobstore.Store) error
+	// Capabilities reports the optional features of the backend the runner
+	// executes jobs on.
+	Capabilities() backend.Capabilities
 }
 
 // Server holds dependencies and the HTTP mux.
@@ -36,24 +69,107 @@ type Server struct {
 	staticFS fs.FS
 	cwd      string
 	mux      *http.ServeMux
-	ctx      context.Context // server lifetime context for SSE shutdown
+	ctx      context.Context // server lifetime context for SSE and job shutdown
+	queue    *queue.Queue
+
+	// jobs counts running jobs so that Wait can block until they have
+	// stopped. Once stopping is set, no further job is started.
+	jobsMu   sync.Mutex
+	jobs     sync.WaitGroup
+	stopping bool
+
+	listCache jobListCache
+
+	maxConcurrent  int
+	defaultTimeout time.Duration
+	maxTimeout     time.Duration
+	heartbeat      time.Duration
+	retryPolicy    model.RetryPolicy
+}
+
+// Option configures optional Server behavior.
+type Option func(*Server)
+
+// WithMaxConcurrentJobs limits how many research jobs run at once. Further
+// submissions wait in a FIFO queue. Values below 1 are treated as 1.
+func WithMaxConcurrentJobs(n int) Option {
+	return func(s *Server) {
+		s.maxConcurrent = n
+	}
+}
+
+// WithDefaultJobTimeout sets the wall-clock limit for jobs that do not
+// request a timeout. It is capped at the maximum job timeout.
+func WithDefaultJobTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.defaultTimeout = d
+	}
+}
+
+// WithMaxJobTimeout sets the largest timeout a job may request. Requests
+// above it are rejected.
+func WithMaxJobTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.maxTimeout = d
+	}
+}
+
+// WithHeartbeatInterval sets how often an SSE stream with no new events sends
+// a comment line, keeping proxies from closing idle connections.
+// Non-positive values select DefaultHeartbeatInterval.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(s *Server) {
+		s.heartbeat = d
+	}
+}
+
+// WithRetryPolicy sets the retry policy of jobs whose request does not
+// override it. Fields a request leaves unset are taken from it too.
+func WithRetryPolicy(p model.RetryPolicy) Option {
+	return func(s *Server) {
+		s.retryPolicy = p
+	}
 }
 
 // New creates a Server, registers all routes, and returns it.
-// ctx is used to signal SSE connections to close when the server shuts down.
-func New(store *jobstore.Store, runner JobRunner, staticFS fs.FS, cwd string, ctx context.Context) *Server {
+// ctx is the server's lifetime: cancelling it closes SSE and WebSocket
+// connections and stops every running job.
+func New(store *jobstore.Store, runner JobRunner, staticFS fs.FS, cwd string, ctx context.Context, opts ...Option) *Server {
 	s := &Server{
-		store:    store,
-		runner:   runner,
-		staticFS: staticFS,
-		cwd:      cwd,
-		ctx:      ctx,
+		store:          store,
+		runner:         runner,
+		staticFS:       staticFS,
+		cwd:            cwd,
+		ctx:            ctx,
+		maxConcurrent:  DefaultMaxConcurrentJobs,
+		defaultTimeout: DefaultJobTimeout,
+		maxTimeout:     DefaultMaxJobTimeout,
+		heartbeat:      DefaultHeartbeatInterval,
+		retryPolicy:    DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.defaultTimeout = min(s.defaultTimeout, s.maxTimeout)
+	if s.heartbeat <= 0 {
+		s.heartbeat = DefaultHeartbeatInterval
 	}
+	s.queue = queue.New(s.maxConcurrent, s.runJob)
 	s.mux = http.NewServeMux()
 	s.registerRoutes()
 	return s
 }
 
+// Wait blocks until every running job has returned, and keeps queued jobs
+// from starting. Call it after cancelling the server's context, so that the
+// jobs' subprocesses are stopped before the process exits.
+func (s *Server) Wait() {
+	s.jobsMu.Lock()
+	s.stopping = true
+	s.jobsMu.Unlock()
+	s.jobs.Wait()
+}
+
 // ServeHTTP implements http.Handler. Past-run routes are intercepted here
 // before reaching the mux to avoid registration conflicts with the
 // /research/{id}/files/{path...} wildcard pattern.
@@ -80,11 +196,19 @@ func (s *Server) registerRoutes() {
 	s.mux.HandleFunc("GET /research", s.handleListResearch)
 	s.mux.HandleFunc("GET /research/{id}", s.handleGetResearch)
 	s.mux.HandleFunc("DELETE /research/{id}", s.handleCancelResearch)
+	s.mux.HandleFunc("PUT /research/{id}/position", s.handleMoveResearch)
+	s.mux.HandleFunc("POST /research/{id}/followup", s.handleFollowUpResearch)
 	s.mux.HandleFunc("GET /research/{id}/stream", s.handleStreamResearch)
+	s.mux.HandleFunc("GET /research/{id}/events/{index}", s.handleGetEvent)
+	s.mux.HandleFunc("GET /research/{id}/tools", s.handleListTools)
+	s.mux.HandleFunc("GET /research/{id}/agents", s.handleListAgents)
 	s.mux.HandleFunc("GET /research/{id}/report", s.handleGetReport)
 	s.mux.HandleFunc("GET /research/{id}/files", s.handleListJobFiles)
 	s.mux.HandleFunc("GET /research/{id}/files/{path...}", s.handleGetJobFile)
 
+	// WebSocket: multiplexed job events and control
+	s.mux.HandleFunc("GET /ws", s.handleWebSocket)
+
 	// Past runs: handled in ServeHTTP to avoid mux conflict.
 }
 
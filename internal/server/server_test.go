@@ -1,20 +1,27 @@
 package server_test
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"testing/fstest"
 	"time"
 
+	"github.com/jamesprial/research-dashboard/internal/backend"
 	"github.com/jamesprial/research-dashboard/internal/jobstore"
 	"github.com/jamesprial/research-dashboard/internal/model"
+	"github.com/jamesprial/research-dashboard/internal/runner"
 	"github.com/jamesprial/research-dashboard/internal/server"
+	"github.com/jamesprial/research-dashboard/internal/websocket"
 )
 
 // noopRunner satisfies the server.JobRunner interface without launching any subprocess.
@@ -24,6 +31,53 @@ func (noopRunner) Run(_ context.Context, _ *jobstore.Job, _ *jobstore.Store) err
 	return nil
 }
 
+func (noopRunner) Capabilities() backend.Capabilities {
+	return backend.Capabilities{Resume: true, OutputDir: true}
+}
+
+// blockingRunner satisfies server.JobRunner by marking the job running and
+// then blocking until its context is cancelled or release is closed.
+type blockingRunner struct {
+	noopRunner
+	release chan struct{}
+}
+
+func (b blockingRunner) Run(ctx context.Context, job *jobstore.Job, _ *jobstore.Store) error {
+	if !job.TryStart() {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+	case <-b.release:
+		job.SetStatus(model.StatusCompleted)
+	}
+	return nil
+}
+
+// flakyRunner satisfies server.JobRunner by scheduling an immediate retry of
+// each job's first attempt and completing later attempts. runs receives the
+// attempt number of every run.
+// flakyRunner fails a job's first attempt with a retry due after delay, and
+// completes its second. It reports each attempt on runs.
+type flakyRunner struct {
+	noopRunner
+	runs  chan int
+	delay time.Duration
+}
+
+func (f flakyRunner) Run(_ context.Context, job *jobstore.Job, _ *jobstore.Store) error {
+	if !job.TryStart() {
+		return nil
+	}
+	f.runs <- job.Attempt()
+	if job.Attempt() == 1 {
+		job.ScheduleRetry(model.ErrorKindRateLimited, "rate limited", time.Now().Add(f.delay))
+		return nil
+	}
+	job.SetStatus(model.StatusCompleted)
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // Test helpers
 // ---------------------------------------------------------------------------
@@ -47,6 +101,43 @@ func newTestServer(t *testing.T) (*server.Server, *jobstore.Store, string) {
 	return srv, store, cwd
 }
 
+// newTestServerWith constructs a test server using the given runner and
+// server options.
+func newTestServerWith(t *testing.T, runner server.JobRunner, opts ...server.Option) (*server.Server, *jobstore.Store, string) {
+	t.Helper()
+	staticFS := fstest.MapFS{}
+	store := jobstore.NewStore()
+	cwd := t.TempDir()
+	srv := server.New(store, runner, staticFS, cwd, context.Background(), opts...)
+	return srv, store, cwd
+}
+
+// startJob POSTs a research request and returns the decoded JobStatus.
+func startJob(t *testing.T, srv http.Handler, query string) model.JobStatus {
+	t.Helper()
+	rr := doRequest(t, srv, http.MethodPost, "/research", `{"query":"`+query+`"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("POST /research status = %d, want %d; body: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var status model.JobStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return status
+}
+
+// waitForStatus polls the job until it reaches want or the deadline passes.
+func waitForStatus(t *testing.T, job *jobstore.Job, want model.Status) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for job.Status() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s status = %q, want %q", job.ID(), job.Status(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func doRequest(t *testing.T, srv http.Handler, method, target, body string) *httptest.ResponseRecorder {
 	t.Helper()
 	var reqBody *strings.Reader
@@ -140,6 +231,176 @@ func Test_HandleStartResearch_ValidBody_Returns201(t *testing.T) {
 	}
 }
 
+func Test_HandleStartResearch_AssignsOutputDir(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	status := startJob(t, srv, "solid-state batteries")
+
+	if status.OutputDir == nil {
+		t.Fatal("OutputDir is nil, want the dir assigned at creation")
+	}
+	dir := *status.OutputDir
+	if filepath.Dir(dir) != cwd || !strings.HasPrefix(filepath.Base(dir), "research-solid-state-batteries-") {
+		t.Errorf("OutputDir = %q, want research-solid-state-batteries-* in %q", dir, cwd)
+	}
+	if store.ClaimDir(dir) {
+		t.Error("ClaimDir() = true, want the assigned dir to be claimed")
+	}
+}
+
+func Test_HandleStartResearch_WithBudget(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	body := `{"query":"test topic","max_cost_usd":1.5,"max_tokens":50000}`
+	rr := doRequest(t, srv, http.MethodPost, "/research", body)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var status model.JobStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if status.MaxCostUSD != 1.5 || status.MaxTokens != 50000 {
+		t.Errorf("MaxCostUSD/MaxTokens = %v/%d, want 1.5/50000", status.MaxCostUSD, status.MaxTokens)
+	}
+
+	rr = doRequest(t, srv, http.MethodPost, "/research", `{"query":"test topic","max_tokens":-5}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("negative max_tokens: status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func Test_HandleStartResearch_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	srv, store, _ := newTestServerWith(t, &blockingRunner{release: release},
+		server.WithDefaultJobTimeout(30*time.Minute), server.WithMaxJobTimeout(time.Hour))
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     time.Duration
+	}{
+		{"default applied", `{"query":"q"}`, http.StatusCreated, 30 * time.Minute},
+		{"requested", `{"query":"q","timeout_seconds":600}`, http.StatusCreated, 10 * time.Minute},
+		{"at maximum", `{"query":"q","timeout_seconds":3600}`, http.StatusCreated, time.Hour},
+		{"above maximum", `{"query":"q","timeout_seconds":3601}`, http.StatusBadRequest, 0},
+		{"negative", `{"query":"q","timeout_seconds":-1}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doRequest(t, srv, http.MethodPost, "/research", tt.body)
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %s", rr.Code, tt.wantCode, rr.Body.String())
+			}
+			if tt.wantCode != http.StatusCreated {
+				return
+			}
+			var status model.JobStatus
+			if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			job, _ := store.Get(status.ID)
+			if job.Timeout() != tt.want {
+				t.Errorf("Timeout() = %v, want %v", job.Timeout(), tt.want)
+			}
+			if status.TimeoutSeconds != int(tt.want/time.Second) {
+				t.Errorf("TimeoutSeconds = %d, want %d", status.TimeoutSeconds, int(tt.want/time.Second))
+			}
+		})
+	}
+}
+
+func Test_HandleStartResearch_RetryPolicy(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	serverPolicy := model.RetryPolicy{
+		MaxAttempts:       2,
+		BackoffSeconds:    10,
+		MaxBackoffSeconds: 60,
+		RetryOn:           []model.ErrorKind{model.ErrorKindRateLimited},
+	}
+	srv, store, _ := newTestServerWith(t, &blockingRunner{release: release},
+		server.WithRetryPolicy(serverPolicy))
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     model.RetryPolicy
+	}{
+		{"server policy", `{"query":"q"}`, http.StatusCreated, serverPolicy},
+		{"overridden", `{"query":"q","retry":{"max_attempts":4,"retry_on":["crash"]}}`, http.StatusCreated,
+			model.RetryPolicy{MaxAttempts: 4, BackoffSeconds: 10, MaxBackoffSeconds: 60, RetryOn: []model.ErrorKind{model.ErrorKindCrash}}},
+		{"too many attempts", `{"query":"q","retry":{"max_attempts":11}}`, http.StatusBadRequest, model.RetryPolicy{}},
+		{"not retryable", `{"query":"q","retry":{"retry_on":["auth_failed"]}}`, http.StatusBadRequest, model.RetryPolicy{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doRequest(t, srv, http.MethodPost, "/research", tt.body)
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %s", rr.Code, tt.wantCode, rr.Body.String())
+			}
+			if tt.wantCode != http.StatusCreated {
+				return
+			}
+			var status model.JobStatus
+			if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			job, _ := store.Get(status.ID)
+			if got := job.RetryPolicy(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RetryPolicy() = %+v, want %+v", got, tt.want)
+			}
+			if status.MaxAttempts != tt.want.MaxAttempts {
+				t.Errorf("MaxAttempts = %d, want %d", status.MaxAttempts, tt.want.MaxAttempts)
+			}
+		})
+	}
+}
+
+func Test_RunJob_RequeuesRetry(t *testing.T) {
+	runs := make(chan int, 2)
+	srv, store, _ := newTestServerWith(t, flakyRunner{runs: runs})
+
+	status := startJob(t, srv, "flaky topic")
+	job, _ := store.Get(status.ID)
+	for want := 1; want <= 2; want++ {
+		select {
+		case got := <-runs:
+			if got != want {
+				t.Errorf("run attempt = %d, want %d", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %d did not run", want)
+		}
+	}
+	waitForStatus(t, job, model.StatusCompleted)
+	if job.Attempt() != 2 {
+		t.Errorf("Attempt() = %d, want 2", job.Attempt())
+	}
+}
+
+func Test_RunJob_ShutdownStopsPendingRetry(t *testing.T) {
+	runs := make(chan int, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	store := jobstore.NewStore()
+	srv := server.New(store, flakyRunner{runs: runs, delay: 200 * time.Millisecond}, fstest.MapFS{}, t.TempDir(), ctx)
+
+	startJob(t, srv, "flaky topic")
+	if got := <-runs; got != 1 {
+		t.Fatalf("run attempt = %d, want 1", got)
+	}
+	cancel()
+	srv.Wait()
+
+	select {
+	case got := <-runs:
+		t.Errorf("attempt %d ran after shutdown", got)
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
 func Test_HandleStartResearch_EmptyQuery_Returns400(t *testing.T) {
 	srv, _, _ := newTestServer(t)
 	body := `{"query":"","model":"opus","max_turns":10}`
@@ -245,6 +506,136 @@ func Test_HandleListResearch_EmptyStore_ReturnsEmptyArrays(t *testing.T) {
 	}
 }
 
+func Test_HandleListResearch_FiltersBothLists(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	_ = store.Create("solar-job", "solar power", "opus", 10, cwd)
+	_ = store.Create("wind-job", "wind power", "sonnet", 10, cwd)
+	for _, name := range []string{"research-solar-farms-20240101", "research-wind-farms-20240101"} {
+		if err := os.MkdirAll(filepath.Join(cwd, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr := doRequest(t, srv, http.MethodGet, "/research?q=Solar", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var list model.JobList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Active) != 1 || list.Active[0].ID != "solar-job" {
+		t.Errorf("Active = %+v, want only solar-job", list.Active)
+	}
+	if len(list.Past) != 1 || list.Past[0].Name != "research-solar-farms-20240101" {
+		t.Errorf("Past = %+v, want only research-solar-farms-20240101", list.Past)
+	}
+	if list.ActiveTotal != 1 || list.PastTotal != 1 {
+		t.Errorf("totals = (%d, %d), want (1, 1)", list.ActiveTotal, list.PastTotal)
+	}
+	if list.NextCursor != "" {
+		t.Errorf("NextCursor = %q, want empty", list.NextCursor)
+	}
+
+	rr = doRequest(t, srv, http.MethodGet, "/research?model=sonnet&status=pending", "")
+	list = model.JobList{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Active) != 1 || list.Active[0].ID != "wind-job" {
+		t.Errorf("Active = %+v, want only wind-job", list.Active)
+	}
+	if len(list.Past) != 0 {
+		t.Errorf("len(Past) = %d, want 0 (past runs without a manifest have no model)", len(list.Past))
+	}
+
+	rr = doRequest(t, srv, http.MethodGet, "/research?status=unknown", "")
+	list = model.JobList{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Active) != 0 || len(list.Past) != 2 {
+		t.Errorf("got %d active and %d past, want 0 and 2 (past runs without a manifest or report)", len(list.Active), len(list.Past))
+	}
+	for _, run := range list.Past {
+		if run.Status != model.StatusUnknown {
+			t.Errorf("Past %s status = %q, want %q", run.Name, run.Status, model.StatusUnknown)
+		}
+	}
+}
+
+func Test_HandleListResearch_PagesWithCursor(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	for i := range 3 {
+		_ = store.Create(fmt.Sprintf("job-%d", i), "query", "opus", 10, cwd)
+	}
+	for i := range 5 {
+		created := time.Date(2024, 1, 1+i, 12, 0, 0, 0, time.UTC)
+		if err := os.MkdirAll(filepath.Join(cwd, model.OutputDirName("topic", created, fmt.Sprintf("past-%d", i))), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var active, past []string
+	path := "/research?limit=2"
+	for page := 0; ; page++ {
+		if page > 5 {
+			t.Fatal("paging did not end")
+		}
+		rr := doRequest(t, srv, http.MethodGet, path, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("page %d: status = %d, want %d: %s", page, rr.Code, http.StatusOK, rr.Body)
+		}
+		var list model.JobList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if list.ActiveTotal != 3 || list.PastTotal != 5 {
+			t.Errorf("page %d: totals = (%d, %d), want (3, 5)", page, list.ActiveTotal, list.PastTotal)
+		}
+		if len(list.Active) > 2 || len(list.Past) > 2 {
+			t.Errorf("page %d: page sizes = (%d, %d), want at most 2", page, len(list.Active), len(list.Past))
+		}
+		for _, j := range list.Active {
+			active = append(active, j.ID)
+		}
+		for _, r := range list.Past {
+			past = append(past, r.Name)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		path = "/research?limit=2&cursor=" + list.NextCursor
+	}
+
+	if want := []string{"job-2", "job-1", "job-0"}; !slices.Equal(active, want) {
+		t.Errorf("active pages = %v, want %v", active, want)
+	}
+	if len(past) != 5 || !slices.IsSortedFunc(past, func(a, b string) int { return strings.Compare(b, a) }) {
+		t.Errorf("past pages = %v, want all 5 runs newest first", past)
+	}
+}
+
+func Test_HandleListResearch_InvalidParams_Returns400(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	for _, query := range []string{
+		"status=done",
+		"model=gpt",
+		"since=yesterday",
+		"until=2024-13-01",
+		"order=random",
+		"limit=0",
+		"cursor=not-a-cursor",
+	} {
+		t.Run(query, func(t *testing.T) {
+			rr := doRequest(t, srv, http.MethodGet, "/research?"+query, "")
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // GET /research/{id}
 // ---------------------------------------------------------------------------
@@ -274,6 +665,143 @@ func Test_HandleGetResearch_ExistingJob_ReturnsDetail(t *testing.T) {
 	}
 }
 
+func Test_HandleGetResearch_EventFilter(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("detail-filter", "query", "opus", 10, cwd)
+	job.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeSystem, Text: "init"})
+	job.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "t1", ToolResult: "big body"})
+
+	rr := doRequest(t, srv, http.MethodGet, "/research/detail-filter?types=user&omit=tool_result", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var detail model.JobDetail
+	if err := json.Unmarshal(rr.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(detail.Events) != 1 {
+		t.Fatalf("len(Events) = %d, want 1", len(detail.Events))
+	}
+	evt := detail.Events[0]
+	if _, ok := evt["tool_result"]; ok || evt["tool_result_truncated"] != true {
+		t.Errorf("event = %v, want tool_result omitted and flagged", evt)
+	}
+
+	rr = doRequest(t, srv, http.MethodGet, "/research/detail-filter?max_result=x", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid max_result: status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func Test_HandleGetResearch_Pagination(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("detail-page", "query", "opus", 10, cwd)
+	for i := range 10 {
+		evt := model.ParsedEvent{Index: i, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Text: "t"}
+		switch i {
+		case 2:
+			evt = model.ParsedEvent{Index: i, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Bash", ToolUseID: "b1"}
+		case 7:
+			evt = model.ParsedEvent{Index: i, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "b1", ToolResult: "ok"}
+		}
+		job.AddEvent(evt)
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantIndexes []int
+		wantNext    int // -1 when the log is exhausted
+	}{
+		{"no paging returns all", "", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, -1},
+		{"first page", "?limit=3", []int{0, 1, 2}, 3},
+		{"middle page", "?offset=3&limit=3", []int{3, 4, 5}, 6},
+		{"last page", "?offset=8&limit=3", []int{8, 9}, -1},
+		{"exact last page", "?offset=7&limit=3", []int{7, 8, 9}, -1},
+		{"offset past end", "?offset=20", []int{}, -1},
+		{"latest events", "?order=desc&limit=3", []int{9, 8, 7}, 7},
+		{"page backwards", "?order=desc&offset=7&limit=3", []int{6, 5, 4}, 4},
+		{"backwards to start", "?order=desc&offset=2&limit=3", []int{1, 0}, -1},
+		{"desc without limit", "?order=desc&offset=3", []int{2, 1, 0}, -1},
+		{"filtered page", "?types=user&limit=1", []int{7}, 8},
+		{"tool filter in reverse", "?tools=Bash&order=desc&limit=1", []int{7}, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doRequest(t, srv, http.MethodGet, "/research/detail-page"+tt.query, "")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d; body: %s", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			var detail model.JobDetail
+			if err := json.Unmarshal(rr.Body.Bytes(), &detail); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			got := make([]int, 0, len(detail.Events))
+			for _, evt := range detail.Events {
+				got = append(got, int(evt["index"].(float64)))
+			}
+			if !slices.Equal(got, tt.wantIndexes) {
+				t.Errorf("event indexes = %v, want %v", got, tt.wantIndexes)
+			}
+			if detail.EventsTotal != 10 {
+				t.Errorf("EventsTotal = %d, want 10", detail.EventsTotal)
+			}
+			next := -1
+			if detail.NextOffset != nil {
+				next = *detail.NextOffset
+			}
+			if next != tt.wantNext {
+				t.Errorf("NextOffset = %d, want %d", next, tt.wantNext)
+			}
+		})
+	}
+
+	for _, q := range []string{"?offset=-1", "?limit=0", "?limit=x", "?order=sideways"} {
+		rr := doRequest(t, srv, http.MethodGet, "/research/detail-page"+q, "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", q, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func Test_HandleGetEvent(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("single-event", "query", "opus", 10, cwd)
+	job.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeSystem, Text: "init"})
+	job.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolResult: "full body"})
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+	}{
+		{"existing event", "/research/single-event/events/1", http.StatusOK},
+		{"out of range", "/research/single-event/events/2", http.StatusNotFound},
+		{"negative index", "/research/single-event/events/-1", http.StatusBadRequest},
+		{"non-numeric index", "/research/single-event/events/abc", http.StatusBadRequest},
+		{"missing job", "/research/nope/events/0", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doRequest(t, srv, http.MethodGet, tt.target, "")
+			if rr.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %s", rr.Code, tt.wantCode, rr.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var evt map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &evt); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if evt["tool_result"] != "full body" || evt["index"] != float64(1) {
+				t.Errorf("event = %v, want index 1 with its full tool_result", evt)
+			}
+		})
+	}
+}
+
 func Test_HandleGetResearch_NonExistent_Returns404(t *testing.T) {
 	srv, _, _ := newTestServer(t)
 	rr := doRequest(t, srv, http.MethodGet, "/research/does-not-exist", "")
@@ -323,6 +851,21 @@ func Test_HandleCancelResearch_ExistingJob_CancelsAndReturns200(t *testing.T) {
 	}
 }
 
+func Test_HandleCancelResearch_FinishedJob_Returns409(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("cancel-done-id", "query", "opus", 10, cwd)
+	job.SetStatus(model.StatusCompleted)
+
+	rr := doRequest(t, srv, http.MethodDelete, "/research/cancel-done-id", "")
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+	if job.Status() != model.StatusCompleted {
+		t.Errorf("job.Status() = %q, want %q", job.Status(), model.StatusCompleted)
+	}
+}
+
 func Test_HandleCancelResearch_NonExistent_Returns404(t *testing.T) {
 	srv, _, _ := newTestServer(t)
 	rr := doRequest(t, srv, http.MethodDelete, "/research/no-such-job", "")
@@ -332,6 +875,299 @@ func Test_HandleCancelResearch_NonExistent_Returns404(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Run queue
+// ---------------------------------------------------------------------------
+
+func Test_RunQueue_PositionsMoveAndCancel(t *testing.T) {
+	runner := blockingRunner{release: make(chan struct{})}
+	defer close(runner.release)
+	srv, store, _ := newTestServerWith(t, runner, server.WithMaxConcurrentJobs(1))
+
+	first := startJob(t, srv, "first")
+	second := startJob(t, srv, "second")
+	third := startJob(t, srv, "third")
+
+	if second.QueuePosition != 1 || third.QueuePosition != 2 {
+		t.Errorf("queue positions = %d,%d, want 1,2", second.QueuePosition, third.QueuePosition)
+	}
+	firstJob, _ := store.Get(first.ID)
+	waitForStatus(t, firstJob, model.StatusRunning)
+
+	// Move the third job to the front.
+	rr := doRequest(t, srv, http.MethodPut, "/research/"+third.ID+"/position", `{"position":1}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT position status = %d, want %d; body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var moved model.JobStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &moved); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if moved.QueuePosition != 1 {
+		t.Errorf("moved QueuePosition = %d, want 1", moved.QueuePosition)
+	}
+	secondJob, _ := store.Get(second.ID)
+	if secondJob.QueuePosition() != 2 {
+		t.Errorf("second QueuePosition() = %d, want 2", secondJob.QueuePosition())
+	}
+
+	// Moving the running job is a conflict.
+	rr = doRequest(t, srv, http.MethodPut, "/research/"+first.ID+"/position", `{"position":1}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("PUT position on running job status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	// Cancelling a queued job removes it from the queue.
+	rr = doRequest(t, srv, http.MethodDelete, "/research/"+third.ID, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("DELETE status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if secondJob.QueuePosition() != 1 {
+		t.Errorf("second QueuePosition() = %d, want 1 after cancelling third", secondJob.QueuePosition())
+	}
+
+	// Cancelling the running job lets the next queued job start.
+	doRequest(t, srv, http.MethodDelete, "/research/"+first.ID, "")
+	waitForStatus(t, secondJob, model.StatusRunning)
+	thirdJob, _ := store.Get(third.ID)
+	if thirdJob.Status() != model.StatusCancelled {
+		t.Errorf("third Status() = %q, want %q", thirdJob.Status(), model.StatusCancelled)
+	}
+}
+
+func Test_HandleMoveResearch_InvalidPosition_Returns400(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	_ = store.Create("move-bad", "query", "opus", 10, cwd)
+
+	rr := doRequest(t, srv, http.MethodPut, "/research/move-bad/position", `{"position":0}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GET /research/{id}/tools
+// ---------------------------------------------------------------------------
+
+func Test_HandleListTools_PairsCalls(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("tools-job", "q", "opus", 10, cwd)
+	job.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Task", ToolUseID: "t1"})
+	job.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Task", ToolUseID: "t2"})
+	job.AddEvent(model.ParsedEvent{Index: 2, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "t2", ToolResult: "ok", DurationMS: 42})
+
+	rr := doRequest(t, srv, http.MethodGet, "/research/tools-job/tools", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var list model.ToolCallList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Tools) != 2 {
+		t.Fatalf("len(Tools) = %d, want 2", len(list.Tools))
+	}
+	if list.Tools[0].ToolUseID != "t1" || list.Tools[0].Status != model.ToolCallPending {
+		t.Errorf("Tools[0] = %+v, want pending t1", list.Tools[0])
+	}
+	if list.Tools[1].Status != model.ToolCallCompleted || list.Tools[1].DurationMS == nil || *list.Tools[1].DurationMS != 42 {
+		t.Errorf("Tools[1] = %+v, want completed t2 with duration 42", list.Tools[1])
+	}
+
+	rr = doRequest(t, srv, http.MethodGet, "/research/nope/tools", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GET /research/{id}/agents
+// ---------------------------------------------------------------------------
+
+func Test_HandleListAgents(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("agents-job", "q", "sonnet", 10, cwd)
+
+	rr := doRequest(t, srv, http.MethodGet, "/research/agents-job/agents", "")
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != `{"agents":[]}` {
+		t.Errorf("no agents: status = %d, body = %s; want 200 with empty list", rr.Code, rr.Body.String())
+	}
+
+	job.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "Task", ToolUseID: "w1",
+		ToolInput: map[string]any{"subagent_type": "research-worker", "description": "History"}})
+	job.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, ParentToolUseID: "w1", MessageID: "m1"})
+
+	rr = doRequest(t, srv, http.MethodGet, "/research/agents-job/agents", "")
+	var list model.SubagentList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Agents) != 1 {
+		t.Fatalf("len(Agents) = %d, want 1", len(list.Agents))
+	}
+	a := list.Agents[0]
+	if a.AgentType != "research-worker" || a.Status != model.SubagentRunning || a.Turns != 1 {
+		t.Errorf("agent = %+v, want running research-worker with 1 turn", a)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// POST /research/{id}/followup
+// ---------------------------------------------------------------------------
+
+func Test_HandleFollowUpResearch_CreatesLinkedJob(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+
+	outputDir := filepath.Join(cwd, "research-parent-20240101")
+	parent := store.Create("parent-id", "original query", "sonnet", 40, cwd)
+	parent.SetSessionID("sess-parent")
+	parent.SetOutputDir(outputDir)
+	parent.SetStatus(model.StatusCompleted)
+
+	rr := doRequest(t, srv, http.MethodPost, "/research/parent-id/followup", `{"query":"expand section 3"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+
+	var status model.JobStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if status.ID == "" || status.ID == "parent-id" {
+		t.Errorf("ID = %q, want a new job ID", status.ID)
+	}
+	if status.ParentID == nil || *status.ParentID != "parent-id" {
+		t.Errorf("ParentID = %v, want %q", status.ParentID, "parent-id")
+	}
+	if status.Query != "expand section 3" {
+		t.Errorf("Query = %q, want %q", status.Query, "expand section 3")
+	}
+	if status.Model != model.ModelSonnet || status.MaxTurns != 40 {
+		t.Errorf("Model/MaxTurns = %q/%d, want inherited sonnet/40", status.Model, status.MaxTurns)
+	}
+	if status.OutputDir == nil || *status.OutputDir != outputDir {
+		t.Errorf("OutputDir = %v, want parent's %q", status.OutputDir, outputDir)
+	}
+
+	job, ok := store.Get(status.ID)
+	if !ok {
+		t.Fatal("follow-up job not found in store")
+	}
+	if job.ResumeSessionID() != "sess-parent" {
+		t.Errorf("ResumeSessionID() = %q, want %q", job.ResumeSessionID(), "sess-parent")
+	}
+}
+
+func Test_HandleFollowUpResearch_Rejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(j *jobstore.Job)
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "parent still running",
+			setup:    func(j *jobstore.Job) { j.SetSessionID("s"); j.SetStatus(model.StatusRunning) },
+			body:     `{"query":"more"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "parent without session",
+			setup:    func(j *jobstore.Job) { j.SetStatus(model.StatusFailed) },
+			body:     `{"query":"more"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "empty query",
+			setup:    func(j *jobstore.Job) { j.SetSessionID("s"); j.SetStatus(model.StatusCompleted) },
+			body:     `{"query":""}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, store, cwd := newTestServer(t)
+			tt.setup(store.Create("parent", "q", "opus", 10, cwd))
+
+			rr := doRequest(t, srv, http.MethodPost, "/research/parent/followup", tt.body)
+			if rr.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d; body: %s", rr.Code, tt.wantCode, rr.Body.String())
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Replay backend
+// ---------------------------------------------------------------------------
+
+func Test_ReplayBackend_RunsJobsEndToEnd(t *testing.T) {
+	r := &runner.Runner{Backend: &backend.Replay{
+		Path:  filepath.Join("..", "backend", "testdata", "research.ndjson"),
+		Speed: 1000,
+	}}
+	srv, store, _ := newTestServerWith(t, r)
+
+	status := startJob(t, srv, "solid-state batteries")
+	job, _ := store.Get(status.ID)
+	waitForStatus(t, job, model.StatusCompleted)
+
+	rr := doRequest(t, srv, http.MethodGet, "/research/"+status.ID, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var detail model.JobDetail
+	if err := json.Unmarshal(rr.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if detail.SessionID == nil || *detail.SessionID != "replay-session" {
+		t.Errorf("SessionID = %v, want %q", detail.SessionID, "replay-session")
+	}
+	if detail.Progress == nil || detail.Progress.Phase != model.PhaseReport || detail.Progress.Percent != 100 {
+		t.Errorf("Progress = %+v, want the replayed workflow to complete", detail.Progress)
+	}
+
+	// The replay writes no files, so no output directory is assigned.
+	if detail.OutputDir != nil {
+		t.Errorf("OutputDir = %q, want none", *detail.OutputDir)
+	}
+
+	// The replay cannot resume the session for a follow-up.
+	rr = doRequest(t, srv, http.MethodPost, "/research/"+status.ID+"/followup", `{"query":"more"}`)
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("follow-up status = %d, want %d; body: %s", rr.Code, http.StatusNotImplemented, rr.Body.String())
+	}
+}
+
+func Test_ReplayBackend_FailedJob_StreamsErrorKindBeforeDone(t *testing.T) {
+	transcript := filepath.Join(t.TempDir(), "failed.ndjson")
+	lines := `{"type":"system","subtype":"init","session_id":"replay-session","timestamp":"2026-01-01T12:00:00Z"}
+{"type":"result","subtype":"error_during_execution","is_error":true,"result":"boom","timestamp":"2026-01-01T12:00:01Z"}
+`
+	if err := os.WriteFile(transcript, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := &runner.Runner{Backend: &backend.Replay{Path: transcript, Speed: 20}}
+	srv, store, _ := newTestServerWith(t, r)
+
+	status := startJob(t, srv, "failing run")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/research/"+status.ID+"/stream", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	kindAt := strings.Index(body, `"text":"crash"`)
+	doneAt := strings.Index(body, "event: done")
+	if kindAt < 0 || doneAt < 0 || kindAt > doneAt {
+		t.Fatalf("stream does not send the crash event before done:\n%s", body)
+	}
+	if job, _ := store.Get(status.ID); job.ErrorKind() != model.ErrorKindCrash {
+		t.Errorf("ErrorKind = %q, want %q", job.ErrorKind(), model.ErrorKindCrash)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // GET /research/past/{dir}/report
 // ---------------------------------------------------------------------------
@@ -598,6 +1434,36 @@ func Test_HandleListJobFiles_WithOutputDir_ReturnsList(t *testing.T) {
 // Sources subdirectory and source index
 // ---------------------------------------------------------------------------
 
+func Test_HandleListJobFiles_RunningJob_ListsFilesSoFar(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv, store, _ := newTestServerWith(t, blockingRunner{release: release})
+
+	status := startJob(t, srv, "running job")
+	job, _ := store.Get(status.ID)
+	waitForStatus(t, job, model.StatusRunning)
+
+	sources := filepath.Join(job.OutputDir(), "sources")
+	if err := os.MkdirAll(sources, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sources, "a.md"), []byte("# A"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := doRequest(t, srv, http.MethodGet, "/research/"+status.ID+"/files", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var resp model.FileListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Files) != 0 || len(resp.Sources) != 1 || resp.Sources[0].Name != "a.md" {
+		t.Errorf("files = %+v, sources = %+v, want just sources/a.md", resp.Files, resp.Sources)
+	}
+}
+
 func Test_HandleListPastFiles_WithSources_IncludesSourceEntries(t *testing.T) {
 	srv, _, cwd := newTestServer(t)
 
@@ -663,7 +1529,7 @@ func Test_HandleStreamResearch_CompletedJob_EmitsEventsAndDone(t *testing.T) {
 	job.SetStatus(model.StatusCompleted)
 	job.SetOutputDir(filepath.Join(cwd, "output"))
 
-	// Use a context with timeout so the SSE handler's ticker fires and exits.
+	// Use a context with timeout so a stuck handler cannot hang the test.
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
@@ -720,6 +1586,429 @@ func Test_HandleStreamResearch_AfterParam_SetsCursor(t *testing.T) {
 	}
 }
 
+func Test_HandleStreamResearch_LastEventID(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+
+	job := store.Create("sse-resume", "query", "opus", 10, cwd)
+	for i := range 4 {
+		job.AddEvent(model.ParsedEvent{Index: i, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Text: "e"})
+	}
+	job.SetStatus(model.StatusCompleted)
+
+	tests := []struct {
+		name        string
+		target      string
+		lastEventID string
+		wantIDs     []string
+	}{
+		{"no cursor", "/research/sse-resume/stream", "", []string{"0", "1", "2", "3"}},
+		{"after param", "/research/sse-resume/stream?after=2", "", []string{"2", "3"}},
+		{"header resumes after id", "/research/sse-resume/stream", "1", []string{"2", "3"}},
+		{"header takes precedence", "/research/sse-resume/stream?after=0", "2", []string{"3"}},
+		{"invalid header ignored", "/research/sse-resume/stream?after=3", "bogus", []string{"3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil).WithContext(ctx)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, req)
+
+			body := rr.Body.String()
+			if !strings.HasPrefix(body, "retry: ") {
+				t.Errorf("body does not start with a retry hint; body:\n%s", body)
+			}
+			var ids []string
+			for line := range strings.SplitSeq(body, "\n") {
+				if id, ok := strings.CutPrefix(line, "id: "); ok {
+					ids = append(ids, id)
+				}
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func Test_HandleStreamResearch_InvalidCursor_Returns400(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("sse-bad-cursor", "query", "opus", 10, cwd)
+	job.AddEvent(model.ParsedEvent{Type: model.EventTypeSystem, Text: "init"})
+	job.SetStatus(model.StatusCompleted)
+
+	tests := []struct {
+		name        string
+		target      string
+		lastEventID string
+	}{
+		{"negative after", "/research/sse-bad-cursor/stream?after=-3", ""},
+		{"non-numeric after", "/research/sse-bad-cursor/stream?after=abc", ""},
+		{"negative Last-Event-ID", "/research/sse-bad-cursor/stream", "-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d; body:\n%s", rr.Code, http.StatusBadRequest, rr.Body)
+			}
+		})
+	}
+}
+
+func Test_HandleStreamResearch_Filter(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+
+	job := store.Create("sse-filter", "query", "opus", 10, cwd)
+	job.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "WebFetch", ToolUseID: "t1"})
+	job.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Text: "thinking"})
+	job.AddEvent(model.ParsedEvent{Index: 2, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "t1", ToolResult: strings.Repeat("x", 500)})
+	job.SetStatus(model.StatusCompleted)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/research/sse-filter/stream?after=1&tools=WebFetch&max_result=10", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	if strings.Contains(body, "id: 0\n") || strings.Contains(body, "id: 1\n") {
+		t.Errorf("body contains events before the cursor or outside the filter:\n%s", body)
+	}
+	if !strings.Contains(body, "id: 2\n") {
+		t.Fatalf("body missing the WebFetch result after the cursor:\n%s", body)
+	}
+	if strings.Contains(body, strings.Repeat("x", 11)) || !strings.Contains(body, `"tool_result_truncated":true`) {
+		t.Errorf("tool_result not truncated to 10 runes:\n%s", body)
+	}
+	if !strings.Contains(body, "event: done") {
+		t.Errorf("body missing 'event: done':\n%s", body)
+	}
+}
+
+func Test_HandleStreamResearch_InvalidFilter_Returns400(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	store.Create("sse-bad", "query", "opus", 10, cwd)
+
+	for _, q := range []string{"max_result=-1", "max_input=abc", "omit=text"} {
+		rr := doRequest(t, srv, http.MethodGet, "/research/sse-bad/stream?"+q, "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", q, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func Test_HandleStreamResearch_LiveJob_PushesEventsAndHeartbeats(t *testing.T) {
+	srv, store, cwd := newTestServerWith(t, noopRunner{}, server.WithHeartbeatInterval(20*time.Millisecond))
+	job := store.Create("sse-live", "query", "opus", 10, cwd)
+	job.SetStatus(model.StatusRunning)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/research/sse-live/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET stream: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	lines := bufio.NewScanner(resp.Body)
+
+	// readUntil consumes lines until one has the given prefix.
+	readUntil := func(prefix string) string {
+		t.Helper()
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), prefix) {
+				return lines.Text()
+			}
+		}
+		t.Fatalf("stream ended before a line starting with %q: %v", prefix, lines.Err())
+		return ""
+	}
+
+	// An idle stream sends heartbeat comments.
+	readUntil(": heartbeat")
+
+	job.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Text: "pushed"})
+	if line := readUntil("data: "); !strings.Contains(line, "pushed") {
+		t.Errorf("data line = %q, want the pushed event", line)
+	}
+
+	job.SetStatus(model.StatusCompleted)
+	readUntil("event: done")
+}
+
+func Test_HandleStreamResearch_LiveJob_SendsFinalEventBeforeDone(t *testing.T) {
+	srv, store, cwd := newTestServerWith(t, noopRunner{}, server.WithHeartbeatInterval(20*time.Millisecond))
+	job := store.Create("sse-final", "query", "opus", 10, cwd)
+	job.SetStatus(model.StatusRunning)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/research/sse-final/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET stream: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() && !strings.HasPrefix(lines.Text(), ": heartbeat") {
+	}
+
+	job.Cancel()
+
+	var data []string
+	for lines.Scan() && lines.Text() != "event: done" {
+		if strings.HasPrefix(lines.Text(), "data: ") {
+			data = append(data, lines.Text())
+		}
+	}
+	if len(data) != 1 || !strings.Contains(data[0], `"text":"cancelled"`) {
+		t.Errorf("data before done = %q, want the cancelled event", data)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GET /ws  (WebSocket)
+// ---------------------------------------------------------------------------
+
+// wsReply mirrors the fields of server WebSocket messages used by tests.
+type wsReply struct {
+	Type   string           `json:"type"`
+	Ref    string           `json:"ref"`
+	JobID  string           `json:"job_id"`
+	Event  map[string]any   `json:"event"`
+	Status model.Status     `json:"status"`
+	Job    *model.JobStatus `json:"job"`
+	Jobs   *model.JobList   `json:"jobs"`
+	Error  string           `json:"error"`
+}
+
+// dialWS serves srv over HTTP and opens a WebSocket to its /ws endpoint.
+func dialWS(t *testing.T, srv http.Handler) *websocket.Conn {
+	t.Helper()
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"/ws")
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// sendWS writes a raw JSON message to conn.
+func sendWS(t *testing.T, conn *websocket.Conn, msg string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+}
+
+// readWS reads the next message from conn.
+func readWS(t *testing.T, conn *websocket.Conn) wsReply {
+	t.Helper()
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	var reply wsReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		t.Fatalf("invalid message %s: %v", data, err)
+	}
+	return reply
+}
+
+func Test_HandleWebSocket_NotAnUpgrade_Returns400(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	rr := doRequest(t, srv, http.MethodGet, "/ws", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func Test_HandleWebSocket_MultiplexesJobEvents(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	jobA := store.Create("ws-a", "query a", "opus", 10, cwd)
+	jobA.SetStatus(model.StatusRunning)
+	jobA.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeSystem, Text: "a0"})
+	jobA.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeSystem, Text: "a1"})
+	jobB := store.Create("ws-b", "query b", "opus", 10, cwd)
+	jobB.SetStatus(model.StatusRunning)
+
+	conn := dialWS(t, srv)
+	sendWS(t, conn, `{"type":"subscribe","job_id":"ws-a","after":1}`)
+	if got := readWS(t, conn); got.Type != "event" || got.JobID != "ws-a" || got.Event["text"] != "a1" {
+		t.Fatalf("first message = %+v, want event a1 of ws-a", got)
+	}
+
+	sendWS(t, conn, `{"type":"subscribe","job_id":"ws-b"}`)
+	jobB.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeSystem, Text: "b0"})
+	if got := readWS(t, conn); got.Type != "event" || got.JobID != "ws-b" || got.Event["text"] != "b0" {
+		t.Fatalf("message = %+v, want event b0 of ws-b", got)
+	}
+
+	sendWS(t, conn, `{"type":"unsubscribe","job_id":"ws-b"}`)
+	jobA.SetStatus(model.StatusCompleted)
+	if got := readWS(t, conn); got.Type != "done" || got.JobID != "ws-a" || got.Status != model.StatusCompleted {
+		t.Fatalf("message = %+v, want done for ws-a", got)
+	}
+}
+
+func Test_HandleWebSocket_SubscribeFilter(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("ws-filter", "query", "opus", 10, cwd)
+	job.AddEvent(model.ParsedEvent{Index: 0, Type: model.EventTypeAssistant, Subtype: model.SubtypeToolUse, ToolName: "WebFetch", ToolUseID: "t1"})
+	job.AddEvent(model.ParsedEvent{Index: 1, Type: model.EventTypeAssistant, Subtype: model.SubtypeText, Text: "thinking"})
+	job.AddEvent(model.ParsedEvent{Index: 2, Type: model.EventTypeUser, Subtype: model.SubtypeToolResult, ToolUseID: "t1", ToolResult: strings.Repeat("x", 500)})
+	job.SetStatus(model.StatusCompleted)
+
+	conn := dialWS(t, srv)
+	sendWS(t, conn, `{"type":"subscribe","job_id":"ws-filter","after":1,"tools":["WebFetch"],"max_result":10}`)
+	got := readWS(t, conn)
+	if got.Type != "event" || got.Event["index"] != float64(2) {
+		t.Fatalf("first message = %+v, want the WebFetch result after the cursor", got)
+	}
+	if got.Event["tool_result"] != strings.Repeat("x", 10) || got.Event["tool_result_truncated"] != true {
+		t.Errorf("event = %v, want tool_result truncated to 10 runes", got.Event)
+	}
+	if got := readWS(t, conn); got.Type != "done" {
+		t.Errorf("message = %+v, want done", got)
+	}
+}
+
+func Test_HandleWebSocket_Resubscribe_ReplacesStream(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("ws-resub", "query", "opus", 10, cwd)
+	job.SetStatus(model.StatusRunning)
+	job.AddEvent(model.ParsedEvent{Type: model.EventTypeSystem, Text: "e0"})
+	job.AddEvent(model.ParsedEvent{Type: model.EventTypeSystem, Text: "e1"})
+
+	conn := dialWS(t, srv)
+	sendWS(t, conn, `{"type":"subscribe","job_id":"ws-resub"}`)
+	for _, want := range []string{"e0", "e1"} {
+		if got := readWS(t, conn); got.Event["text"] != want {
+			t.Fatalf("message = %+v, want event %s", got, want)
+		}
+	}
+
+	sendWS(t, conn, `{"type":"subscribe","job_id":"ws-resub","after":1}`)
+	if got := readWS(t, conn); got.Event["text"] != "e1" {
+		t.Fatalf("message = %+v, want event e1 from the new stream", got)
+	}
+
+	// Only the new stream is left to deliver later events.
+	job.AddEvent(model.ParsedEvent{Type: model.EventTypeSystem, Text: "e2"})
+	job.SetStatus(model.StatusCompleted)
+	for _, want := range []string{"event", "done"} {
+		if got := readWS(t, conn); got.Type != want || (want == "event" && got.Event["text"] != "e2") {
+			t.Fatalf("message = %+v, want %s", got, want)
+		}
+	}
+}
+
+func Test_HandleWebSocket_Control(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	store.Create("ws-pending", "q", "opus", 10, cwd)
+	done := store.Create("ws-done", "q", "sonnet", 10, cwd)
+	done.SetSessionID("sess")
+	done.SetStatus(model.StatusCompleted)
+	store.Create("ws-nosession", "q", "opus", 10, cwd).SetStatus(model.StatusFailed)
+
+	conn := dialWS(t, srv)
+	tests := []struct {
+		name      string
+		msg       string
+		wantType  string
+		wantError string
+	}{
+		{"cancel pending job", `{"type":"cancel","ref":"r","job_id":"ws-pending"}`, "job", ""},
+		{"cancel finished job", `{"type":"cancel","ref":"r","job_id":"ws-pending"}`, "error", "job already finished"},
+		{"cancel missing job", `{"type":"cancel","ref":"r","job_id":"nope"}`, "error", "job not found"},
+		{"follow up", `{"type":"follow_up","ref":"r","job_id":"ws-done","query":"more"}`, "job", ""},
+		{"follow up without session", `{"type":"follow_up","ref":"r","job_id":"ws-nosession","query":"more"}`, "error", "parent job has no session to resume"},
+		{"follow up without query", `{"type":"follow_up","ref":"r","job_id":"ws-done"}`, "error", "query is required"},
+		{"subscribe missing job", `{"type":"subscribe","ref":"r","job_id":"nope"}`, "error", "job not found"},
+		{"subscribe negative cursor", `{"type":"subscribe","ref":"r","job_id":"ws-done","after":-3}`, "error", "after must be a non-negative integer"},
+		{"subscribe negative limit", `{"type":"subscribe","ref":"r","job_id":"ws-done","max_result":-1}`, "error", "max_result must be a non-negative integer"},
+		{"subscribe invalid omit", `{"type":"subscribe","ref":"r","job_id":"ws-done","omit":["text"]}`, "error", `omit must be tool_result or tool_input, got "text"`},
+		{"unknown type", `{"type":"bogus","ref":"r"}`, "error", "unknown message type"},
+		{"invalid json", `{`, "error", "invalid message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sendWS(t, conn, tt.msg)
+			got := readWS(t, conn)
+			if got.Type != tt.wantType || got.Error != tt.wantError {
+				t.Fatalf("reply = %+v, want type %q error %q", got, tt.wantType, tt.wantError)
+			}
+			if tt.msg != `{` && got.Ref != "r" {
+				t.Errorf("Ref = %q, want echoed %q", got.Ref, "r")
+			}
+		})
+	}
+
+	if job, _ := store.Get("ws-pending"); job.Status() != model.StatusCancelled {
+		t.Errorf("cancelled job status = %q, want %q", job.Status(), model.StatusCancelled)
+	}
+}
+
+func Test_HandleWebSocket_JobListUpdates(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	store.Create("ws-first", "q", "opus", 10, cwd)
+
+	conn := dialWS(t, srv)
+	sendWS(t, conn, `{"type":"subscribe_jobs"}`)
+	got := readWS(t, conn)
+	if got.Type != "jobs" || got.Jobs == nil || len(got.Jobs.Active) != 1 {
+		t.Fatalf("first message = %+v, want a list with one active job", got)
+	}
+
+	store.Create("ws-second", "q", "opus", 10, cwd)
+	got = readWS(t, conn)
+	if got.Type != "jobs" || got.Jobs == nil || len(got.Jobs.Active) != 2 {
+		t.Fatalf("update = %+v, want a list with two active jobs", got)
+	}
+}
+
+func Test_HandleWebSocket_JobListUpdates_SharedBetweenSessions(t *testing.T) {
+	srv, store, cwd := newTestServer(t)
+	job := store.Create("ws-shared", "q", "opus", 10, cwd)
+
+	conns := []*websocket.Conn{dialWS(t, srv), dialWS(t, srv)}
+	for _, conn := range conns {
+		sendWS(t, conn, `{"type":"subscribe_jobs"}`)
+		if got := readWS(t, conn); got.Type != "jobs" || got.Jobs == nil || len(got.Jobs.Active) != 1 {
+			t.Fatalf("first message = %+v, want a list with one active job", got)
+		}
+	}
+
+	// Both sessions see the change, whichever of them builds the list.
+	job.SetStatus(model.StatusRunning)
+	for i, conn := range conns {
+		got := readWS(t, conn)
+		if got.Type != "jobs" || got.Jobs == nil || len(got.Jobs.Active) != 1 || got.Jobs.Active[0].Status != model.StatusRunning {
+			t.Errorf("session %d update = %+v, want the job running", i, got)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // GET /research/{id}/files/{path...}  (active job file serving)
 // ---------------------------------------------------------------------------
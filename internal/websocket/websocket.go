@@ -0,0 +1,482 @@
+// Package websocket implements the subset of the WebSocket protocol (RFC
+// 6455) needed by the dashboard: the server-side opening handshake, a small
+// client for tests and tooling, and message framing with fragmentation,
+// ping/pong and close handling. Extensions and subprotocols are not
+// supported.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Constants and errors
+// ---------------------------------------------------------------------------
+
+// MessageType identifies the payload of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// Close status codes defined by RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure   = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseMessageTooBig   = 1009
+)
+
+// DefaultReadLimit is the largest message, in bytes, accepted by a server
+// connection returned from Upgrade unless changed with SetReadLimit.
+const DefaultReadLimit = 1 << 20
+
+// writeWait bounds how long a single frame write may block, so a stalled
+// peer cannot hold the write lock indefinitely.
+const writeWait = 10 * time.Second
+
+// acceptGUID is appended to the client key to derive Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+var (
+	// ErrBadHandshake is returned when the opening handshake is invalid.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	// ErrReadLimit is returned when a message exceeds the read limit.
+	ErrReadLimit = errors.New("websocket: message exceeds read limit")
+	// ErrClosed is returned when writing to a connection that was closed.
+	ErrClosed = errors.New("websocket: connection closed")
+)
+
+// CloseError is returned by ReadMessage when the peer sends a close frame.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket: close %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d: %s", e.Code, e.Text)
+}
+
+// ---------------------------------------------------------------------------
+// Handshake
+// ---------------------------------------------------------------------------
+
+// Upgrade performs the server side of the opening handshake and takes over
+// the underlying connection. Requests that carry an Origin header must come
+// from the same host as the request, since browsers do not apply the
+// same-origin policy to WebSocket connections. On failure Upgrade replies
+// with an HTTP error and returns a non-nil error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	fail := func(status int, reason string) (*Conn, error) {
+		http.Error(w, reason, status)
+		return nil, fmt.Errorf("%w: %s", ErrBadHandshake, reason)
+	}
+	if r.Method != http.MethodGet {
+		return fail(http.StatusMethodNotAllowed, "method must be GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "not a websocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return fail(http.StatusForbidden, "cross-origin websocket request")
+		}
+	}
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fail(http.StatusInternalServerError, "connection does not support hijacking")
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	_ = netConn.SetWriteDeadline(time.Now().Add(writeWait))
+	if _, err := netConn.Write([]byte(resp)); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	_ = netConn.SetWriteDeadline(time.Time{})
+	return newConn(netConn, brw.Reader, false, DefaultReadLimit), nil
+}
+
+// Dial opens a client connection to a ws:// or wss:// URL. Client
+// connections have no read limit by default.
+func Dial(ctx context.Context, rawURL string) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var dialer interface {
+		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	}
+	port := "80"
+	switch u.Scheme {
+	case "ws":
+		dialer = &net.Dialer{}
+	case "wss":
+		dialer = &tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}
+		port = "443"
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = netConn.SetDeadline(deadline)
+	}
+
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: u.EscapedPath(), RawQuery: u.RawQuery},
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-Websocket-Key":     {key},
+			"Sec-Websocket-Version": {"13"},
+		},
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	if err := req.Write(netConn); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		_ = netConn.Close()
+		return nil, fmt.Errorf("%w: status %d", ErrBadHandshake, resp.StatusCode)
+	}
+	_ = netConn.SetDeadline(time.Time{})
+	return newConn(netConn, br, true, 0), nil
+}
+
+// acceptKey derives the Sec-WebSocket-Accept value for a client key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether any comma-separated token of header name
+// equals token, ignoring case.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for part := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+// Conn
+// ---------------------------------------------------------------------------
+
+// Conn is a WebSocket connection. ReadMessage must be called from a single
+// goroutine; WriteMessage, Ping and Close may be called concurrently with
+// each other and with ReadMessage.
+type Conn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	client    bool
+	readLimit int64
+
+	wmu       sync.Mutex
+	closeSent bool
+	closeOnce sync.Once
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool, readLimit int64) *Conn {
+	return &Conn{conn: conn, br: br, client: client, readLimit: readLimit}
+}
+
+// SetReadLimit sets the largest message, in bytes, that ReadMessage accepts.
+// Zero means unlimited. Larger messages close the connection with status
+// CloseMessageTooBig.
+func (c *Conn) SetReadLimit(n int64) {
+	c.readLimit = n
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next data message, reassembling fragments. Pings
+// are answered and pongs discarded while waiting. When the peer closes the
+// connection, the close is acknowledged and a *CloseError is returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var (
+		msgType MessageType
+		payload []byte
+	)
+	for {
+		fin, op, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, data); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			closeErr := &CloseError{Code: CloseNormalClosure}
+			if len(data) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(data))
+				closeErr.Text = string(data[2:])
+			}
+			_ = c.writeClose(closeErr.Code, "")
+			_ = c.conn.Close()
+			return 0, nil, closeErr
+		case opText, opBinary:
+			if msgType != 0 {
+				return 0, nil, c.protocolError("new message before previous one finished")
+			}
+			msgType = MessageType(op)
+		case opContinuation:
+			if msgType == 0 {
+				return 0, nil, c.protocolError("continuation without a message")
+			}
+		default:
+			return 0, nil, c.protocolError("unknown opcode")
+		}
+
+		if c.readLimit > 0 && int64(len(payload)+len(data)) > c.readLimit {
+			_ = c.CloseWithStatus(CloseMessageTooBig, "")
+			return 0, nil, ErrReadLimit
+		}
+		payload = append(payload, data...)
+		if fin {
+			return msgType, payload, nil
+		}
+	}
+}
+
+// readFrame reads a single frame and returns its unmasked payload.
+func (c *Conn) readFrame() (fin bool, op byte, data []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.protocolError("reserved bits set")
+	}
+	masked := head[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, c.protocolError("invalid frame masking")
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && (length > 125 || !fin) {
+		return false, 0, nil, c.protocolError("invalid control frame")
+	}
+	if c.readLimit > 0 && length > uint64(c.readLimit) {
+		_ = c.CloseWithStatus(CloseMessageTooBig, "")
+		return false, 0, nil, ErrReadLimit
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	data = make([]byte, length)
+	if _, err := io.ReadFull(c.br, data); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, data)
+	}
+	return fin, op, data, nil
+}
+
+// protocolError closes the connection with CloseProtocolError and returns
+// an error describing the violation.
+func (c *Conn) protocolError(reason string) error {
+	_ = c.CloseWithStatus(CloseProtocolError, reason)
+	return fmt.Errorf("websocket: protocol error: %s", reason)
+}
+
+// WriteMessage sends data as a single unfragmented message.
+func (c *Conn) WriteMessage(t MessageType, data []byte) error {
+	if t != TextMessage && t != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", t)
+	}
+	return c.writeFrame(byte(t), data)
+}
+
+// Ping sends a ping control frame. The peer's pong is consumed by
+// ReadMessage.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close sends a normal-closure close frame, if none was sent yet, and
+// closes the underlying connection.
+func (c *Conn) Close() error {
+	return c.CloseWithStatus(CloseNormalClosure, "")
+}
+
+// CloseWithStatus sends a close frame with the given status code and reason,
+// if none was sent yet, and closes the underlying connection. It does not
+// wait for the peer to acknowledge the close. Subsequent calls are no-ops.
+func (c *Conn) CloseWithStatus(code int, reason string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		_ = c.writeClose(code, reason)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// writeClose sends a close frame unless one was already sent.
+func (c *Conn) writeClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+	return c.writeFrameLocked(opClose, payload)
+}
+
+// writeFrame sends a single final frame.
+func (c *Conn) writeFrame(op byte, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	return c.writeFrameLocked(op, data)
+}
+
+// writeFrameLocked encodes and writes a frame. Client frames are masked as
+// the protocol requires. Caller must hold c.wmu.
+func (c *Conn) writeFrameLocked(op byte, data []byte) error {
+	buf := make([]byte, 0, 14+len(data))
+	buf = append(buf, 0x80|op)
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(data); {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	if c.client {
+		var mask [4]byte
+		_, _ = rand.Read(mask[:])
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, data...)
+		maskBytes(mask, buf[start:])
+	} else {
+		buf = append(buf, data...)
+	}
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// maskBytes applies the frame mask to data in place.
+func maskBytes(mask [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= mask[i%4]
+	}
+}
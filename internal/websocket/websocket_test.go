@@ -0,0 +1,195 @@
+package websocket_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamesprial/research-dashboard/internal/websocket"
+)
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+// newEchoServer starts a server that echoes every message it receives and
+// returns its ws:// URL.
+func newEchoServer(t *testing.T, readLimit int64) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		if readLimit > 0 {
+			conn.SetReadLimit(readLimit)
+		}
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(typ, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+// dial connects to url and closes the connection when the test ends.
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, url)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// ---------------------------------------------------------------------------
+// Test: Upgrade / Dial
+// ---------------------------------------------------------------------------
+
+func Test_Conn_Echo(t *testing.T) {
+	conn := dial(t, newEchoServer(t, 0))
+
+	messages := []struct {
+		name string
+		typ  websocket.MessageType
+		data string
+	}{
+		{"short text", websocket.TextMessage, "hello"},
+		{"empty", websocket.TextMessage, ""},
+		{"16-bit length", websocket.BinaryMessage, strings.Repeat("x", 1000)},
+		{"64-bit length", websocket.TextMessage, strings.Repeat("y", 70000)},
+	}
+	for _, tt := range messages {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := conn.WriteMessage(tt.typ, []byte(tt.data)); err != nil {
+				t.Fatalf("WriteMessage: %v", err)
+			}
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			if typ != tt.typ || string(data) != tt.data {
+				t.Errorf("echo = (%d, %d bytes), want (%d, %d bytes)", typ, len(data), tt.typ, len(tt.data))
+			}
+		})
+	}
+}
+
+func Test_Upgrade_RejectsInvalidHandshakes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := websocket.Upgrade(w, r); err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer ts.Close()
+
+	validKey := base64.StdEncoding.EncodeToString(make([]byte, 16))
+	tests := []struct {
+		name     string
+		method   string
+		header   map[string]string
+		wantCode int
+	}{
+		{"wrong method", http.MethodPost, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": validKey}, http.StatusMethodNotAllowed},
+		{"not an upgrade", http.MethodGet, map[string]string{"Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": validKey}, http.StatusBadRequest},
+		{"old version", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": validKey}, http.StatusUpgradeRequired},
+		{"bad key", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "short"}, http.StatusBadRequest},
+		{"cross origin", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": validKey, "Origin": "http://evil.example"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Test: framing
+// ---------------------------------------------------------------------------
+
+func Test_Conn_FragmentsAndControlFrames(t *testing.T) {
+	url := newEchoServer(t, 0)
+	raw, err := net.Dial("tcp", strings.TrimPrefix(url, "ws://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = raw.Close() }()
+	_ = raw.SetDeadline(time.Now().Add(5 * time.Second))
+
+	key := base64.StdEncoding.EncodeToString(make([]byte, 16))
+	_, _ = raw.Write([]byte("GET / HTTP/1.1\r\nHost: " + strings.TrimPrefix(url, "ws://") +
+		"\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: " + key + "\r\n\r\n"))
+	br := bufio.NewReader(raw)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake: status %v, err %v", resp, err)
+	}
+
+	// Masked client frames with an all-zero mask: "hel", a ping, "lo".
+	mask := []byte{0, 0, 0, 0}
+	frame := func(b0 byte, payload string) []byte {
+		return append(append([]byte{b0, 0x80 | byte(len(payload))}, mask...), payload...)
+	}
+	_, _ = raw.Write(frame(0x01, "hel"))      // text, not final
+	_, _ = raw.Write(frame(0x89, "p"))        // ping
+	_, _ = raw.Write(frame(0x80, "lo"))       // continuation, final
+	_, _ = raw.Write(frame(0x88, "\x03\xe8")) // close 1000
+
+	// Expect pong "p", the echoed "hello", then the close acknowledgement.
+	want := [][]byte{
+		{0x8A, 0x01, 'p'},
+		{0x81, 0x05, 'h', 'e', 'l', 'l', 'o'},
+		{0x88, 0x02, 0x03, 0xe8},
+	}
+	for i, w := range want {
+		got := make([]byte, len(w))
+		if _, err := io.ReadFull(br, got); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if string(got) != string(w) {
+			t.Errorf("frame %d = %x, want %x", i, got, w)
+		}
+	}
+}
+
+func Test_Conn_ReadLimit(t *testing.T) {
+	conn := dial(t, newEchoServer(t, 8))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("this is too long")); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseMessageTooBig {
+		t.Errorf("ReadMessage error = %v, want close %d", err, websocket.CloseMessageTooBig)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
@@ -15,7 +16,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jamesprial/research-dashboard/internal/backend"
 	"github.com/jamesprial/research-dashboard/internal/jobstore"
+	"github.com/jamesprial/research-dashboard/internal/model"
 	"github.com/jamesprial/research-dashboard/internal/runner"
 	"github.com/jamesprial/research-dashboard/internal/server"
 )
@@ -32,6 +35,20 @@ type config struct {
 	cwd        string
 	claudePath string
 	logLevel   string
+	stateDir   string
+
+	maxConcurrentJobs int
+	jobTimeout        time.Duration
+	maxJobTimeout     time.Duration
+	eventWindow       int
+
+	retryMaxAttempts int
+	retryBackoff     time.Duration
+	retryMaxBackoff  time.Duration
+
+	backend     string
+	replayFile  string
+	replaySpeed float64
 }
 
 func defaultConfig() config {
@@ -46,6 +63,18 @@ func defaultConfig() config {
 		cwd:        filepath.Join(home, "research"),
 		claudePath: "claude",
 		logLevel:   logLevel,
+
+		maxConcurrentJobs: server.DefaultMaxConcurrentJobs,
+		jobTimeout:        server.DefaultJobTimeout,
+		maxJobTimeout:     server.DefaultMaxJobTimeout,
+		eventWindow:       jobstore.DefaultEventWindow,
+
+		retryMaxAttempts: server.DefaultRetryPolicy.MaxAttempts,
+		retryBackoff:     time.Duration(server.DefaultRetryPolicy.BackoffSeconds) * time.Second,
+		retryMaxBackoff:  time.Duration(server.DefaultRetryPolicy.MaxBackoffSeconds) * time.Second,
+
+		backend:     "claude",
+		replaySpeed: 1,
 	}
 }
 
@@ -57,6 +86,19 @@ func main() {
 	flag.StringVar(&cfg.cwd, "cwd", cfg.cwd, "working directory for research runs")
 	flag.StringVar(&cfg.claudePath, "claude-path", cfg.claudePath, "path to the claude binary")
 	flag.StringVar(&cfg.logLevel, "log-level", cfg.logLevel, "log level: debug, info, warn, error")
+	flag.StringVar(&cfg.stateDir, "state-dir", cfg.stateDir, "directory for persisted job state (default {cwd}/.dashboard)")
+	flag.IntVar(&cfg.maxConcurrentJobs, "max-concurrent-jobs", cfg.maxConcurrentJobs, "maximum number of research jobs running at once")
+	flag.DurationVar(&cfg.jobTimeout, "job-timeout", cfg.jobTimeout,
+		fmt.Sprintf("wall-clock limit for jobs that do not request a timeout (0 means the default of %s; there is no unlimited setting)", server.DefaultJobTimeout))
+	flag.DurationVar(&cfg.maxJobTimeout, "max-job-timeout", cfg.maxJobTimeout,
+		fmt.Sprintf("largest timeout a job may request (0 means the default of %s)", server.DefaultMaxJobTimeout))
+	flag.IntVar(&cfg.eventWindow, "event-window", cfg.eventWindow, "events each job keeps in memory before spilling to disk (0 keeps all)")
+	flag.IntVar(&cfg.retryMaxAttempts, "retry-max-attempts", cfg.retryMaxAttempts, "attempts a job gets when it fails with a transient error (1 disables retries)")
+	flag.DurationVar(&cfg.retryBackoff, "retry-backoff", cfg.retryBackoff, "delay before a job's first retry, doubled for each later one")
+	flag.DurationVar(&cfg.retryMaxBackoff, "retry-max-backoff", cfg.retryMaxBackoff, "longest delay between retries")
+	flag.StringVar(&cfg.backend, "backend", cfg.backend, "backend that runs jobs: claude, or replay to play back --replay-file")
+	flag.StringVar(&cfg.replayFile, "replay-file", cfg.replayFile, "stream-json transcript the replay backend plays back")
+	flag.Float64Var(&cfg.replaySpeed, "replay-speed", cfg.replaySpeed, "pace of the replay backend relative to the recording")
 	flag.Parse()
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -78,6 +120,31 @@ func run(ctx context.Context, cfg config, addrCh chan<- string) error {
 	}
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
 
+	if cfg.maxConcurrentJobs < 0 {
+		return fmt.Errorf("max concurrent jobs must not be negative, got %d", cfg.maxConcurrentJobs)
+	}
+	if cfg.jobTimeout < 0 || cfg.maxJobTimeout < 0 {
+		return fmt.Errorf("job timeouts must not be negative, got %s and %s", cfg.jobTimeout, cfg.maxJobTimeout)
+	}
+	if cfg.jobTimeout > 0 && cfg.maxJobTimeout > 0 && cfg.jobTimeout > cfg.maxJobTimeout {
+		return fmt.Errorf("job timeout %s exceeds max job timeout %s", cfg.jobTimeout, cfg.maxJobTimeout)
+	}
+	if cfg.eventWindow < 0 {
+		return fmt.Errorf("event window must not be negative, got %d", cfg.eventWindow)
+	}
+	retry := model.RetryPolicy{
+		MaxAttempts:       cfg.retryMaxAttempts,
+		BackoffSeconds:    int(cfg.retryBackoff / time.Second),
+		MaxBackoffSeconds: int(cfg.retryMaxBackoff / time.Second),
+	}
+	if err := retry.Validate(); err != nil {
+		return fmt.Errorf("retry policy: %w", err)
+	}
+	r, err := newRunner(cfg)
+	if err != nil {
+		return err
+	}
+
 	// Validate cwd exists.
 	info, err := os.Stat(cfg.cwd)
 	if err != nil {
@@ -98,9 +165,44 @@ func run(ctx context.Context, cfg config, addrCh chan<- string) error {
 		return fmt.Errorf("embedded static fs: %w", err)
 	}
 
-	store := jobstore.NewStore()
-	r := runner.New(cfg.claudePath)
-	srv := server.New(store, r, staticFS, cfg.cwd, ctx)
+	// Persist jobs under the state directory and rehydrate them from any
+	// previous run.
+	stateDir := cfg.stateDir
+	if stateDir == "" {
+		stateDir = filepath.Join(cfg.cwd, ".dashboard")
+	}
+	// Spilled event segments only live as long as their in-memory job, so
+	// any left behind by a previous process are stale.
+	persister := jobstore.NewFilePersister(filepath.Join(stateDir, "jobs"))
+	defer persister.Close()
+	storeOpts := []jobstore.Option{jobstore.WithPersister(persister)}
+	if cfg.eventWindow > 0 {
+		spillDir := filepath.Join(stateDir, "spill")
+		if err := os.RemoveAll(spillDir); err != nil {
+			return fmt.Errorf("clear event spill dir: %w", err)
+		}
+		storeOpts = append(storeOpts, jobstore.WithEventWindow(cfg.eventWindow, spillDir))
+	}
+	store := jobstore.NewStore(storeOpts...)
+	restored, err := store.Restore()
+	if err != nil {
+		return fmt.Errorf("restore jobs: %w", err)
+	}
+	slog.Info("restored persisted jobs", "count", restored, "state_dir", stateDir)
+
+	// Zero-valued limits fall back to the server defaults.
+	var opts []server.Option
+	if cfg.maxConcurrentJobs > 0 {
+		opts = append(opts, server.WithMaxConcurrentJobs(cfg.maxConcurrentJobs))
+	}
+	if cfg.jobTimeout > 0 {
+		opts = append(opts, server.WithDefaultJobTimeout(cfg.jobTimeout))
+	}
+	if cfg.maxJobTimeout > 0 {
+		opts = append(opts, server.WithMaxJobTimeout(cfg.maxJobTimeout))
+	}
+	opts = append(opts, server.WithRetryPolicy(retry.WithDefaults(server.DefaultRetryPolicy)))
+	srv := server.New(store, r, staticFS, cfg.cwd, ctx, opts...)
 
 	httpSrv := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", cfg.host, cfg.port),
@@ -142,9 +244,12 @@ func run(ctx context.Context, cfg config, addrCh chan<- string) error {
 		close(errCh)
 	}()
 
-	// Wait for context cancellation.
+	// Wait for context cancellation. The server's jobs share the context,
+	// so their subprocesses are already being stopped; wait for them to
+	// exit before writing the store out.
 	<-ctx.Done()
 	slog.Info("shutting down")
+	srv.Wait()
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -152,11 +257,35 @@ func run(ctx context.Context, cfg config, addrCh chan<- string) error {
 	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
 		return fmt.Errorf("shutdown: %w", err)
 	}
+	// Write metadata changes still waiting to be coalesced.
+	store.Flush()
 
 	// Return any serve error.
 	return <-errCh
 }
 
+// newRunner returns a Runner for the backend selected by cfg.
+func newRunner(cfg config) (*runner.Runner, error) {
+	r := runner.New(cfg.claudePath)
+	switch cfg.backend {
+	case "", "claude":
+	case "replay":
+		if cfg.replayFile == "" {
+			return nil, errors.New("the replay backend requires --replay-file")
+		}
+		if _, err := os.Stat(cfg.replayFile); err != nil {
+			return nil, fmt.Errorf("replay file: %w", err)
+		}
+		if cfg.replaySpeed < 0 {
+			return nil, fmt.Errorf("replay speed must not be negative, got %g", cfg.replaySpeed)
+		}
+		r.Backend = &backend.Replay{Path: cfg.replayFile, Speed: cfg.replaySpeed}
+	default:
+		return nil, fmt.Errorf("unknown backend %q (want claude or replay)", cfg.backend)
+	}
+	return r, nil
+}
+
 // ensureResearchConfig writes embedded agent definition files to
 // {cwd}/.claude/agents/. Files are always overwritten so that binary
 // upgrades propagate updated prompts.
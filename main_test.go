@@ -78,6 +78,120 @@ func Test_Run_InvalidCWD_ReturnsError(t *testing.T) {
 	}
 }
 
+func Test_Run_InvalidJobTimeouts_ReturnsError(t *testing.T) {
+	tests := []struct {
+		name          string
+		jobTimeout    time.Duration
+		maxJobTimeout time.Duration
+	}{
+		{"negative default", -time.Second, 0},
+		{"negative max", 0, -time.Second},
+		{"default above max", 2 * time.Hour, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config{
+				port:          0,
+				host:          "127.0.0.1",
+				cwd:           t.TempDir(),
+				claudePath:    "claude",
+				logLevel:      "info",
+				jobTimeout:    tt.jobTimeout,
+				maxJobTimeout: tt.maxJobTimeout,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := run(ctx, cfg, nil); err == nil || !strings.Contains(err.Error(), "timeout") {
+				t.Errorf("run() error = %v, want a job timeout error", err)
+			}
+		})
+	}
+}
+
+func Test_Run_NegativeEventWindow_ReturnsError(t *testing.T) {
+	cfg := config{
+		port:        0,
+		host:        "127.0.0.1",
+		cwd:         t.TempDir(),
+		claudePath:  "claude",
+		logLevel:    "info",
+		eventWindow: -1,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := run(ctx, cfg, nil); err == nil || !strings.Contains(err.Error(), "event window") {
+		t.Errorf("run() error = %v, want an event window error", err)
+	}
+}
+
+func Test_Run_InvalidRetryPolicy_ReturnsError(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*config)
+	}{
+		{"negative attempts", func(c *config) { c.retryMaxAttempts = -1 }},
+		{"too many attempts", func(c *config) { c.retryMaxAttempts = 11 }},
+		{"negative backoff", func(c *config) { c.retryBackoff = -time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config{
+				port:       0,
+				host:       "127.0.0.1",
+				cwd:        t.TempDir(),
+				claudePath: "claude",
+				logLevel:   "info",
+			}
+			tt.cfg(&cfg)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := run(ctx, cfg, nil); err == nil || !strings.Contains(err.Error(), "retry policy") {
+				t.Errorf("run() error = %v, want a retry policy error", err)
+			}
+		})
+	}
+}
+
+func Test_Run_InvalidBackend_ReturnsError(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     func(*config)
+		wantErr string
+	}{
+		{"unknown backend", func(c *config) { c.backend = "gpt" }, "unknown backend"},
+		{"replay without file", func(c *config) { c.backend = "replay" }, "--replay-file"},
+		{"missing replay file", func(c *config) {
+			c.backend = "replay"
+			c.replayFile = filepath.Join(c.cwd, "missing.ndjson")
+		}, "replay file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config{
+				port:       0,
+				host:       "127.0.0.1",
+				cwd:        t.TempDir(),
+				claudePath: "claude",
+				logLevel:   "info",
+			}
+			tt.cfg(&cfg)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := run(ctx, cfg, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("run() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_Run_WritesAgentConfigs(t *testing.T) {
 	cwd := t.TempDir()
 	cfg := config{
@@ -0,0 +1,84 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_Run_Shutdown_StopsRunningJobs(t *testing.T) {
+	cwd := t.TempDir()
+	pidFile := filepath.Join(t.TempDir(), "claude.pid")
+	claude := filepath.Join(t.TempDir(), "claude")
+	script := "#!/bin/sh\necho $$ > " + pidFile + "\nexec sleep 30\n"
+	if err := os.WriteFile(claude, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{
+		port:       0,
+		host:       "127.0.0.1",
+		cwd:        cwd,
+		claudePath: claude,
+		logLevel:   "info",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	addrCh := make(chan string, 1)
+	go func() {
+		errCh <- run(ctx, cfg, addrCh)
+	}()
+
+	var addr string
+	select {
+	case addr = <-addrCh:
+	case err := <-errCh:
+		t.Fatalf("run() returned early: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for server to start")
+	}
+
+	resp, err := http.Post("http://"+addr+"/research", "application/json", strings.NewReader(`{"query":"q"}`))
+	if err != nil {
+		t.Fatalf("POST /research failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// Wait for the fake claude to start.
+	var pid int
+	deadline := time.Now().Add(5 * time.Second)
+	for pid == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the fake claude to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+		data, _ := os.ReadFile(pidFile)
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("run() returned error: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("timed out waiting for run() to exit")
+	}
+
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("fake claude (pid %d) still running after shutdown: %v", pid, err)
+	}
+}
@@ -23,12 +23,18 @@ async function apiJson(path, opts) {
   return (await api(path, opts)).json();
 }
 
-async function fetchList() {
-  return apiJson('/research');
+// params are optional list filter and paging parameters, e.g.
+// { q: 'battery', status: 'completed', limit: 20 }.
+async function fetchList(params) {
+  const qs = params ? '?' + new URLSearchParams(params) : '';
+  return apiJson(`/research${qs}`);
 }
 
-async function fetchJob(id) {
-  return apiJson(`/research/${id}`);
+// params are optional event filter and paging parameters, e.g.
+// { order: 'desc', limit: 500 } for the latest 500 events.
+async function fetchJob(id, params) {
+  const qs = params ? '?' + new URLSearchParams(params) : '';
+  return apiJson(`/research/${id}${qs}`);
 }
 
 async function fetchJobReport(id) {
@@ -70,14 +76,21 @@ async function fetchJobFile(jobId, filePath) {
 // --- Parsing helpers ---
 
 function parseDirName(name) {
-  // research-{topic}-{YYYYMMDD}-{HHMMSS}
-  const m = name.match(/^research-(.+?)-(\d{4})(\d{2})(\d{2})-(\d{2})(\d{2})(\d{2})$/);
+  // research-{topic}-{YYYYMMDD}-{HHMMSS}, optionally followed by -{job id}
+  // when the server assigned the name, in which case the time is UTC.
+  const m = name.match(/^research-(.+?)-(\d{4})(\d{2})(\d{2})-(\d{2})(\d{2})(\d{2})(-[a-z0-9]+)?$/);
   if (!m) return { topic: name.replace(/^research-/, ''), date: '' };
   const topic = m[1];
-  const d = new Date(+m[2], +m[3] - 1, +m[4], +m[5], +m[6], +m[7]);
+  const d = m[8]
+    ? new Date(Date.UTC(+m[2], +m[3] - 1, +m[4], +m[5], +m[6], +m[7]))
+    : new Date(+m[2], +m[3] - 1, +m[4], +m[5], +m[6], +m[7]);
+  return { topic, date: formatDateTime(d) };
+}
+
+function formatDateTime(d) {
   const date = d.toLocaleDateString('en-US', { month: 'short', day: 'numeric', year: 'numeric' });
   const time = d.toLocaleTimeString('en-US', { hour: '2-digit', minute: '2-digit' });
-  return { topic, date: `${date}, ${time}` };
+  return `${date}, ${time}`;
 }
 
 function truncate(s, n) {